@@ -36,6 +36,134 @@ type CertInjectionSpec struct {
 	// +kubebuilder:validation:Required
 	// CertSecret is the name of the secret which contains the certificate.
 	CertSecret corev1.LocalObjectReference `json:"certSecret"`
+
+	// +kubebuilder:validation:Optional
+	// Aliases are the other hosts, in the host[:port] form, the registry is reachable at,
+	// e.g. the notary host or the internal service DNS.
+	// They're trusted with the same CA certificate as ExternalDNS.
+	Aliases []string `json:"aliases,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Registries are the additional registries trusted with their own CA bundles.
+	// All the registries are injected by the same injectors.
+	Registries []Registry `json:"registries,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Auto
+	// ContainerRuntime of the worker nodes, which decides where the CA certificate is written.
+	// In the Auto mode, the runtime of each node is detected from its status and
+	// an injector is created for each runtime in use.
+	ContainerRuntime ContainerRuntime `json:"containerRuntime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=DockerCertsDir
+	// Mode of writing the CA certificate into the worker nodes.
+	// Only take effect on the nodes running containerd.
+	Mode InjectionMode `json:"mode,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// HostsConfig customizes the containerd hosts.toml of the registry.
+	// Only take effect in the ContainerdHosts mode.
+	HostsConfig *HostsConfig `json:"hostsConfig,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=DaemonSet;Shared;Job
+	// Strategy of injecting the CA certificate into the worker nodes, e.g. DaemonSet, Shared or Job.
+	// Defaults to the strategy set for the operator.
+	Strategy string `json:"strategy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Scheduling of the injector pods, e.g. to reach the tainted nodes.
+	// The unset fields default to the scheduling set for the operator.
+	// Not supported by the Shared strategy, whose injectors are scheduled as set for the operator.
+	Scheduling *Scheduling `json:"scheduling,omitempty"`
+}
+
+// Registry defines the hosts of a registry and the CA bundle trusted for them.
+type Registry struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	// Hosts of the registry in the host[:port] form.
+	Hosts []string `json:"hosts"`
+
+	// +kubebuilder:validation:Required
+	// CertSecret is the name of the secret which contains the CA bundle in ca.crt.
+	// The bundle may contain multiple PEM encoded CA certificates.
+	CertSecret corev1.LocalObjectReference `json:"certSecret"`
+}
+
+// ContainerRuntime is the container runtime of the worker nodes.
+// +kubebuilder:validation:Enum=Auto;Containerd;CRIO;Docker
+type ContainerRuntime string
+
+const (
+	// AutoRuntime detects the runtime of each node from Node.Status.NodeInfo.ContainerRuntimeVersion.
+	AutoRuntime ContainerRuntime = "Auto"
+	// ContainerdRuntime writes the CA certificate as the injection mode specifies.
+	ContainerdRuntime ContainerRuntime = "Containerd"
+	// CRIORuntime writes the CA certificate into /etc/containers/certs.d/<host>/ca.crt,
+	// which is read by both CRI-O and Podman.
+	CRIORuntime ContainerRuntime = "CRIO"
+	// DockerRuntime writes the CA certificate into /etc/docker/certs.d/<host>/ca.crt.
+	DockerRuntime ContainerRuntime = "Docker"
+)
+
+// InjectionMode defines how the CA certificate is written into the worker nodes.
+// +kubebuilder:validation:Enum=DockerCertsDir;ContainerdHosts
+type InjectionMode string
+
+const (
+	// DockerCertsDirMode copies the CA certificate into /etc/docker/certs.d/<host>/ca.crt.
+	// Containerd reads it through the compatibility of Docker's certificate file pattern.
+	DockerCertsDirMode InjectionMode = "DockerCertsDir"
+	// ContainerdHostsMode copies the CA certificate into /etc/containerd/certs.d/<host>/ca.crt
+	// and generates the containerd hosts.toml alongside.
+	ContainerdHostsMode InjectionMode = "ContainerdHosts"
+)
+
+// HostCapability is the operation a containerd registry host is trusted to perform.
+// +kubebuilder:validation:Enum=pull;resolve;push
+type HostCapability string
+
+// HostsConfig defines the settings of the generated containerd hosts.toml.
+type HostsConfig struct {
+	// +kubebuilder:validation:Optional
+	// Capabilities of the registry host. Defaults to pull and resolve.
+	Capabilities []HostCapability `json:"capabilities,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Mirrors are the hosts, in the host[:port] form, tried in order before the registry itself.
+	// The mirrors are trusted with the same CA certificate.
+	// Only take effect on ExternalDNS and its aliases.
+	Mirrors []string `json:"mirrors,omitempty"`
+}
+
+// Scheduling defines where and how the injector pods are scheduled.
+type Scheduling struct {
+	// +kubebuilder:validation:Optional
+	// NodeSelector restricts the injectors to the nodes with the labels.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Tolerations of the injectors.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// TolerateAll makes the injectors tolerate all the taints, then the CA cert is injected into all the nodes.
+	TolerateAll bool `json:"tolerateAll,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Affinity of the injectors.
+	// The required node affinity is combined with the restriction to the nodes of each container runtime.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PriorityClassName of the injectors.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Resources of the injector container.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
 }
 
 // CertInjectionStatus defines the observed state of CertInjection
@@ -49,6 +177,73 @@ type CertInjectionStatus struct {
 	// Injector injects the CA cert into worker nodes where containerd is running.
 	// Rely on a DaemonSet to do injection work.
 	Injector *corev1.ObjectReference `json:"injector,omitempty"`
+	// Injectors are all the DaemonSets doing the injection work, one for each container runtime in use.
+	// Injector is the first of them.
+	Injectors []corev1.ObjectReference `json:"injectors,omitempty"`
+	// Strategy injecting the CA cert into the worker nodes.
+	Strategy string `json:"strategy,omitempty"`
+	// DesiredNodes is the number of nodes where the CA cert should be injected.
+	DesiredNodes int32 `json:"desiredNodes"`
+	// InjectedNodes is the number of nodes where the CA cert has been injected and verified.
+	InjectedNodes int32 `json:"injectedNodes"`
+	// FailedNodes is the number of nodes where the CA cert has not been injected or verified.
+	// The names of the nodes are listed in the message of the NodesInjected condition.
+	FailedNodes int32 `json:"failedNodes"`
+	// Certificates are the CA certificates being injected.
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+	// NotAfter is the earliest expiry time of the CA certificates being injected.
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// Nodes are the injection results of each node.
+	// Only recorded by the Job injector, which runs a job on each node.
+	Nodes []NodeInjectionStatus `json:"nodes,omitempty"`
+}
+
+// NodeInjectionPhase is the phase of the injection on a node.
+type NodeInjectionPhase string
+
+const (
+	// NodeInjectionPending means the injection job is running on the node.
+	NodeInjectionPending NodeInjectionPhase = "Pending"
+	// NodeInjectionInjected means the CA certs have been injected into the node and verified.
+	NodeInjectionInjected NodeInjectionPhase = "Injected"
+	// NodeInjectionFailed means the injection job has failed on the node.
+	NodeInjectionFailed NodeInjectionPhase = "Failed"
+)
+
+// NodeInjectionStatus records the injection result of a node.
+type NodeInjectionStatus struct {
+	// Node name.
+	Node string `json:"node"`
+	// Phase of the injection on the node.
+	Phase NodeInjectionPhase `json:"phase"`
+	// Revision of the injected files, which changes with the CA certs and the injection settings.
+	Revision string `json:"revision,omitempty"`
+	// Job injecting the node.
+	Job string `json:"job,omitempty"`
+	// CompletionTime is the time the CA certs are injected into the node.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message of the failure.
+	Message string `json:"message,omitempty"`
+}
+
+// CertificateInfo records the details of an injected CA certificate.
+type CertificateInfo struct {
+	// Secret is the name of the secret containing the certificate.
+	Secret string `json:"secret"`
+	// Hosts of the registry trusting the certificate.
+	Hosts []string `json:"hosts,omitempty"`
+	// Subject of the certificate.
+	Subject string `json:"subject"`
+	// Issuer of the certificate.
+	Issuer string `json:"issuer"`
+	// SerialNumber of the certificate in hex.
+	SerialNumber string `json:"serialNumber"`
+	// FingerprintSHA256 is the hex encoded SHA-256 fingerprint of the certificate.
+	FingerprintSHA256 string `json:"fingerprintSHA256"`
+	// NotBefore is the time the certificate becomes valid.
+	NotBefore metav1.Time `json:"notBefore"`
+	// NotAfter is the time the certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
 }
 
 // CertInjectionCondition defines the observed condition of CertInjectionStatus.
@@ -62,6 +257,14 @@ type CertInjectionCondition struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Registry",type=string,JSONPath=`.spec.externalDNS`
+//+kubebuilder:printcolumn:name="Strategy",type=string,JSONPath=`.status.strategy`,priority=1
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredNodes`
+//+kubebuilder:printcolumn:name="Injected",type=integer,JSONPath=`.status.injectedNodes`
+//+kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failedNodes`
+//+kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.notAfter`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // CertInjection is the Schema for the certinjections API
 type CertInjection struct {
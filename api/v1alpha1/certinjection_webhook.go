@@ -0,0 +1,235 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// The strategies of the injectors, which can't be imported from the injector package.
+const (
+	daemonSetStrategy = "DaemonSet"
+	sharedStrategy    = "Shared"
+	jobStrategy       = "Job"
+)
+
+var strategies = []string{daemonSetStrategy, sharedStrategy, jobStrategy}
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks of CertInjection.
+func (r *CertInjection) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&certInjectionDefaulter{}).
+		WithValidator(&certInjectionValidator{Reader: mgr.GetAPIReader()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-day2-operations-goharbor-io-v1alpha1-certinjection,mutating=true,failurePolicy=fail,sideEffects=None,groups=day2-operations.goharbor.io,resources=certinjections,verbs=create;update,versions=v1alpha1,name=mcertinjection.kb.io,admissionReviewVersions=v1
+
+// certInjectionDefaulter normalizes the registry hosts of CertInjection.
+type certInjectionDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &certInjectionDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+// The invalid addresses are left as they are and rejected by the validating webhook.
+func (d *certInjectionDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	ci, ok := obj.(*CertInjection)
+	if !ok {
+		return fmt.Errorf("expected a CertInjection but got a %T", obj)
+	}
+
+	ci.Spec.ExternalDNS = normalizeHost(ci.Spec.ExternalDNS)
+	normalizeHosts(ci.Spec.Aliases)
+
+	for i := range ci.Spec.Registries {
+		normalizeHosts(ci.Spec.Registries[i].Hosts)
+	}
+
+	if ci.Spec.HostsConfig != nil {
+		normalizeHosts(ci.Spec.HostsConfig.Mirrors)
+	}
+
+	return nil
+}
+
+func normalizeHost(host string) string {
+	if normalized, err := registry.NormalizeHost(host); err == nil {
+		return normalized
+	}
+
+	return host
+}
+
+func normalizeHosts(hosts []string) {
+	for i := range hosts {
+		hosts[i] = normalizeHost(hosts[i])
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-day2-operations-goharbor-io-v1alpha1-certinjection,mutating=false,failurePolicy=fail,sideEffects=None,groups=day2-operations.goharbor.io,resources=certinjections,verbs=create;update,versions=v1alpha1,name=vcertinjection.kb.io,admissionReviewVersions=v1
+
+// certInjectionValidator validates the registry hosts and the CA secrets of CertInjection.
+type certInjectionValidator struct {
+	client.Reader
+}
+
+var _ webhook.CustomValidator = &certInjectionValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *certInjectionValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	return v.validate(ctx, obj)
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *certInjectionValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) error {
+	return v.validate(ctx, newObj)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *certInjectionValidator) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
+
+func (v *certInjectionValidator) validate(ctx context.Context, obj runtime.Object) error {
+	ci, ok := obj.(*CertInjection)
+	if !ok {
+		return fmt.Errorf("expected a CertInjection but got a %T", obj)
+	}
+
+	// Skip the objects being deleted, then the finalizer can always be removed.
+	if !ci.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	specPath := field.NewPath("spec")
+
+	// All the hosts are injected into the same directories of the nodes, so they must be unique.
+	seen := make(map[string]bool)
+	validateHost := func(host string, path *field.Path) field.ErrorList {
+		if err := registry.ValidateHost(host); err != nil {
+			return field.ErrorList{field.Invalid(path, host, err.Error())}
+		}
+
+		if seen[host] {
+			return field.ErrorList{field.Duplicate(path, host)}
+		}
+
+		seen[host] = true
+
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateHost(ci.Spec.ExternalDNS, specPath.Child("externalDNS"))...)
+	for i, a := range ci.Spec.Aliases {
+		allErrs = append(allErrs, validateHost(a, specPath.Child("aliases").Index(i))...)
+	}
+
+	allErrs = append(allErrs, v.validateCertSecret(ctx, ci, ci.Spec.CertSecret, specPath.Child("certSecret"))...)
+
+	for i, r := range ci.Spec.Registries {
+		registryPath := specPath.Child("registries").Index(i)
+		if len(r.Hosts) == 0 {
+			allErrs = append(allErrs, field.Required(registryPath.Child("hosts"), "at least one host is required"))
+		}
+
+		for j, h := range r.Hosts {
+			allErrs = append(allErrs, validateHost(h, registryPath.Child("hosts").Index(j))...)
+		}
+
+		allErrs = append(allErrs, v.validateCertSecret(ctx, ci, r.CertSecret, registryPath.Child("certSecret"))...)
+	}
+
+	if ci.Spec.HostsConfig != nil {
+		for i, m := range ci.Spec.HostsConfig.Mirrors {
+			if err := registry.ValidateHost(m); err != nil {
+				allErrs = append(allErrs, field.Invalid(specPath.Child("hostsConfig", "mirrors").Index(i), m, err.Error()))
+			}
+		}
+	}
+
+	if ci.Spec.Strategy != "" && !containsString(strategies, ci.Spec.Strategy) {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("strategy"), ci.Spec.Strategy, strategies))
+	}
+
+	// The shared injectors serve all the injections, so they can't be scheduled by one of them.
+	if ci.Spec.Strategy == sharedStrategy && ci.Spec.Scheduling != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("scheduling"),
+			"not supported by the Shared strategy, the shared injectors are scheduled as set for the operator"))
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("CertInjection").GroupKind(), ci.Name, allErrs)
+}
+
+// validateCertSecret checks the CA certs in the secret.
+// A secret which does not exist yet is accepted, the injection waits for it.
+func (v *certInjectionValidator) validateCertSecret(ctx context.Context, ci *CertInjection, ref corev1.LocalObjectReference, path *field.Path) field.ErrorList {
+	if ref.Name == "" {
+		return field.ErrorList{field.Required(path.Child("name"), "name of the CA secret is required")}
+	}
+
+	secret := &corev1.Secret{}
+	if err := v.Get(ctx, types.NamespacedName{Namespace: ci.Namespace, Name: ref.Name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+
+		return field.ErrorList{field.InternalError(path, err)}
+	}
+
+	ca, ok := secret.Data[mytypes.CAKeyInSecret]
+	if !ok || len(ca) == 0 {
+		return field.ErrorList{field.Invalid(path.Child("name"), ref.Name,
+			fmt.Sprintf("secret has no %s", mytypes.CAKeyInSecret))}
+	}
+
+	if err := certutil.ValidateCA(ca); err != nil {
+		return field.ErrorList{field.Invalid(path.Child("name"), ref.Name,
+			fmt.Sprintf("invalid %s in secret: %s", mytypes.CAKeyInSecret, err))}
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
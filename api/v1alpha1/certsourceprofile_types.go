@@ -0,0 +1,125 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CertSourceProfileSpec defines how the registry and its CA are extracted from the custom resources of a kind.
+// The paths are JSONPath templates evaluated on the custom resources, e.g. {.spec.externalURL}.
+type CertSourceProfileSpec struct {
+	// +kubebuilder:validation:Required
+	// Target is the kind of the custom resources the CA is extracted from, it must be namespaced.
+	Target TargetKind `json:"target"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// HostPath is the JSONPath of the registry host. A URL is accepted and the host[:port] of it is used.
+	HostPath string `json:"hostPath"`
+
+	// +kubebuilder:validation:Optional
+	// AliasesPath is the JSONPath of the other hosts the registry is reachable at.
+	// A list or a comma separated string is accepted.
+	AliasesPath string `json:"aliasesPath,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// CASecretNamePath is the JSONPath of the name of the secret containing the CA.
+	CASecretNamePath string `json:"caSecretNamePath"`
+
+	// +kubebuilder:validation:Optional
+	// CASecretNamespacePath is the JSONPath of the namespace of the secret containing the CA.
+	// Defaults to the namespace of the custom resource.
+	// A namespace other than the one of the custom resource must be listed in AllowedCASecretNamespaces.
+	CASecretNamespacePath string `json:"caSecretNamespacePath,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// AllowedCASecretNamespaces are the namespaces other than the one of the custom resource which the CA secret
+	// can be read from, as the secret is read by the operator on behalf of whoever creates the custom resource.
+	AllowedCASecretNamespaces []string `json:"allowedCASecretNamespaces,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// CAKey is the data key of the CA in the secret.
+	// If it's not set, the CA is read from ca.crt, or picked from the certificate chain in tls.crt.
+	CAKey string `json:"caKey,omitempty"`
+}
+
+// TargetKind defines a kind of the custom resources.
+type TargetKind struct {
+	// +kubebuilder:validation:Optional
+	// Group of the kind, empty for the core group.
+	Group string `json:"group,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// Version of the kind.
+	Version string `json:"version"`
+
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// Kind of the custom resources.
+	Kind string `json:"kind"`
+}
+
+// GroupVersionKind returns the GVK of the target kind.
+func (t TargetKind) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: t.Group, Version: t.Version, Kind: t.Kind}
+}
+
+// CertSourceProfileStatus defines the observed state of CertSourceProfile
+type CertSourceProfileStatus struct {
+	// Conditions of CertSourceProfile.
+	Conditions []CertInjectionCondition `json:"conditions,omitempty"`
+	// Target is the kind being watched for the profile, the cert injections of it are removed
+	// when the profile is deleted or targets another kind.
+	Target *TargetKind `json:"target,omitempty"`
+	// ObservedGeneration is the generation of the profile the status is for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Group",type=string,JSONPath=`.spec.target.group`
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.target.version`
+//+kubebuilder:printcolumn:name="Kind",type=string,JSONPath=`.spec.target.kind`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CertSourceProfile is the Schema for the certsourceprofiles API
+type CertSourceProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertSourceProfileSpec   `json:"spec,omitempty"`
+	Status CertSourceProfileStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CertSourceProfileList contains a list of CertSourceProfile
+type CertSourceProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CertSourceProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CertSourceProfile{}, &CertSourceProfileList{})
+}
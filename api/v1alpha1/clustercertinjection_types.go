@@ -0,0 +1,91 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterCertInjectionSpec defines the desired state of ClusterCertInjection
+type ClusterCertInjectionSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	// Registries trusted with their CA bundles.
+	Registries []ClusterRegistry `json:"registries"`
+}
+
+// ClusterRegistry defines the hosts of a registry and the secret, in any namespace, containing the CA trusted for them.
+type ClusterRegistry struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	// Hosts of the registry in the host[:port] form.
+	Hosts []string `json:"hosts"`
+
+	// +kubebuilder:validation:Required
+	// CertSecret references the secret which contains the CA bundle in ca.crt,
+	// or a certificate chain in tls.crt where the CA is picked from.
+	CertSecret corev1.SecretReference `json:"certSecret"`
+}
+
+// ClusterCertInjectionStatus defines the observed state of ClusterCertInjection
+type ClusterCertInjectionStatus struct {
+	// Conditions of ClusterCertInjection.
+	Conditions []CertInjectionCondition `json:"conditions,omitempty"`
+	// Injection is the CertInjection in the operator namespace serving all the cluster cert injections.
+	Injection *corev1.ObjectReference `json:"injection,omitempty"`
+	// DesiredNodes is the number of nodes where the CA certs should be injected.
+	DesiredNodes int32 `json:"desiredNodes"`
+	// InjectedNodes is the number of nodes where the CA certs have been injected and verified.
+	InjectedNodes int32 `json:"injectedNodes"`
+	// FailedNodes is the number of nodes where the CA certs have not been injected or verified.
+	FailedNodes int32 `json:"failedNodes"`
+	// NotAfter is the earliest expiry time of the CA certificates being injected.
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredNodes`
+//+kubebuilder:printcolumn:name="Injected",type=integer,JSONPath=`.status.injectedNodes`
+//+kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failedNodes`
+//+kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.notAfter`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterCertInjection is the Schema for the clustercertinjections API
+type ClusterCertInjection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterCertInjectionSpec   `json:"spec,omitempty"`
+	Status ClusterCertInjectionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterCertInjectionList contains a list of ClusterCertInjection
+type ClusterCertInjectionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCertInjection `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCertInjection{}, &ClusterCertInjectionList{})
+}
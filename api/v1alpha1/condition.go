@@ -0,0 +1,100 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the type, nil is returned if it does not exist.
+func (s *CertInjectionStatus) GetCondition(conditionType string) *CertInjectionCondition {
+	return getCondition(s.Conditions, conditionType)
+}
+
+// IsConditionTrue checks whether the condition of the type exists and is true.
+func (s *CertInjectionStatus) IsConditionTrue(conditionType string) bool {
+	c := s.GetCondition(conditionType)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// SetCondition adds the condition or updates the existing one of the same type.
+// The last transition time is refreshed only when the status changes.
+// It returns true if any change is made.
+func (s *CertInjectionStatus) SetCondition(condition CertInjectionCondition) bool {
+	return setCondition(&s.Conditions, condition)
+}
+
+// GetCondition returns the condition of the type, nil is returned if it does not exist.
+func (s *ClusterCertInjectionStatus) GetCondition(conditionType string) *CertInjectionCondition {
+	return getCondition(s.Conditions, conditionType)
+}
+
+// SetCondition adds the condition or updates the existing one of the same type.
+// It returns true if any change is made.
+func (s *ClusterCertInjectionStatus) SetCondition(condition CertInjectionCondition) bool {
+	return setCondition(&s.Conditions, condition)
+}
+
+// GetCondition returns the condition of the type, nil is returned if it does not exist.
+func (s *CertSourceProfileStatus) GetCondition(conditionType string) *CertInjectionCondition {
+	return getCondition(s.Conditions, conditionType)
+}
+
+// SetCondition adds the condition or updates the existing one of the same type.
+// It returns true if any change is made.
+func (s *CertSourceProfileStatus) SetCondition(condition CertInjectionCondition) bool {
+	return setCondition(&s.Conditions, condition)
+}
+
+func getCondition(conditions []CertInjectionCondition, conditionType string) *CertInjectionCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func setCondition(conditions *[]CertInjectionCondition, condition CertInjectionCondition) bool {
+	existing := getCondition(*conditions, condition.Type)
+	if existing == nil {
+		now := metav1.Now()
+		condition.LastTransitionTime = &now
+		*conditions = append(*conditions, condition)
+
+		return true
+	}
+
+	if existing.Status == condition.Status &&
+		existing.Reason == condition.Reason &&
+		existing.Message == condition.Message {
+		return false
+	}
+
+	if existing.Status != condition.Status || existing.LastTransitionTime == nil {
+		now := metav1.Now()
+		existing.LastTransitionTime = &now
+	}
+
+	existing.Status = condition.Status
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+
+	return true
+}
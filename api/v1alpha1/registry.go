@@ -0,0 +1,38 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// EffectiveRegistries returns all the registries of the injection.
+// The first one is built from ExternalDNS, Aliases and CertSecret, followed by the Registries.
+func (s *CertInjectionSpec) EffectiveRegistries() []Registry {
+	primary := Registry{
+		Hosts:      append([]string{s.ExternalDNS}, s.Aliases...),
+		CertSecret: s.CertSecret,
+	}
+
+	return append([]Registry{primary}, s.Registries...)
+}
+
+// AllHosts returns the hosts of all the registries of the injection.
+func (s *CertInjectionSpec) AllHosts() []string {
+	var hosts []string
+	for _, r := range s.EffectiveRegistries() {
+		hosts = append(hosts, r.Hosts...)
+	}
+
+	return hosts
+}
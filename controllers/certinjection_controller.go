@@ -18,31 +18,53 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"time"
 
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/injector"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/inspector"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/probe"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/metrics"
 	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 
-	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// cleanupCheckInterval is the interval of checking whether the nodes have been cleaned up.
+const cleanupCheckInterval = 10 * time.Second
+
 // CertInjectionReconciler reconciles a CertInjection object
 type CertInjectionReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=certinjections,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=certinjections/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=certinjections/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -63,55 +85,84 @@ func (r *CertInjectionReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	if !certInjection.GetObjectMeta().GetDeletionTimestamp().IsZero() {
 		logger.Info("object is being deleted")
+
+		if !controllerutil.ContainsFinalizer(certInjection, mytypes.CleanupFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		done, err := r.cleanup(ctx, certInjection)
+		if err != nil || !done {
+			// Release the finalizer with the files left when the cleanup is stuck, e.g. the nodes are unreachable.
+			if timeout := config.Get().CleanupTimeout; timeout > 0 &&
+				time.Since(certInjection.GetDeletionTimestamp().Time) > timeout {
+				r.Recorder.Eventf(certInjection, corev1.EventTypeWarning, mytypes.EventReasonCleanupSkipped,
+					"Injected files may be left on the nodes as the cleanup is not completed in %s", timeout)
+			} else if err != nil {
+				logger.Error(err, "clean up nodes error")
+				return ctrl.Result{}, err
+			} else {
+				logger.Info("Waiting for the nodes to be cleaned up")
+				return ctrl.Result{RequeueAfter: cleanupCheckInterval}, nil
+			}
+		}
+
+		controllerutil.RemoveFinalizer(certInjection, mytypes.CleanupFinalizer)
+		if err := r.Update(ctx, certInjection); err != nil {
+			logger.Error(err, "remove finalizer error")
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Nodes have been cleaned up")
 		return ctrl.Result{}, nil
 	}
 
-	// Check whether the secret containing the CA content has been ready.
-	caSecret := &corev1.Secret{}
-	if err := r.Get(ctx, types.NamespacedName{
-		Namespace: req.Namespace,
-		Name:      certInjection.Spec.CertSecret.Name,
-	}, caSecret); err != nil {
-		logger.Error(err, "get CA cert secret error")
-		return ctrl.Result{}, err
+	// Make sure the injected files are cleaned up when the object is deleted.
+	if !controllerutil.ContainsFinalizer(certInjection, mytypes.CleanupFinalizer) {
+		controllerutil.AddFinalizer(certInjection, mytypes.CleanupFinalizer)
+		if err := r.Update(ctx, certInjection); err != nil {
+			logger.Error(err, "add finalizer error")
+			return ctrl.Result{}, err
+		}
 	}
 
-	// Check the existence of the underlying daemon set.
-	dsList := &appv1.DaemonSetList{}
-	if err := r.List(ctx, dsList, client.InNamespace(req.Namespace), client.MatchingLabels{
-		mytypes.OwnerGVKLabel:  controller.FormatGVKToLabelValue(certInjection.GetObjectKind().GroupVersionKind()),
-		mytypes.OwnerNameLabel: certInjection.GetName(),
-	}); err != nil {
-		logger.Error(err, "list the underlying ds resources")
-		return ctrl.Result{}, err
+	// Check whether the secrets containing the CA content have been ready.
+	registries := certInjection.Spec.EffectiveRegistries()
+	caSecrets := make(map[string]*corev1.Secret, len(registries))
+	for _, registry := range registries {
+		caSecret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{
+			Namespace: req.Namespace,
+			Name:      registry.CertSecret.Name,
+		}, caSecret); err != nil {
+			logger.Error(err, "get CA cert secret error", "secret", registry.CertSecret.Name)
+			return ctrl.Result{}, err
+		}
+
+		caSecrets[caSecret.Name] = caSecret
 	}
 
 	// Add defer to update the status
+	oldStatus := certInjection.Status.DeepCopy()
 	defer func() {
-		st := corev1.ConditionTrue
-		if e != nil {
-			st = corev1.ConditionFalse
+		ready := v1alpha1.CertInjectionCondition{
+			Type:   mytypes.ConditionReady,
+			Status: corev1.ConditionTrue,
 		}
 
-		found, updated := false, false
-		for _, c := range certInjection.Status.Conditions {
-			if c.Type == mytypes.ConditionReady {
-				found = true
-				if c.Status != st {
-					c.Status = st
-					updated = true
-				}
-			}
+		if e != nil {
+			ready.Status = corev1.ConditionFalse
+			ready.Reason = "ReconcileError"
+			ready.Message = e.Error()
+		} else if !certInjection.Status.IsConditionTrue(mytypes.ConditionNodesInjected) {
+			// Image pulls will only succeed cluster-wide when all the nodes are injected.
+			ready.Status = corev1.ConditionFalse
+			ready.Reason = "NodesNotInjected"
+			ready.Message = "CA cert has not been injected into all the nodes"
 		}
 
-		if !found {
-			certInjection.Status.Conditions = append(certInjection.Status.Conditions, v1alpha1.CertInjectionCondition{
-				Type:   mytypes.ConditionReady,
-				Status: st,
-			})
-		}
+		certInjection.Status.SetCondition(ready)
 
-		if !found || updated {
+		if !equality.Semantic.DeepEqual(oldStatus, &certInjection.Status) {
 			if err := r.Status().Update(ctx, certInjection); err != nil {
 				logger.Error(err, "update status error")
 				return
@@ -119,48 +170,279 @@ func (r *CertInjectionReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 	}()
 
-	ijp := injector.NewDaemonSetProvider(r.Client, r.Scheme)
-	if len(dsList.Items) == 0 {
-		logger.Info("Underlying ds not found and create new")
+	// Record the CA certs and check their expiry.
+	recheckAfter, err := r.inspectCerts(certInjection, registries, caSecrets)
+	if err != nil {
+		logger.Error(err, "inspect CA cert error")
+		return ctrl.Result{}, err
+	}
 
-		// Not found then create.
-		if err := ijp.Inject(ctx, certInjection); err != nil {
-			logger.Error(err, "inject CA cert error")
-			return ctrl.Result{}, err
+	// Check the CA presented by the registry against the CA injected, e.g. the source secret may be stale.
+	if config.Get().ProbeRegistryTLS {
+		r.probeRegistry(ctx, certInjection, caSecrets)
+
+		if interval := config.Get().TLSProbeInterval; recheckAfter <= 0 || interval < recheckAfter {
+			recheckAfter = interval
 		}
-	} else {
-		ds := &dsList.Items[0]
-		oldInjectionV := ds.GetAnnotations()[mytypes.InjectionVersionAnnotationKey]
-		newInjectionV := certInjection.GetResourceVersion()
+	}
 
-		// If update is needed.
-		if oldInjectionV != newInjectionV {
-			logger.Info("Cert injection resource version changes found", "old", oldInjectionV, "new", newInjectionV)
+	strategy := injector.StrategyOf(certInjection)
+	ijp, err := r.injectorProvider(strategy)
+	if err != nil {
+		logger.Error(err, "get injector provider error")
+		return ctrl.Result{}, err
+	}
 
-			updatedDs := ijp.DesiredInjector(certInjection)
-			ds.Spec = *updatedDs.Spec.DeepCopy()
-			ds.Annotations[mytypes.InjectionVersionAnnotationKey] = newInjectionV
+	// Release the injectors of the previous strategy when the strategy is switched.
+	if applied := appliedStrategy(certInjection); applied != strategy {
+		previous, err := r.injectorProvider(applied)
+		if err != nil {
+			logger.Error(err, "get injector provider error")
+			return ctrl.Result{}, err
+		}
 
-			if err := r.Update(ctx, ds); err != nil {
-				logger.Error(err, "update the underlying ds")
-				return ctrl.Result{}, err
-			}
+		if err := previous.Release(ctx, certInjection); err != nil {
+			logger.Error(err, "release injectors error", "strategy", applied)
+			return ctrl.Result{}, err
 		}
+
+		logger.Info("Injection strategy is switched", "from", applied, "to", strategy)
+	}
+
+	certInjection.Status.Strategy = strategy
+
+	// Create or update the underlying injectors.
+	if err := ijp.Inject(ctx, certInjection); err != nil {
+		logger.Error(err, "inject CA cert error")
+		r.Recorder.Eventf(certInjection, corev1.EventTypeWarning, mytypes.EventReasonInjectFailed, "Failed to inject the CA: %s", err)
+		return ctrl.Result{}, err
+	}
+
+	// Observe the injection results on the nodes.
+	if err := ijp.Observe(ctx, certInjection); err != nil {
+		logger.Error(err, "observe injection error")
+		return ctrl.Result{}, err
 	}
 
 	logger.Info("Reconcile loop completed")
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: recheckAfter}, nil
+}
+
+// inspectCerts records the CA certs in the status and sets the CertExpiringSoon condition.
+// A warning event is emitted when the certs start expiring soon or expired.
+// It returns the duration after which the expiry should be checked again.
+func (r *CertInjectionReconciler) inspectCerts(certInjection *v1alpha1.CertInjection, registries []v1alpha1.Registry,
+	caSecrets map[string]*corev1.Secret) (time.Duration, error) {
+	certs, err := inspector.Inspect(registries, caSecrets)
+	if err != nil {
+		return 0, err
+	}
+
+	certInjection.Status.Certificates = certs
+	certInjection.Status.NotAfter = nil
+	if earliest := inspector.EarliestExpiry(certs); earliest != nil {
+		certInjection.Status.NotAfter = earliest.NotAfter.DeepCopy()
+	}
+
+	condition, recheckAfter := inspector.ExpiryCondition(certs, config.Get().ExpiryWarningWindow, time.Now())
+	if certInjection.Status.SetCondition(condition) && condition.Status == corev1.ConditionTrue {
+		r.Recorder.Event(certInjection, corev1.EventTypeWarning, mytypes.ConditionCertExpiringSoon, condition.Message)
+	}
+
+	return recheckAfter, nil
+}
+
+// probeRegistry dials the registry over TLS and sets the CAMismatch condition by comparing the CA presented with
+// the CA injected for it. A warning event is emitted when the CA starts mismatching.
+func (r *CertInjectionReconciler) probeRegistry(ctx context.Context, certInjection *v1alpha1.CertInjection,
+	caSecrets map[string]*corev1.Secret) {
+	address := certInjection.Spec.ExternalDNS
+	secretName := certInjection.Spec.CertSecret.Name
+
+	condition := v1alpha1.CertInjectionCondition{
+		Type:   mytypes.ConditionCAMismatch,
+		Status: corev1.ConditionUnknown,
+	}
+
+	trusted, err := certutil.ParseCertificates(caSecrets[secretName].Data[mytypes.CAKeyInSecret])
+	if err != nil {
+		condition.Reason = "InvalidCA"
+		condition.Message = err.Error()
+		certInjection.Status.SetCondition(condition)
+
+		return
+	}
+
+	presented, err := probe.CA(ctx, address)
+	switch {
+	case err != nil:
+		condition.Reason = "ProbeFailed"
+		condition.Message = err.Error()
+	case !probe.Matches(presented, trusted):
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "CAMismatch"
+		condition.Message = fmt.Sprintf("registry %s presents CA %q (SHA-256 %s) not matching the CA in secret %s",
+			address, presented.Subject.String(), certutil.FingerprintSHA256(presented), secretName)
+	default:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "CAMatched"
+		condition.Message = fmt.Sprintf("registry %s presents CA %q matching the CA in secret %s",
+			address, presented.Subject.String(), secretName)
+	}
+
+	if certInjection.Status.SetCondition(condition) && condition.Status == corev1.ConditionTrue {
+		r.Recorder.Event(certInjection, corev1.EventTypeWarning, mytypes.EventReasonCAMismatch, condition.Message)
+	}
+}
+
+// cleanup removes the injected files from the nodes by the strategy which has injected them.
+// The cleanup is skipped when the injection is annotated by mytypes.SkipCleanupAnnotationKey.
+func (r *CertInjectionReconciler) cleanup(ctx context.Context, certInjection *v1alpha1.CertInjection) (bool, error) {
+	if certInjection.GetAnnotations()[mytypes.SkipCleanupAnnotationKey] == "true" {
+		r.Recorder.Event(certInjection, corev1.EventTypeWarning, mytypes.EventReasonCleanupSkipped,
+			"Injected files are left on the nodes as the cleanup is skipped by the annotation")
+		return true, nil
+	}
+
+	// An unknown strategy never injects anything, e.g. a typo accepted before the validation, then the files
+	// possibly injected by the default strategy are removed.
+	strategy := appliedStrategy(certInjection)
+	if injector.Get(strategy, r.providerOptions()) == nil {
+		log.FromContext(ctx).Info("Clean up by the default strategy as the applied strategy is unknown", "strategy", strategy)
+		strategy = config.Get().Injector
+	}
+
+	ijp, err := r.injectorProvider(strategy)
+	if err != nil {
+		return false, err
+	}
+
+	return ijp.Cleanup(ctx, certInjection)
+}
+
+// injectorProvider returns the provider of the injection strategy.
+func (r *CertInjectionReconciler) injectorProvider(strategy string) (injector.Provider, error) {
+	ijp := injector.Get(strategy, r.providerOptions())
+	if ijp == nil {
+		return nil, errs.Errorf("unknown injection strategy %q, supported: %v", strategy, injector.Strategies())
+	}
+
+	return ijp, nil
+}
+
+func (r *CertInjectionReconciler) providerOptions() *injector.Options {
+	return &injector.Options{
+		Client:    r.Client,
+		Scheme:    r.Scheme,
+		Recorder:  r.Recorder,
+		Namespace: config.Get().OperatorNamespace,
+	}
+}
+
+// appliedStrategy returns the strategy the injection has been injected by.
+// The injections created before the strategy is recorded are injected by the current strategy.
+func appliedStrategy(certInjection *v1alpha1.CertInjection) string {
+	if certInjection.Status.Strategy != "" {
+		return certInjection.Status.Strategy
+	}
+
+	return injector.StrategyOf(certInjection)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CertInjectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Client = mgr.GetClient()
 	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-controller")
+
+	if err := metrics.RegisterInjectionCollector(r.Client); err != nil {
+		return err
+	}
+
+	if _, err := r.injectorProvider(config.Get().Injector); err != nil {
+		return errs.Wrap("invalid injector", err)
+	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.CertInjection{}).
-		Owns(&appv1.DaemonSet{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &corev1.Node{}},
+			handler.EnqueueRequestsFromMapFunc(r.injectionsOnNodes),
+			controller.WithRuntimeChangedPredicates())
+
+	// Watch the objects of all the strategies, the injection may switch to any of them.
+	owned := make(map[reflect.Type]bool)
+	for _, strategy := range injector.Strategies() {
+		ijp, err := r.injectorProvider(strategy)
+		if err != nil {
+			return err
+		}
+
+		for _, w := range ijp.Watches() {
+			if w.Owned {
+				if t := reflect.TypeOf(w.Type); !owned[t] {
+					owned[t] = true
+					b = b.Owns(w.Type)
+				}
+
+				continue
+			}
+
+			// The objects not owned by any injection are observed by all the injections of the strategy.
+			b = b.Watches(&source.Kind{Type: w.Type},
+				handler.EnqueueRequestsFromMapFunc(r.injectionsOfStrategy(strategy)),
+				controller.WithLabelsPredicates(w.Labels))
+		}
+	}
+
+	return b.Complete(r)
+}
+
+// injectionsOfStrategy maps the changes of the objects shared by the injections to all the injections of the strategy.
+func (r *CertInjectionReconciler) injectionsOfStrategy(strategy string) handler.MapFunc {
+	return func(_ client.Object) []reconcile.Request {
+		ciList := &v1alpha1.CertInjectionList{}
+		if err := r.List(context.Background(), ciList); err != nil {
+			log.Log.Error(err, "unable to list cert injections for shared object changes", "strategy", strategy)
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range ciList.Items {
+			if injector.StrategyOf(&ciList.Items[i]) == strategy {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: client.ObjectKeyFromObject(&ciList.Items[i]),
+				})
+			}
+		}
+
+		return requests
+	}
+}
+
+// injectionsOnNodes maps the node changes to the injections whose injectors depend on the nodes.
+func (r *CertInjectionReconciler) injectionsOnNodes(_ client.Object) []reconcile.Request {
+	ciList := &v1alpha1.CertInjectionList{}
+	if err := r.List(context.Background(), ciList); err != nil {
+		log.Log.Error(err, "unable to list cert injections for node changes")
+		return nil
+	}
+
+	opts := r.providerOptions()
+
+	var requests []reconcile.Request
+	for i := range ciList.Items {
+		ijp := injector.Get(injector.StrategyOf(&ciList.Items[i]), opts)
+		if ijp != nil && ijp.DependsOnNodes(&ciList.Items[i]) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: ciList.Items[i].Namespace,
+					Name:      ciList.Items[i].Name,
+				},
+			})
+		}
+	}
+
+	return requests
 }
 
 func init() {
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/injection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// CertInjectionForCertificateReconciler reconciles a cert-manager Certificate object
+type CertInjectionForCertificateReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert-manager.io,resources=issuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert-manager.io,resources=clusterissuers,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *CertInjectionForCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.WithValues("certificate", req.NamespacedName)
+
+	// Init the common reconciler.
+	reconciler := injection.NewBuilder().
+		UseClient(r.Client).
+		WithLogger(logger).
+		WithScheme(r.Scheme).
+		WithRecorder(r.Recorder).
+		Reconciler()
+
+	// Do reconcile.
+	if err := reconciler.Reconcile(ctx, req.NamespacedName, func() client.Object {
+		return &certmanagerv1.Certificate{}
+	}); err != nil {
+		// A certificate without DNS names or a resolvable CA is skipped until it's updated.
+		if !errs.IsTLSNotEnabledError(err) && !errs.IsMissingDataError(err) {
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Skip reconcile", "cause", err)
+	}
+
+	logger.Info("Reconcile loop completed")
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// The controller is not set up if cert-manager is not installed.
+func (r *CertInjectionForCertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk := certmanagerv1.SchemeGroupVersion.WithKind(mytypes.Certificate)
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			ctrl.Log.Info("Skip setting up the controller as cert-manager is not installed", "gvk", gvk)
+			return nil
+		}
+
+		return errs.Wrap("failed to get the REST mapping of the cert-manager certificates", err)
+	}
+
+	r.Client = mgr.GetClient()
+	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-for-certificate-controller")
+
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.Certificate)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certmanagerv1.Certificate{}, controller.WithOptInPredicates(selector)).
+		Owns(&v1alpha1.CertInjection{}).
+		// Extract the CA again when the certificate secret is issued or the CA of the issuer is rotated.
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, gvk, selector, func() client.Object {
+				return &certmanagerv1.Certificate{}
+			}))).
+		Complete(r)
+}
+
+func init() {
+	controller.AddToControllerList(&CertInjectionForCertificateReconciler{})
+}
@@ -22,21 +22,29 @@ import (
 	goharborv1beta1 "github.com/goharbor/harbor-operator/apis/goharbor.io/v1beta1"
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/injection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // CertInjectionForClusterReconciler reconciles a CertInjectionForCluster object
 type CertInjectionForClusterReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=goharbor.io,resources=harborclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -52,6 +60,7 @@ func (r *CertInjectionForClusterReconciler) Reconcile(ctx context.Context, req c
 		UseClient(r.Client).
 		WithLogger(logger).
 		WithScheme(r.Scheme).
+		WithRecorder(r.Recorder).
 		Reconciler()
 
 	logger.Info("Start reconcile loop")
@@ -76,11 +85,35 @@ func (r *CertInjectionForClusterReconciler) Reconcile(ctx context.Context, req c
 func (r *CertInjectionForClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Client = mgr.GetClient()
 	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-for-cluster-controller")
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&goharborv1beta1.HarborCluster{}, controller.WithExpectedLabelPredicates()).
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.HarborCluster)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&goharborv1beta1.HarborCluster{}, controller.WithOptInPredicates(selector)).
 		Owns(&v1alpha1.CertInjection{}).
-		Complete(r)
+		// Extract the CA again when the secrets read from the source are rotated.
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, goharborv1beta1.GroupVersion.WithKind(mytypes.HarborCluster), selector, func() client.Object {
+				return &goharborv1beta1.HarborCluster{}
+			})))
+
+	if selector.WatchesNamespaces() {
+		// Pick up the sources under the namespaces labeled later.
+		b = b.Watches(&source.Kind{Type: &corev1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesInNamespace(r.Client, selector, func() client.ObjectList {
+				return &goharborv1beta1.HarborClusterList{}
+			})))
+	}
+
+	return b.Complete(r)
 }
 
 func init() {
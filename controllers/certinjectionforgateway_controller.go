@@ -0,0 +1,248 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/gateway"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/injection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// CertInjectionForGatewayReconciler reconciles a Gateway object of the Gateway API
+type CertInjectionForGatewayReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	gvk schema.GroupVersionKind
+}
+
+// CertInjectionForHTTPRouteReconciler reconciles an HTTPRoute object of the Gateway API
+type CertInjectionForHTTPRouteReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	gvk      schema.GroupVersionKind
+	selector *controller.OptInSelector
+}
+
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *CertInjectionForGatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.WithValues("gateway", req.NamespacedName)
+
+	return reconcileUnstructured(ctx, r.Client, r.Scheme, r.Recorder, logger, req, r.gvk)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// The controller is not set up if the Gateway API is not installed.
+func (r *CertInjectionForGatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk, ok, err := gatewayAPIKind(mgr, mytypes.Gateway)
+	if err != nil || !ok {
+		return err
+	}
+
+	r.Client = mgr.GetClient()
+	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-for-gateway-controller")
+	r.gvk = gvk
+
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.Gateway)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("gateway").
+		For(newUnstructured(gvk), controller.WithOptInPredicates(selector)).
+		Owns(&v1alpha1.CertInjection{}).
+		// Extract the CA again when the certificate secrets of the listeners are rotated.
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, gvk, selector, func() client.Object {
+				return newUnstructured(gvk)
+			}))).
+		Complete(r)
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *CertInjectionForHTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.WithValues("http route", req.NamespacedName)
+
+	return reconcileUnstructured(ctx, r.Client, r.Scheme, r.Recorder, logger, req, r.gvk)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// The controller is not set up if the Gateway API is not installed.
+func (r *CertInjectionForHTTPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk, ok, err := gatewayAPIKind(mgr, mytypes.HTTPRoute)
+	if err != nil || !ok {
+		return err
+	}
+
+	r.Client = mgr.GetClient()
+	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-for-httproute-controller")
+	r.gvk = gvk
+
+	r.selector, err = controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.HTTPRoute)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("httproute").
+		For(newUnstructured(gvk), controller.WithOptInPredicates(r.selector)).
+		Owns(&v1alpha1.CertInjection{}).
+		// Extract the CA again when the certificate secrets of the parent gateways are rotated.
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, gvk, r.selector, func() client.Object {
+				return newUnstructured(gvk)
+			}))).
+		// The listeners of the parent gateways decide the CA of the routes.
+		Watches(&source.Kind{Type: newUnstructured(gvk.GroupVersion().WithKind(mytypes.Gateway))},
+			handler.EnqueueRequestsFromMapFunc(r.routesOfGateway)).
+		Complete(r)
+}
+
+// routesOfGateway maps the gateway changes to the opted-in routes attached to the gateway.
+func (r *CertInjectionForHTTPRouteReconciler) routesOfGateway(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(mytypes.HTTPRoute + "List"))
+	if err := r.List(ctx, routes); err != nil {
+		log.Log.Error(err, "unable to list http routes for gateway changes", "gateway", client.ObjectKeyFromObject(obj))
+		return nil
+	}
+
+	gw := client.ObjectKeyFromObject(obj)
+
+	var requests []reconcile.Request
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		if !r.selector.Selects(ctx, route) {
+			continue
+		}
+
+		for _, key := range gateway.ParentGateways(route) {
+			if key == gw {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(route)})
+				break
+			}
+		}
+	}
+
+	return requests
+}
+
+// reconcileUnstructured reconciles the unstructured source object of the GVK by the common reconciler.
+func reconcileUnstructured(ctx context.Context, c client.Client, scheme *runtime.Scheme, recorder record.EventRecorder,
+	logger logr.Logger, req ctrl.Request, gvk schema.GroupVersionKind) (ctrl.Result, error) {
+	// Init the common reconciler.
+	reconciler := injection.NewBuilder().
+		UseClient(c).
+		WithLogger(logger).
+		WithScheme(scheme).
+		WithRecorder(recorder).
+		Reconciler()
+
+	// Do reconcile.
+	if err := reconciler.Reconcile(ctx, req.NamespacedName, func() client.Object {
+		return newUnstructured(gvk)
+	}); err != nil {
+		// An object without TLS hosts is skipped until it's updated.
+		if !errs.IsTLSNotEnabledError(err) && !errs.IsMissingDataError(err) {
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Skip reconcile", "cause", err)
+	}
+
+	logger.Info("Reconcile loop completed")
+	return ctrl.Result{}, nil
+}
+
+// gatewayAPIKind returns the GVK of the kind in the preferred version of the Gateway API served.
+// False is returned if the Gateway API is not installed.
+func gatewayAPIKind(mgr ctrl.Manager, kind string) (schema.GroupVersionKind, bool, error) {
+	gk := schema.GroupKind{Group: mytypes.GatewayAPIGroup, Kind: kind}
+
+	mapping, err := mgr.GetRESTMapper().RESTMapping(gk, gateway.Versions...)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			ctrl.Log.Info("Skip setting up the controller as the Gateway API is not installed", "kind", gk)
+			return schema.GroupVersionKind{}, false, nil
+		}
+
+		return schema.GroupVersionKind{}, false, errs.Wrap("failed to get the REST mapping of the Gateway API", err)
+	}
+
+	return mapping.GroupVersionKind, true, nil
+}
+
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+
+	return obj
+}
+
+func init() {
+	controller.AddToControllerList(&CertInjectionForGatewayReconciler{})
+	controller.AddToControllerList(&CertInjectionForHTTPRouteReconciler{})
+}
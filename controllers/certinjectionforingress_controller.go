@@ -0,0 +1,110 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/injection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// CertInjectionForIngressReconciler reconciles an Ingress object
+type CertInjectionForIngressReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *CertInjectionForIngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.WithValues("ingress", req.NamespacedName)
+
+	// Init the common reconciler.
+	reconciler := injection.NewBuilder().
+		UseClient(r.Client).
+		WithLogger(logger).
+		WithScheme(r.Scheme).
+		WithRecorder(r.Recorder).
+		Reconciler()
+
+	// Do reconcile.
+	if err := reconciler.Reconcile(ctx, req.NamespacedName, func() client.Object {
+		return &networkingv1.Ingress{}
+	}); err != nil {
+		// An ingress without TLS hosts is skipped until it's updated.
+		if !errs.IsTLSNotEnabledError(err) && !errs.IsMissingDataError(err) {
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Skip reconcile", "cause", err)
+	}
+
+	logger.Info("Reconcile loop completed")
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CertInjectionForIngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Client = mgr.GetClient()
+	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-for-ingress-controller")
+
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.Ingress)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&networkingv1.Ingress{}, controller.WithOptInPredicates(selector)).
+		Owns(&v1alpha1.CertInjection{}).
+		// Extract the CA again when the TLS secrets are rotated.
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, networkingv1.SchemeGroupVersion.WithKind(mytypes.Ingress), selector, func() client.Object {
+				return &networkingv1.Ingress{}
+			}))).
+		Complete(r)
+}
+
+func init() {
+	controller.AddToControllerList(&CertInjectionForIngressReconciler{})
+}
@@ -19,22 +19,29 @@ package controllers
 import (
 	"context"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/injection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 	packagev1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
 )
 
 // CertInjectionForPackageReconciler reconciles a kapp PackageInstall object
 type CertInjectionForPackageReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=packaging.carvel.dev,resources=packageinstalls,verbs=get;list;watch
@@ -53,6 +60,7 @@ func (r *CertInjectionForPackageReconciler) Reconcile(ctx context.Context, req c
 		UseClient(r.Client).
 		WithLogger(logger).
 		WithScheme(r.Scheme).
+		WithRecorder(r.Recorder).
 		Reconciler()
 
 	// Do reconcile.
@@ -74,11 +82,35 @@ func (r *CertInjectionForPackageReconciler) Reconcile(ctx context.Context, req c
 func (r *CertInjectionForPackageReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Client = mgr.GetClient()
 	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-for-package-controller")
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&packagev1alpha1.PackageInstall{}, controller.WithExpectedLabelPredicates()).
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.PackageInstall)
+	if err != nil {
+		return err
+	}
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&packagev1alpha1.PackageInstall{}, controller.WithOptInPredicates(selector)).
 		Owns(&v1alpha1.CertInjection{}).
-		Complete(r)
+		// Extract the CA again when the secrets read from the source are rotated.
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, packagev1alpha1.SchemeGroupVersion.WithKind(mytypes.PackageInstall), selector, func() client.Object {
+				return &packagev1alpha1.PackageInstall{}
+			})))
+
+	if selector.WatchesNamespaces() {
+		// Pick up the sources under the namespaces labeled later.
+		b = b.Watches(&source.Kind{Type: &corev1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(controller.SourcesInNamespace(r.Client, selector, func() client.ObjectList {
+				return &packagev1alpha1.PackageInstallList{}
+			})))
+	}
+
+	return b.Complete(r)
 }
 
 func init() {
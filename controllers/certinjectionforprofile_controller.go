@@ -0,0 +1,104 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+// CertInjectionForProfileReconciler reconciles the custom resources of the kind targeted by a CertSourceProfile.
+// It's not registered to the controller list, but started and stopped at runtime by the CertSourceProfileReconciler.
+type CertInjectionForProfileReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	gvk schema.GroupVersionKind
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *CertInjectionForProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.WithValues("kind", r.gvk.Kind, "source", req.NamespacedName)
+
+	return reconcileUnstructured(ctx, r.Client, r.Scheme, r.Recorder, logger, req, r.gvk)
+}
+
+// newProfileSourceController creates the unmanaged controller of the kind, which is started by the caller.
+// The custom resources opted in are watched as the built-in sources.
+func newProfileSourceController(mgr ctrl.Manager, name string, gvk schema.GroupVersionKind) (ctrlcontroller.Controller, error) {
+	r := &CertInjectionForProfileReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cert-injection-for-profile-controller"),
+		gvk:      gvk,
+	}
+
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), gvk.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ctrlcontroller.NewUnmanaged(name, mgr, ctrlcontroller.Options{
+		Reconciler: r,
+	})
+	if err != nil {
+		return nil, errs.Wrap("failed to create the controller of the profile", err)
+	}
+
+	if err := c.Watch(&source.Kind{Type: newUnstructured(gvk)}, &handler.EnqueueRequestForObject{},
+		controller.OptInPredicate(selector)); err != nil {
+		return nil, errs.Wrap("failed to watch the custom resources", err)
+	}
+
+	if err := c.Watch(&source.Kind{Type: &v1alpha1.CertInjection{}}, &handler.EnqueueRequestForOwner{
+		OwnerType:    newUnstructured(gvk),
+		IsController: true,
+	}); err != nil {
+		return nil, errs.Wrap("failed to watch the cert injections", err)
+	}
+
+	// Extract the CA again when the CA secrets are rotated.
+	if err := c.Watch(&source.Kind{Type: &corev1.Secret{}},
+		handler.EnqueueRequestsFromMapFunc(controller.SourcesOfSecret(r.Client, gvk, selector, func() client.Object {
+			return newUnstructured(gvk)
+		}))); err != nil {
+		return nil, errs.Wrap("failed to watch the secrets", err)
+	}
+
+	return c, nil
+}
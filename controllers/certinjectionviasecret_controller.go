@@ -21,10 +21,13 @@ import (
 
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/injection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -33,7 +36,8 @@ import (
 // CertInjectionViaSecretReconciler reconciles a CertInjectionViaSecret object
 type CertInjectionViaSecretReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
@@ -54,13 +58,15 @@ func (r *CertInjectionViaSecretReconciler) Reconcile(ctx context.Context, req ct
 		UseClient(r.Client).
 		WithLogger(logger).
 		WithScheme(r.Scheme).
+		WithRecorder(r.Recorder).
 		Reconciler()
 
 	// Do reconcile.
 	if err := reconciler.Reconcile(ctx, req.NamespacedName, func() client.Object {
 		return &corev1.Secret{}
 	}); err != nil {
-		if !errs.IsTLSNotEnabledError(err) {
+		// A secret missing the required data is skipped until it's updated.
+		if !errs.IsTLSNotEnabledError(err) && !errs.IsMissingDataError(err) {
 			return ctrl.Result{}, err
 		}
 
@@ -75,9 +81,15 @@ func (r *CertInjectionViaSecretReconciler) Reconcile(ctx context.Context, req ct
 func (r *CertInjectionViaSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Client = mgr.GetClient()
 	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-injection-via-secret-controller")
+
+	selector, err := controller.NewOptInSelector(config.Get(), mgr.GetClient(), mytypes.Secret)
+	if err != nil {
+		return err
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Secret{}, controller.WithExpectedLabelPredicates()).
+		For(&corev1.Secret{}, controller.WithOptInPredicates(selector)).
 		Owns(&v1alpha1.CertInjection{}).
 		Complete(r)
 }
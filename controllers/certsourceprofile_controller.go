@@ -0,0 +1,509 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/profile"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// profileRecheckInterval is the interval of checking again the profiles whose target kind is not served yet
+// or not accessible by the operator.
+const profileRecheckInterval = time.Minute
+
+// CertSourceProfileReconciler reconciles the CertSourceProfile objects.
+// A controller of the custom resources targeted by each profile is started at runtime,
+// and stopped when the profile is deleted or targets another kind.
+type CertSourceProfileReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	mgr    ctrl.Manager
+	failed chan event.GenericEvent
+
+	lock    sync.Mutex
+	watches map[string]*profileWatch
+}
+
+// profileWatch is the controller started for a profile.
+type profileWatch struct {
+	gvk  schema.GroupVersionKind
+	stop chan struct{}
+	err  error
+}
+
+//+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=certsourceprofiles,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=certsourceprofiles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=certsourceprofiles/finalizers,verbs=update
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *CertSourceProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger = logger.WithValues("cert source profile", req.Name)
+
+	logger.Info("Start reconcile loop")
+
+	p := &v1alpha1.CertSourceProfile{}
+	if err := r.Get(ctx, req.NamespacedName, p); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.stopWatch(req.Name)
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, errs.Wrap("unable to fetch cert source profile", err)
+	}
+
+	if !p.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(p, mytypes.ProfileCleanupFinalizer) {
+			r.stopWatch(p.Name)
+			return ctrl.Result{}, nil
+		}
+
+		if err := r.release(ctx, p); err != nil {
+			logger.Error(err, "release the target kind error")
+			return ctrl.Result{}, err
+		}
+
+		controllerutil.RemoveFinalizer(p, mytypes.ProfileCleanupFinalizer)
+		if err := r.Update(ctx, p); err != nil {
+			logger.Error(err, "remove finalizer error")
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Profile has been released")
+		return ctrl.Result{}, nil
+	}
+
+	// Make sure the cert injections of the target kind are removed when the profile is deleted.
+	if !controllerutil.ContainsFinalizer(p, mytypes.ProfileCleanupFinalizer) {
+		controllerutil.AddFinalizer(p, mytypes.ProfileCleanupFinalizer)
+		if err := r.Update(ctx, p); err != nil {
+			logger.Error(err, "add finalizer error")
+			return ctrl.Result{}, err
+		}
+	}
+
+	oldStatus := p.Status.DeepCopy()
+
+	ready, recheck, err := r.serve(ctx, p)
+	if err != nil {
+		logger.Error(err, "serve the profile error")
+		return ctrl.Result{}, err
+	}
+
+	if p.Status.SetCondition(ready) && ready.Status != corev1.ConditionTrue {
+		r.Recorder.Event(p, corev1.EventTypeWarning, mytypes.EventReasonProfileNotReady, ready.Message)
+	}
+
+	p.Status.ObservedGeneration = p.Generation
+	if !equality.Semantic.DeepEqual(oldStatus, &p.Status) {
+		if err := r.Status().Update(ctx, p); err != nil {
+			logger.Error(err, "update status error")
+			return ctrl.Result{}, err
+		}
+	}
+
+	logger.Info("Reconcile loop completed")
+
+	if recheck {
+		return ctrl.Result{RequeueAfter: profileRecheckInterval}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// serve starts watching the kind targeted by the profile and registers the profile for extracting.
+// It returns the ready condition of the profile, and whether the profile should be checked again later.
+func (r *CertSourceProfileReconciler) serve(ctx context.Context, p *v1alpha1.CertSourceProfile) (v1alpha1.CertInjectionCondition, bool, error) {
+	gvk := p.Spec.Target.GroupVersionKind()
+	notReady := func(reason string, message string) v1alpha1.CertInjectionCondition {
+		r.stopWatch(p.Name)
+		profile.Unregister(gvk.String(), p.Name)
+
+		return v1alpha1.CertInjectionCondition{
+			Type:    mytypes.ConditionReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  reason,
+			Message: message,
+		}
+	}
+
+	if err := validateProfile(p); err != nil {
+		return notReady("InvalidProfile", err.Error()), false, nil
+	}
+
+	if extractor.IsBuiltIn(gvk.String()) {
+		return notReady("BuiltInKind", fmt.Sprintf("%s is served by the built-in source", gvk)), false, nil
+	}
+
+	mapping, err := r.mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return notReady("KindNotFound", fmt.Sprintf("%s is not served by the API server", gvk)), true, nil
+		}
+
+		return v1alpha1.CertInjectionCondition{}, false, errs.Wrap("failed to get the REST mapping of the target kind", err)
+	}
+
+	// The cert injections are created in the namespaces of the sources.
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return notReady("ClusterScoped", fmt.Sprintf("%s is not namespaced", gvk)), false, nil
+	}
+
+	serving, err := r.servingProfile(ctx, gvk)
+	if err != nil {
+		return v1alpha1.CertInjectionCondition{}, false, err
+	}
+
+	if serving != nil && serving.Name != p.Name {
+		return notReady("Conflict", fmt.Sprintf("%s is targeted by profile %s created earlier", gvk, serving.Name)), false, nil
+	}
+
+	denied, err := r.accessDenied(ctx, mapping.Resource)
+	if err != nil {
+		return v1alpha1.CertInjectionCondition{}, false, err
+	}
+
+	if denied != "" {
+		return notReady("Forbidden", denied), true, nil
+	}
+
+	if err := r.watchError(p.Name); err != nil {
+		// It's started again when checking later.
+		return notReady("WatchFailed", err.Error()), true, nil
+	}
+
+	// The cert injections of the kind targeted before are removed.
+	if old := p.Status.Target; old != nil && old.GroupVersionKind() != gvk {
+		r.stopWatch(p.Name)
+		if err := r.releaseTarget(ctx, p.Name, old.GroupVersionKind()); err != nil {
+			return v1alpha1.CertInjectionCondition{}, false, err
+		}
+	}
+
+	profile.Register(p)
+	if err := r.startWatch(p.Name, gvk); err != nil {
+		return v1alpha1.CertInjectionCondition{}, false, err
+	}
+
+	p.Status.Target = p.Spec.Target.DeepCopy()
+
+	return v1alpha1.CertInjectionCondition{
+		Type:    mytypes.ConditionReady,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Watching",
+		Message: fmt.Sprintf("Watching %s", gvk),
+	}, false, nil
+}
+
+// release stops watching the kind targeted by the profile and removes the cert injections of it.
+func (r *CertSourceProfileReconciler) release(ctx context.Context, p *v1alpha1.CertSourceProfile) error {
+	r.stopWatch(p.Name)
+
+	if p.Status.Target == nil {
+		return nil
+	}
+
+	return r.releaseTarget(ctx, p.Name, p.Status.Target.GroupVersionKind())
+}
+
+// releaseTarget removes the cert injections of the kind, unless it's taken over by another profile.
+// The injected files are removed from the nodes by the cert injections being deleted.
+func (r *CertSourceProfileReconciler) releaseTarget(ctx context.Context, name string, gvk schema.GroupVersionKind) error {
+	profile.Unregister(gvk.String(), name)
+
+	serving, err := r.servingProfile(ctx, gvk)
+	if err != nil {
+		return err
+	}
+
+	if serving != nil && serving.Name != name {
+		return nil
+	}
+
+	ciList := &v1alpha1.CertInjectionList{}
+	if err := r.List(ctx, ciList, client.MatchingLabels{
+		mytypes.OwnerGVKLabel: controller.FormatGVKToLabelValue(gvk),
+	}); err != nil {
+		return errs.Wrap("failed to list cert injections of the target kind", err)
+	}
+
+	for i := range ciList.Items {
+		if err := r.Delete(ctx, &ciList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return errs.Wrap("failed to delete cert injection of the target kind", err)
+		}
+	}
+
+	return nil
+}
+
+// servingProfile returns the profile serving the kind, which is the earliest created one targeting it.
+// Nil is returned if no profile targets the kind.
+func (r *CertSourceProfileReconciler) servingProfile(ctx context.Context, gvk schema.GroupVersionKind) (*v1alpha1.CertSourceProfile, error) {
+	profiles := &v1alpha1.CertSourceProfileList{}
+	if err := r.List(ctx, profiles); err != nil {
+		return nil, errs.Wrap("unable to list cert source profiles", err)
+	}
+
+	var candidates []v1alpha1.CertSourceProfile
+	for _, p := range profiles.Items {
+		if p.DeletionTimestamp.IsZero() && p.Spec.Target.GroupVersionKind() == gvk {
+			candidates = append(candidates, p)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ti, tj := candidates[i].CreationTimestamp, candidates[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	return &candidates[0], nil
+}
+
+// accessDenied checks whether the operator can list and watch the resource in all the namespaces.
+// The message of the denial is returned, empty if it's allowed.
+func (r *CertSourceProfileReconciler) accessDenied(ctx context.Context, resource schema.GroupVersionResource) (string, error) {
+	for _, verb := range []string{"list", "watch"} {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Group:    resource.Group,
+					Resource: resource.Resource,
+					Verb:     verb,
+				},
+			},
+		}
+
+		if err := r.Create(ctx, review); err != nil {
+			return "", errs.Wrap("failed to review the access to the target kind", err)
+		}
+
+		if !review.Status.Allowed {
+			return fmt.Sprintf("the operator is not allowed to %s %s", verb, resource.GroupResource()), nil
+		}
+	}
+
+	return "", nil
+}
+
+// startWatch starts the controller of the kind for the profile, the one of another kind is stopped.
+func (r *CertSourceProfileReconciler) startWatch(name string, gvk schema.GroupVersionKind) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if w, ok := r.watches[name]; ok {
+		if w.gvk == gvk {
+			return nil
+		}
+
+		close(w.stop)
+		delete(r.watches, name)
+	}
+
+	c, err := newProfileSourceController(r.mgr, "certsourceprofile-"+name, gvk)
+	if err != nil {
+		return err
+	}
+
+	w := &profileWatch{
+		gvk:  gvk,
+		stop: make(chan struct{}),
+	}
+
+	// The controller is run by the manager, so it's stopped with the manager as well.
+	// The informer of the kind is left in the cache after the controller is stopped,
+	// as removing informers is not supported by the cache.
+	if err := r.mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-w.stop:
+				cancel()
+			case <-watchCtx.Done():
+			}
+		}()
+
+		if err := c.Start(watchCtx); err != nil && watchCtx.Err() == nil {
+			log.FromContext(ctx).Error(err, "watch the target kind error", "cert source profile", name, "kind", gvk)
+			r.watchFailed(ctx, name, w, err)
+		}
+
+		// The error is not returned as it stops the manager.
+		return nil
+	})); err != nil {
+		return errs.Wrap("failed to start the controller of the profile", err)
+	}
+
+	r.watches[name] = w
+
+	return nil
+}
+
+// stopWatch stops the controller started for the profile.
+func (r *CertSourceProfileReconciler) stopWatch(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if w, ok := r.watches[name]; ok {
+		close(w.stop)
+		delete(r.watches, name)
+	}
+}
+
+// watchError returns the error of the controller started for the profile.
+func (r *CertSourceProfileReconciler) watchError(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if w, ok := r.watches[name]; ok {
+		return w.err
+	}
+
+	return nil
+}
+
+// watchFailed records the error of the controller and triggers the reconciling of the profile.
+func (r *CertSourceProfileReconciler) watchFailed(ctx context.Context, name string, w *profileWatch, err error) {
+	r.lock.Lock()
+	if r.watches[name] == w {
+		w.err = err
+	}
+	r.lock.Unlock()
+
+	p := &v1alpha1.CertSourceProfile{}
+	p.SetName(name)
+
+	select {
+	case r.failed <- event.GenericEvent{Object: p}:
+	case <-ctx.Done():
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CertSourceProfileReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Client = mgr.GetClient()
+	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cert-source-profile-controller")
+	r.mgr = mgr
+	r.failed = make(chan event.GenericEvent)
+	r.watches = make(map[string]*profileWatch)
+
+	if err := controller.IndexSourceSecrets(context.Background(), mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.CertSourceProfile{}).
+		// The profiles in conflict are checked again when any profile is changed or deleted.
+		Watches(&source.Kind{Type: &v1alpha1.CertSourceProfile{}},
+			handler.EnqueueRequestsFromMapFunc(r.otherProfiles)).
+		Watches(&source.Channel{Source: r.failed}, &handler.EnqueueRequestForObject{}).
+		Complete(r)
+}
+
+// otherProfiles maps the changes of the profile to the other profiles.
+func (r *CertSourceProfileReconciler) otherProfiles(obj client.Object) []reconcile.Request {
+	profiles := &v1alpha1.CertSourceProfileList{}
+	if err := r.List(context.Background(), profiles); err != nil {
+		log.Log.Error(err, "unable to list cert source profiles for profile changes")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range profiles.Items {
+		if profiles.Items[i].Name == obj.GetName() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&profiles.Items[i])})
+	}
+
+	return requests
+}
+
+// validateProfile checks the JSONPath of the profile.
+func validateProfile(p *v1alpha1.CertSourceProfile) error {
+	paths := []struct {
+		field string
+		path  string
+	}{
+		{"hostPath", p.Spec.HostPath},
+		{"aliasesPath", p.Spec.AliasesPath},
+		{"caSecretNamePath", p.Spec.CASecretNamePath},
+		{"caSecretNamespacePath", p.Spec.CASecretNamespacePath},
+	}
+
+	for _, fp := range paths {
+		if fp.path == "" {
+			continue
+		}
+
+		if _, err := profile.Parse(fp.path); err != nil {
+			return errs.Wrap(fmt.Sprintf("invalid %s", fp.field), err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	controller.AddToControllerList(&CertSourceProfileReconciler{})
+}
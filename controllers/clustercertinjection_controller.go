@@ -0,0 +1,362 @@
+/*
+Copyright 2022 szou.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/clusterinjection"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ClusterCertInjectionReconciler reconciles the ClusterCertInjection objects.
+// All of them are served by one CertInjection in the operator namespace, so each reconciling handles all of them.
+type ClusterCertInjectionReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=clustercertinjections,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=day2-operations.goharbor.io,resources=clustercertinjections/status,verbs=get;update;patch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
+func (r *ClusterCertInjectionReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Start reconcile loop")
+
+	cciList := &v1alpha1.ClusterCertInjectionList{}
+	if err := r.List(ctx, cciList); err != nil {
+		return ctrl.Result{}, errs.Wrap("unable to list cluster cert injections", err)
+	}
+
+	namespace := config.Get().OperatorNamespace
+	bundle := clusterinjection.NewBundle(ctx, r.Client, cciList.Items)
+
+	if err := r.syncSecrets(ctx, namespace, bundle); err != nil {
+		logger.Error(err, "sync CA secrets error")
+		return ctrl.Result{}, err
+	}
+
+	certInjection, err := r.syncInjection(ctx, namespace, bundle)
+	if err != nil {
+		logger.Error(err, "sync cert injection error")
+		return ctrl.Result{}, err
+	}
+
+	// The copied secrets not used any more are removed after the cert injection is updated.
+	if err := r.removeStaleSecrets(ctx, namespace, bundle); err != nil {
+		logger.Error(err, "remove stale CA secrets error")
+		return ctrl.Result{}, err
+	}
+
+	for i := range cciList.Items {
+		cci := &cciList.Items[i]
+		if !cci.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		if err := r.updateStatus(ctx, cci, certInjection, bundle); err != nil {
+			logger.Error(err, "update status error", "cluster cert injection", cci.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	logger.Info("Reconcile loop completed")
+	return ctrl.Result{}, nil
+}
+
+// syncSecrets creates or updates the copies of the CA secrets in the operator namespace.
+func (r *ClusterCertInjectionReconciler) syncSecrets(ctx context.Context, namespace string, bundle *clusterinjection.Bundle) error {
+	for name, ca := range bundle.Secrets {
+		s := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, s)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errs.Wrap("failed to get CA secret", err)
+		}
+
+		if apierrors.IsNotFound(err) {
+			s = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: namespace,
+					Name:      name,
+					Labels:    clusterInjectionLabels(),
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{
+					mytypes.CAKeyInSecret: ca,
+				},
+			}
+
+			if err := r.Create(ctx, s); err != nil {
+				return errs.Wrap("failed to create CA secret", err)
+			}
+
+			continue
+		}
+
+		if equality.Semantic.DeepEqual(s.Data[mytypes.CAKeyInSecret], ca) {
+			continue
+		}
+
+		s.Data = map[string][]byte{
+			mytypes.CAKeyInSecret: ca,
+		}
+		if err := r.Update(ctx, s); err != nil {
+			return errs.Wrap("failed to update CA secret", err)
+		}
+	}
+
+	return nil
+}
+
+// removeStaleSecrets removes the copies of the CA secrets not in the bundle.
+func (r *ClusterCertInjectionReconciler) removeStaleSecrets(ctx context.Context, namespace string, bundle *clusterinjection.Bundle) error {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(namespace), client.MatchingLabels(clusterInjectionLabels())); err != nil {
+		return errs.Wrap("failed to list CA secrets", err)
+	}
+
+	for i := range secrets.Items {
+		if _, ok := bundle.Secrets[secrets.Items[i].Name]; ok {
+			continue
+		}
+
+		if err := r.Delete(ctx, &secrets.Items[i]); client.IgnoreNotFound(err) != nil {
+			return errs.Wrap("failed to delete stale CA secret", err)
+		}
+	}
+
+	return nil
+}
+
+// syncInjection creates, updates or deletes the cert injection serving the bundle.
+// The nodes are cleaned up by the cert injection when it's deleted.
+func (r *ClusterCertInjectionReconciler) syncInjection(ctx context.Context, namespace string,
+	bundle *clusterinjection.Bundle) (*v1alpha1.CertInjection, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: clusterinjection.InjectionName}
+
+	certInjection := &v1alpha1.CertInjection{}
+	err := r.Get(ctx, key, certInjection)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errs.Wrap("failed to get cert injection", err)
+	}
+
+	exists := err == nil
+	spec := bundle.Spec(v1alpha1.InjectionMode(config.Get().ClusterInjectionMode))
+
+	if spec == nil {
+		if exists && certInjection.DeletionTimestamp.IsZero() {
+			if err := r.Delete(ctx, certInjection); client.IgnoreNotFound(err) != nil {
+				return nil, errs.Wrap("failed to delete cert injection", err)
+			}
+		}
+
+		return nil, nil
+	}
+
+	if !exists {
+		certInjection = &v1alpha1.CertInjection{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      clusterinjection.InjectionName,
+				Labels:    clusterInjectionLabels(),
+			},
+			Spec: *spec,
+		}
+
+		if err := r.Create(ctx, certInjection); err != nil {
+			return nil, errs.Wrap("failed to create cert injection", err)
+		}
+
+		return certInjection, nil
+	}
+
+	// Wait for the deletion completed to create it again.
+	if !certInjection.DeletionTimestamp.IsZero() {
+		return nil, errs.New("cert injection is being deleted")
+	}
+
+	if equality.Semantic.DeepEqual(certInjection.Spec, *spec) {
+		return certInjection, nil
+	}
+
+	certInjection.Spec = *spec
+	if err := r.Update(ctx, certInjection); err != nil {
+		return nil, errs.Wrap("failed to update cert injection", err)
+	}
+
+	return certInjection, nil
+}
+
+// updateStatus reflects the status of the cert injection serving the bundle into the cluster cert injection.
+func (r *ClusterCertInjectionReconciler) updateStatus(ctx context.Context, cci *v1alpha1.ClusterCertInjection,
+	certInjection *v1alpha1.CertInjection, bundle *clusterinjection.Bundle) error {
+	oldStatus := cci.Status.DeepCopy()
+
+	ready := v1alpha1.CertInjectionCondition{
+		Type:   mytypes.ConditionReady,
+		Status: corev1.ConditionFalse,
+	}
+
+	cci.Status.Injection = nil
+	cci.Status.DesiredNodes, cci.Status.InjectedNodes, cci.Status.FailedNodes = 0, 0, 0
+	cci.Status.NotAfter = nil
+
+	switch err := bundle.Errors[cci.Name]; {
+	case err != nil:
+		ready.Reason = "InvalidRegistry"
+		ready.Message = err.Error()
+	case certInjection == nil:
+		ready.Reason = "InjectionNotReady"
+		ready.Message = "Cert injection has not been created"
+	default:
+		ref, err := reference.GetReference(r.Scheme, certInjection)
+		if err != nil {
+			return errs.Wrap("failed to get cert injection reference", err)
+		}
+
+		cci.Status.Injection = ref
+		cci.Status.DesiredNodes = certInjection.Status.DesiredNodes
+		cci.Status.InjectedNodes = certInjection.Status.InjectedNodes
+		cci.Status.FailedNodes = certInjection.Status.FailedNodes
+		cci.Status.NotAfter = earliestExpiry(certInjection.Status.Certificates, bundle.Members[cci.Name])
+
+		if c := certInjection.Status.GetCondition(mytypes.ConditionReady); c != nil {
+			ready.Status, ready.Reason, ready.Message = c.Status, c.Reason, c.Message
+		} else {
+			ready.Reason = "InjectionNotReady"
+			ready.Message = "Cert injection has not been reconciled"
+		}
+	}
+
+	if cci.Status.SetCondition(ready) && ready.Reason == "InvalidRegistry" {
+		r.Recorder.Event(cci, corev1.EventTypeWarning, mytypes.EventReasonInjectFailed, ready.Message)
+	}
+
+	if equality.Semantic.DeepEqual(oldStatus, &cci.Status) {
+		return nil
+	}
+
+	return r.Status().Update(ctx, cci)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterCertInjectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Client = mgr.GetClient()
+	r.Scheme = mgr.GetScheme()
+	r.Recorder = mgr.GetEventRecorderFor("cluster-cert-injection-controller")
+
+	switch mode := v1alpha1.InjectionMode(config.Get().ClusterInjectionMode); mode {
+	case v1alpha1.DockerCertsDirMode, v1alpha1.ContainerdHostsMode:
+	default:
+		return errs.Errorf("invalid cluster injection mode %q", mode)
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.ClusterCertInjection{}).
+		Watches(&source.Kind{Type: &v1alpha1.CertInjection{}},
+			handler.EnqueueRequestsFromMapFunc(r.clusterInjection),
+			controller.WithLabelsPredicates(clusterInjectionLabels())).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.referencingSecret)).
+		Complete(r)
+}
+
+// clusterInjection maps the changes of the cert injection serving the cluster cert injections to a reconciling.
+func (r *ClusterCertInjectionReconciler) clusterInjection(_ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: clusterinjection.InjectionName}}}
+}
+
+// referencingSecret maps the changes of the secrets referenced by any cluster cert injection to a reconciling.
+func (r *ClusterCertInjectionReconciler) referencingSecret(obj client.Object) []reconcile.Request {
+	cciList := &v1alpha1.ClusterCertInjectionList{}
+	if err := r.List(context.Background(), cciList); err != nil {
+		log.Log.Error(err, "unable to list cluster cert injections for secret changes")
+		return nil
+	}
+
+	for i := range cciList.Items {
+		if clusterinjection.References(&cciList.Items[i], client.ObjectKeyFromObject(obj)) {
+			return r.clusterInjection(obj)
+		}
+	}
+
+	return nil
+}
+
+// earliestExpiry returns the earliest expiry of the certificates in the secrets.
+func earliestExpiry(certs []v1alpha1.CertificateInfo, secrets []string) *metav1.Time {
+	var earliest *metav1.Time
+	for i := range certs {
+		if !contains(secrets, certs[i].Secret) {
+			continue
+		}
+
+		if earliest == nil || certs[i].NotAfter.Before(earliest) {
+			earliest = certs[i].NotAfter.DeepCopy()
+		}
+	}
+
+	return earliest
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clusterInjectionLabels are the labels of the objects created for the cluster cert injections.
+func clusterInjectionLabels() map[string]string {
+	return map[string]string{
+		mytypes.OwnerGVKLabel:  controller.FormatGVKToLabelValue(v1alpha1.GroupVersion.WithKind(mytypes.ClusterCertInjection)),
+		mytypes.OwnerNameLabel: clusterinjection.InjectionName,
+	}
+}
+
+func init() {
+	controller.AddToControllerList(&ClusterCertInjectionReconciler{})
+}
@@ -21,7 +21,9 @@ import (
 	"os"
 
 	goharborv1beta1 "github.com/goharbor/harbor-operator/apis/goharbor.io/v1beta1"
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
 	packagev1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
 
@@ -50,6 +52,7 @@ func init() {
 		clientgoscheme.AddToScheme,
 		goharborv1beta1.AddToScheme,
 		packagev1alpha1.AddToScheme,
+		certmanagerv1.AddToScheme,
 		v1alpha1.AddToScheme,
 	)
 
@@ -68,6 +71,7 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	config.BindFlags(flag.CommandLine)
 	opts := zap.Options{
 		Development: true,
 	}
@@ -92,6 +96,13 @@ func main() {
 		fatal(err, "unable to set up controllers")
 	}
 
+	// The webhooks can be disabled when running the manager locally without the serving certs.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&v1alpha1.CertInjection{}).SetupWebhookWithManager(mgr); err != nil {
+			fatal(err, "unable to set up webhooks", "webhook", "CertInjection")
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		fatal(err, "unable to set up health check")
 	}
@@ -0,0 +1,456 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+const (
+	caFileName = "ca.crt"
+	// legacyCAFileName is the name of the CA file written by the early versions of the injector,
+	// which is replaced by the caFileName.
+	legacyCAFileName = "ca-cert"
+
+	cleanupRetryInterval = 10 * time.Second
+	shutdownTimeout      = 5 * time.Second
+)
+
+// Agent keeps the CA cert of the registry in the certs directory of the container runtime on the node.
+type Agent struct {
+	opts *Options
+	log  logr.Logger
+	// ready is set to 1 when the files on the node are aligned with the CA cert.
+	ready int32
+}
+
+// New an agent.
+func New(opts *Options, log logr.Logger) *Agent {
+	return &Agent{
+		opts: opts,
+		log:  log,
+	}
+}
+
+// Run the agent until the context is done.
+// The files are synced when the mounted CA cert is changed and re-synced periodically,
+// then the files removed or modified on the node are recovered.
+// With the Once option, the files are synced or cleaned up once and the error is returned.
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.opts.Validate(); err != nil {
+		return errs.Wrap("invalid options", err)
+	}
+
+	// Run as a job, the result is reported by the exit code.
+	if a.opts.Once {
+		if a.opts.Cleanup {
+			return a.cleanup()
+		}
+
+		return a.sync()
+	}
+
+	srv := a.probeServer()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			a.log.Error(err, "probe server stopped")
+		}
+	}()
+
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if a.opts.Cleanup {
+		return a.runCleanup(ctx)
+	}
+
+	return a.runSync(ctx)
+}
+
+func (a *Agent) runSync(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errs.Wrap("failed to create file watcher", err)
+	}
+	defer func() {
+		_ = watcher.Close()
+	}()
+
+	// The secret volume updates the files by swapping the symbolic link of the directory,
+	// so watch the directories instead of the files.
+	watched := make(map[string]bool)
+	for _, f := range a.watchedFiles() {
+		dir := filepath.Dir(f)
+		if watched[dir] {
+			continue
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			return errs.Wrap("failed to watch the CA file", err)
+		}
+
+		watched[dir] = true
+	}
+
+	ticker := time.NewTicker(a.opts.ResyncInterval)
+	defer ticker.Stop()
+
+	a.trySync()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Events:
+			a.trySync()
+		case err := <-watcher.Errors:
+			a.log.Error(err, "file watcher error")
+		case <-ticker.C:
+			a.trySync()
+		}
+	}
+}
+
+func (a *Agent) runCleanup(ctx context.Context) error {
+	for {
+		if err := a.cleanup(); err != nil {
+			a.log.Error(err, "failed to clean up the injected files")
+		} else {
+			a.log.Info("injected files have been cleaned up")
+			a.setReady(true)
+
+			// Keep running until the cleaner is removed.
+			<-ctx.Done()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cleanupRetryInterval):
+		}
+	}
+}
+
+func (a *Agent) trySync() {
+	if err := a.sync(); err != nil {
+		a.log.Error(err, "failed to sync the injected files")
+		a.setReady(false)
+
+		return
+	}
+
+	a.setReady(true)
+}
+
+// watchedFiles returns the files whose changes trigger the syncing.
+// The CA files are in the same directory as the bundle file.
+func (a *Agent) watchedFiles() []string {
+	if a.opts.Bundle != "" {
+		return []string{a.opts.Bundle}
+	}
+
+	files := make([]string, 0, len(a.opts.Registries))
+	for _, r := range a.opts.Registries {
+		files = append(files, r.CAFile)
+	}
+
+	return files
+}
+
+// targets returns the certs directories and the registries to inject,
+// which are read from the bundle file if it's set.
+func (a *Agent) targets() ([]Target, error) {
+	if a.opts.Bundle == "" {
+		return []Target{a.opts.target()}, nil
+	}
+
+	b, err := loadBundle(a.opts.Bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Targets, nil
+}
+
+// sync writes the CA certs and the hosts.toml of the registries, and removes the stale files.
+func (a *Agent) sync() error {
+	targets, err := a.targets()
+	if err != nil {
+		return err
+	}
+
+	// Read all the CA certs first, then nothing is changed on the node if any of them is invalid.
+	cas := make(map[string][]byte)
+	for _, t := range targets {
+		for _, r := range t.Registries {
+			if _, ok := cas[r.CAFile]; ok || r.Retained {
+				continue
+			}
+
+			ca, err := readFile(r.CAFile)
+			if err != nil {
+				return err
+			}
+
+			if ca == nil {
+				return errs.Errorf("CA file %s does not exist", r.CAFile)
+			}
+
+			// Do not inject anything which is not a certificate.
+			if _, err := certutil.ParseCertificates(ca); err != nil {
+				return errs.Wrap(fmt.Sprintf("invalid CA file %s", r.CAFile), err)
+			}
+
+			cas[r.CAFile] = ca
+		}
+	}
+
+	for i := range targets {
+		if err := a.syncTarget(&targets[i], cas); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncTarget writes the CA certs of the registries into the certs directory, and removes the stale files.
+func (a *Agent) syncTarget(t *Target, cas map[string][]byte) error {
+	st, err := loadState(t.CertsDir, a.opts.ID)
+	if err != nil {
+		return err
+	}
+
+	// The registry hosts have been changed.
+	// The files of the retained hosts are left on the node, and they're no longer recorded in the state.
+	hosts, retained := t.hosts(), t.retainedHosts()
+	for _, h := range st.Hosts {
+		if !contains(hosts, h) && !contains(retained, h) {
+			if err := a.removeHost(t.CertsDir, h, st.HostsTOML); err != nil {
+				return errs.Wrap("failed to remove stale files", err)
+			}
+		}
+	}
+
+	// Nothing has been or will be written.
+	if len(hosts) == 0 && len(st.Hosts) == 0 {
+		return nil
+	}
+
+	for _, r := range t.Registries {
+		if r.Retained {
+			continue
+		}
+
+		for _, h := range r.Hosts {
+			if err := a.syncHost(t, h, cas[r.CAFile], &r, st); err != nil {
+				return err
+			}
+		}
+	}
+
+	return saveState(t.CertsDir, a.opts.ID, &state{
+		Owner:     a.opts.ID,
+		Hosts:     hosts,
+		HostsTOML: t.HostsTOML,
+	})
+}
+
+// syncHost writes the CA cert and the hosts.toml of the registry host.
+func (a *Agent) syncHost(t *Target, host string, ca []byte, r *Registry, st *state) error {
+	dir := filepath.Join(t.CertsDir, host)
+	caPath := filepath.Join(dir, caFileName)
+	hostsPath := filepath.Join(dir, hostsFileName)
+
+	removeTempFiles(dir, caFileName)
+	removeTempFiles(dir, hostsFileName)
+
+	if err := syncFile(caPath, ca); err != nil {
+		return errs.Wrap("failed to sync CA file", err)
+	}
+
+	// Migrate from the legacy CA file once the new one is in place.
+	if err := removeFile(filepath.Join(dir, legacyCAFileName)); err != nil {
+		return errs.Wrap("failed to remove legacy CA file", err)
+	}
+
+	if t.HostsTOML {
+		existing, err := readFile(hostsPath)
+		if err != nil {
+			return err
+		}
+
+		block := hostsBlock(host, caPath, r.Capabilities, r.Mirrors)
+		if err := syncFile(hostsPath, mergeHosts(existing, host, block)); err != nil {
+			return errs.Wrap("failed to sync hosts.toml", err)
+		}
+	} else if st.HostsTOML && st.hasHost(host) {
+		// The hosts.toml is no longer desired.
+		if owned, err := ownedByOthers(t.CertsDir, a.opts.ID, host); err != nil || owned {
+			return err
+		}
+
+		if err := a.removeHostsEntries(hostsPath, host); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanup removes all the files written by the agent of the injection.
+func (a *Agent) cleanup() error {
+	targets, err := a.targets()
+	if err != nil {
+		return err
+	}
+
+	for i := range targets {
+		if err := a.cleanupTarget(&targets[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanupTarget removes the files written by the agent into the certs directory.
+func (a *Agent) cleanupTarget(t *Target) error {
+	st, err := loadState(t.CertsDir, a.opts.ID)
+	if err != nil {
+		return err
+	}
+
+	// The files injected by the early versions are not recorded.
+	hosts := st.Hosts
+	for _, h := range t.hosts() {
+		if !st.hasHost(h) {
+			hosts = append(hosts, h)
+		}
+	}
+
+	for _, h := range hosts {
+		if err := a.removeHost(t.CertsDir, h, st.HostsTOML || t.HostsTOML); err != nil {
+			return err
+		}
+	}
+
+	return removeState(t.CertsDir, a.opts.ID)
+}
+
+// removeHost removes the files of the registry host.
+// The files are kept when the host is injected by other agents as well.
+// The registry directory is only removed when it's empty.
+func (a *Agent) removeHost(certsDir string, host string, hostsTOML bool) error {
+	owned, err := ownedByOthers(certsDir, a.opts.ID, host)
+	if err != nil || owned {
+		return err
+	}
+
+	dir := filepath.Join(certsDir, host)
+
+	for _, name := range []string{caFileName, legacyCAFileName} {
+		if err := removeFile(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	if hostsTOML {
+		if err := a.removeHostsEntries(filepath.Join(dir, hostsFileName), host); err != nil {
+			return err
+		}
+	}
+
+	removeDirIfEmpty(dir)
+
+	return nil
+}
+
+// removeHostsEntries removes the managed entries from the hosts.toml.
+// The file is removed when nothing else than the server field added by the agent is left.
+func (a *Agent) removeHostsEntries(hostsPath string, host string) error {
+	existing, err := readFile(hostsPath)
+	if err != nil || existing == nil {
+		return err
+	}
+
+	left := unmergeHosts(existing, host)
+	if left == nil {
+		return removeFile(hostsPath)
+	}
+
+	return syncFile(hostsPath, left)
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Agent) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+
+	atomic.StoreInt32(&a.ready, v)
+}
+
+func (a *Agent) isReady() bool {
+	return atomic.LoadInt32(&a.ready) == 1
+}
+
+// probeServer serves the health probes.
+// The agent is ready only when the files on the node are aligned with the CA cert.
+func (a *Agent) probeServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !a.isReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return &http.Server{
+		Addr:              a.opts.ProbeAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// writeCA writes a self-signed CA into the directory and returns the path.
+func writeCA(t *testing.T, dir string) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+
+	path := filepath.Join(dir, caFileName)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), filePerm); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	return path
+}
+
+func newTestAgent(id string, certsDir string, caFile string, hosts ...string) *Agent {
+	return New(&Options{
+		ID:             id,
+		CertsDir:       certsDir,
+		HostsTOML:      true,
+		Registries:     []Registry{{Hosts: hosts, CAFile: caFile}},
+		ResyncInterval: time.Minute,
+	}, logr.Discard())
+}
+
+func exists(t *testing.T, path string) bool {
+	t.Helper()
+
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+
+	return err == nil
+}
+
+// TestSharedHost checks the files of a host injected by two agents are kept until both are cleaned up.
+func TestSharedHost(t *testing.T) {
+	const host = "harbor.example.com"
+
+	certsDir := t.TempDir()
+	caFile := writeCA(t, t.TempDir())
+
+	first := newTestAgent("harbor-first", certsDir, caFile, host)
+	second := newTestAgent("harbor-second", certsDir, caFile, host, "alias.example.com")
+
+	for _, a := range []*Agent{first, second} {
+		if err := a.sync(); err != nil {
+			t.Fatalf("sync %s: %v", a.opts.ID, err)
+		}
+	}
+
+	st, err := loadState(certsDir, second.opts.ID)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+
+	if st.Owner != second.opts.ID {
+		t.Fatalf("expected owner %s, got %s", second.opts.ID, st.Owner)
+	}
+
+	caPath := filepath.Join(certsDir, host, caFileName)
+	hostsPath := filepath.Join(certsDir, host, hostsFileName)
+	aliasDir := filepath.Join(certsDir, "alias.example.com")
+
+	if err := second.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	if !exists(t, caPath) || !exists(t, hostsPath) {
+		t.Fatal("expected the files of the shared host to be kept")
+	}
+
+	if exists(t, aliasDir) {
+		t.Fatal("expected the files of the host only injected by the cleaned up agent to be removed")
+	}
+
+	if err := first.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	if exists(t, filepath.Join(certsDir, host)) {
+		t.Fatal("expected the files to be removed with the last agent")
+	}
+
+	if exists(t, filepath.Join(certsDir, stateDirName)) {
+		t.Fatal("expected the states to be removed")
+	}
+}
+
+// TestMigrateLegacyCAFile checks the CA file written by the early versions is replaced by the ca.crt.
+func TestMigrateLegacyCAFile(t *testing.T) {
+	const host = "harbor.example.com"
+
+	certsDir := t.TempDir()
+	caFile := writeCA(t, t.TempDir())
+
+	legacyPath := filepath.Join(certsDir, host, legacyCAFileName)
+	if err := writeFileAtomic(legacyPath, []byte("legacy")); err != nil {
+		t.Fatalf("write legacy CA file: %v", err)
+	}
+
+	a := newTestAgent("harbor", certsDir, caFile, host)
+	if err := a.sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	if exists(t, legacyPath) {
+		t.Fatal("expected the legacy CA file to be removed")
+	}
+
+	if !exists(t, filepath.Join(certsDir, host, caFileName)) {
+		t.Fatal("expected the CA file to be written")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+// Bundle lists the registries injected into all the certs directories of a node.
+// It's rendered by the operator into a secret mounted by the shared injector.
+type Bundle struct {
+	// Targets are all the certs directories the agent manages.
+	// The targets without registries are kept, then the stale files under them are removed.
+	Targets []Target `json:"targets"`
+}
+
+// Target is a certs directory and the registries injected into it.
+type Target struct {
+	// CertsDir is the certs.d directory of the container runtime.
+	CertsDir string `json:"certsDir"`
+	// HostsTOML indicates whether to generate the containerd hosts.toml.
+	HostsTOML bool `json:"hostsToml,omitempty"`
+	// Registries injected into the directory.
+	// The CA files are relative to the directory of the bundle file.
+	Registries []Registry `json:"registries,omitempty"`
+}
+
+// hosts returns the hosts of all the registries managed by the agent.
+func (t *Target) hosts() []string {
+	var hosts []string
+	for _, r := range t.Registries {
+		if !r.Retained {
+			hosts = append(hosts, r.Hosts...)
+		}
+	}
+
+	return hosts
+}
+
+// retainedHosts returns the hosts of the retained registries, whose files are left on the node.
+func (t *Target) retainedHosts() []string {
+	var hosts []string
+	for _, r := range t.Registries {
+		if r.Retained {
+			hosts = append(hosts, r.Hosts...)
+		}
+	}
+
+	return hosts
+}
+
+// loadBundle loads the bundle file and resolves the paths of the CA files.
+func loadBundle(path string) (*Bundle, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, errs.Errorf("bundle file %s does not exist", path)
+	}
+
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, errs.Wrap("failed to unmarshal bundle", err)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range b.Targets {
+		if b.Targets[i].CertsDir == "" {
+			return nil, errs.Errorf("missing certs directory of target %d", i)
+		}
+
+		for j := range b.Targets[i].Registries {
+			r := &b.Targets[i].Registries[j]
+			// The CA file is not needed by the retained registries.
+			if len(r.Hosts) == 0 || (r.CAFile == "" && !r.Retained) {
+				return nil, errs.Errorf("missing hosts or CA file of registry %d in %s", j, b.Targets[i].CertsDir)
+			}
+
+			if r.CAFile != "" && !filepath.IsAbs(r.CAFile) {
+				r.CAFile = filepath.Join(dir, r.CAFile)
+			}
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,162 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+const (
+	dirPerm  os.FileMode = 0755
+	filePerm os.FileMode = 0644
+)
+
+// checksum returns the hex encoded SHA-256 checksum of the data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readFile reads the file, nil is returned if the file does not exist.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errs.Wrap("failed to read file", err)
+	}
+
+	return data, nil
+}
+
+// syncFile writes the data into the file atomically and verifies the checksum of the written file.
+// Nothing is written if the file has already had the same content.
+func syncFile(path string, data []byte) error {
+	current, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	if current != nil && bytes.Equal(current, data) {
+		return nil
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	return verifyFile(path, checksum(data))
+}
+
+// verifyFile checks the checksum of the file.
+func verifyFile(path string, sum string) error {
+	data, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		return errs.Errorf("file %s does not exist", path)
+	}
+
+	if got := checksum(data); got != sum {
+		return errs.Errorf("checksum mismatch of file %s: expected %s but got %s", path, sum, got)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes the data into a temp file and then renames it to the path,
+// then the readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return errs.Wrap("failed to create directory", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return errs.Wrap("failed to create temp file", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errs.Wrap("failed to write temp file", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errs.Wrap("failed to sync temp file", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errs.Wrap("failed to close temp file", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return errs.Wrap("failed to change mode of temp file", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errs.Wrap("failed to rename temp file", err)
+	}
+
+	return nil
+}
+
+// removeFile removes the file, it's ok if the file does not exist.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errs.Wrap("failed to remove file", err)
+	}
+
+	return nil
+}
+
+// removeDirIfEmpty removes the directory only when it's empty.
+func removeDirIfEmpty(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) > 0 {
+		return
+	}
+
+	_ = os.Remove(dir)
+}
+
+// removeTempFiles removes the temp files left by the interrupted writes in the directory.
+func removeTempFiles(dir string, base string) {
+	matches, err := filepath.Glob(filepath.Join(dir, "."+base+".tmp-*"))
+	if err != nil {
+		return
+	}
+
+	for _, m := range matches {
+		_ = os.Remove(m)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Check details of the hosts.toml here: https://github.com/containerd/containerd/blob/main/docs/hosts.md
+	hostsFileName = "hosts.toml"
+	// The entries generated by the agent are wrapped by the markers,
+	// then they can be replaced without touching the other content of an existing hosts.toml.
+	hostsBlockBegin = "# BEGIN harbor-cert-injector"
+	hostsBlockEnd   = "# END harbor-cert-injector"
+	// The ca field set by the agent in an existing host table ends with the marker,
+	// and the ca field it replaces is commented out with the prefix, then both can be reverted.
+	hostsLineMarker   = " # harbor-cert-injector"
+	hostsCommentedOut = "# harbor-cert-injector: "
+)
+
+var (
+	defaultCapabilities = []string{"pull", "resolve"}
+	serverLinePattern   = regexp.MustCompile(`^server\s*=`)
+	tableLinePattern    = regexp.MustCompile(`^\s*\[`)
+	caLinePattern       = regexp.MustCompile(`^\s*ca\s*=`)
+)
+
+// hostsBlock renders the hosts.toml entries managed by the agent.
+// The mirrors are tried in order before falling back to the registry itself.
+func hostsBlock(host string, caPath string, capabilities []string, mirrors []string) []string {
+	if len(capabilities) == 0 {
+		capabilities = defaultCapabilities
+	}
+
+	quoted := make([]string, 0, len(capabilities))
+	for _, c := range capabilities {
+		quoted = append(quoted, fmt.Sprintf("%q", c))
+	}
+
+	hosts := append(append([]string{}, mirrors...), host)
+
+	lines := []string{hostsBlockBegin}
+	for _, h := range hosts {
+		lines = append(lines,
+			hostTableLine(h),
+			fmt.Sprintf(`  capabilities = [%s]`, strings.Join(quoted, ", ")),
+			caLine(caPath),
+		)
+	}
+
+	return append(lines, hostsBlockEnd)
+}
+
+// hostTableLine renders the header of the host table.
+func hostTableLine(host string) string {
+	return fmt.Sprintf(`[host."https://%s"]`, host)
+}
+
+// caLine renders the ca field of the host table.
+func caLine(caPath string) string {
+	return fmt.Sprintf(`  ca = "%s"`, caPath)
+}
+
+// serverLine renders the server field of the hosts.toml.
+func serverLine(host string) string {
+	return fmt.Sprintf(`server = "https://%s"`, host)
+}
+
+// mergeHosts merges the managed entries into the existing hosts.toml content.
+// The server field is only added when the existing content does not have one.
+// A host table already in the existing content can't be defined again, so the ca field is set in it instead,
+// and its other fields are kept.
+func mergeHosts(existing []byte, host string, block []string) []byte {
+	lines := trimEmptyTail(removeHostsBlock(existing))
+
+	hasServer := false
+	for _, l := range lines {
+		if serverLinePattern.MatchString(l) {
+			hasServer = true
+			break
+		}
+	}
+
+	var res []string
+	if !hasServer {
+		res = append(res, serverLine(host))
+	}
+
+	// Split the tables of the block, then the ones already existing are merged in place.
+	var tables [][]string
+	for _, l := range block {
+		switch {
+		case l == hostsBlockBegin || l == hostsBlockEnd:
+		case tableLinePattern.MatchString(l):
+			tables = append(tables, []string{l})
+		case len(tables) > 0:
+			tables[len(tables)-1] = append(tables[len(tables)-1], l)
+		}
+	}
+
+	managed := []string{hostsBlockBegin}
+	for _, table := range tables {
+		merged := false
+		for _, l := range table[1:] {
+			if caLinePattern.MatchString(l) {
+				lines, merged = setTableCA(lines, table[0], l)
+				break
+			}
+		}
+
+		if !merged {
+			managed = append(managed, table...)
+		}
+	}
+
+	res = append(res, lines...)
+	if len(managed) > 1 {
+		res = append(res, append(managed, hostsBlockEnd)...)
+	}
+
+	return []byte(strings.Join(res, "\n") + "\n")
+}
+
+// setTableCA sets the ca field in the existing table with the header, the ca field in it is commented out.
+// False is returned if the table does not exist.
+func setTableCA(lines []string, header string, ca string) ([]string, bool) {
+	start := -1
+	for i, l := range lines {
+		if strings.TrimSpace(l) == header {
+			start = i
+			break
+		}
+	}
+
+	if start < 0 {
+		return lines, false
+	}
+
+	res := append([]string{}, lines[:start+1]...)
+	res = append(res, ca+hostsLineMarker)
+
+	inTable := true
+	for _, l := range lines[start+1:] {
+		if tableLinePattern.MatchString(l) {
+			inTable = false
+		}
+
+		if inTable && caLinePattern.MatchString(l) {
+			l = hostsCommentedOut + l
+		}
+
+		res = append(res, l)
+	}
+
+	return res, true
+}
+
+// unmergeHosts removes the managed entries from the existing hosts.toml content.
+// Nil is returned if nothing else than the server field added by the agent is left.
+func unmergeHosts(existing []byte, host string) []byte {
+	lines := trimEmptyTail(removeHostsBlock(existing))
+
+	for _, l := range lines {
+		if l != serverLine(host) && strings.TrimSpace(l) != "" {
+			return []byte(strings.Join(lines, "\n") + "\n")
+		}
+	}
+
+	return nil
+}
+
+// removeHostsBlock splits the content into lines and drops the managed entries.
+// The fields set or commented out by the agent in the existing tables are reverted.
+func removeHostsBlock(content []byte) []string {
+	var lines []string
+	inBlock := false
+	for _, l := range strings.Split(string(content), "\n") {
+		switch {
+		case l == hostsBlockBegin:
+			inBlock = true
+		case l == hostsBlockEnd:
+			inBlock = false
+		case inBlock || strings.HasSuffix(l, hostsLineMarker):
+		case strings.HasPrefix(l, hostsCommentedOut):
+			lines = append(lines, strings.TrimPrefix(l, hostsCommentedOut))
+		default:
+			lines = append(lines, l)
+		}
+	}
+
+	return lines
+}
+
+func trimEmptyTail(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
@@ -0,0 +1,134 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeHosts(t *testing.T) {
+	const (
+		host   = "harbor.example.com"
+		caPath = "/etc/containerd/certs.d/harbor.example.com/ca.crt"
+	)
+
+	block := hostsBlock(host, caPath, nil, nil)
+
+	cases := []struct {
+		name     string
+		existing string
+		want     string
+	}{
+		{
+			name:     "new file",
+			existing: "",
+			want: `server = "https://harbor.example.com"
+# BEGIN harbor-cert-injector
+[host."https://harbor.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "/etc/containerd/certs.d/harbor.example.com/ca.crt"
+# END harbor-cert-injector
+`,
+		},
+		{
+			name: "existing server",
+			existing: `server = "https://registry.example.com"
+`,
+			want: `server = "https://registry.example.com"
+# BEGIN harbor-cert-injector
+[host."https://harbor.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "/etc/containerd/certs.d/harbor.example.com/ca.crt"
+# END harbor-cert-injector
+`,
+		},
+		{
+			name: "existing table",
+			existing: `server = "https://harbor.example.com"
+
+[host."https://harbor.example.com"]
+  capabilities = ["pull"]
+  ca = "/etc/ssl/old.crt"
+  skip_verify = false
+
+[host."https://mirror.example.com"]
+  ca = "/etc/ssl/mirror.crt"
+`,
+			want: `server = "https://harbor.example.com"
+
+[host."https://harbor.example.com"]
+  ca = "/etc/containerd/certs.d/harbor.example.com/ca.crt" # harbor-cert-injector
+  capabilities = ["pull"]
+# harbor-cert-injector:   ca = "/etc/ssl/old.crt"
+  skip_verify = false
+
+[host."https://mirror.example.com"]
+  ca = "/etc/ssl/mirror.crt"
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := string(mergeHosts([]byte(c.existing), host, block))
+			if got != c.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", c.want, got)
+			}
+
+			// Merging again does not change anything.
+			if again := string(mergeHosts([]byte(got), host, block)); again != got {
+				t.Fatalf("expected merging to be idempotent, got:\n%s", again)
+			}
+
+			// The managed entries are reverted.
+			left := unmergeHosts([]byte(got), host)
+			want := strings.TrimRight(c.existing, "\n")
+			if want == "" || want == serverLine(host) {
+				if left != nil {
+					t.Fatalf("expected the file to be removed, got:\n%s", left)
+				}
+
+				return
+			}
+
+			if got := strings.TrimRight(string(left), "\n"); got != want {
+				t.Fatalf("expected the existing content:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestMergeHostsWithMirrors(t *testing.T) {
+	const host = "harbor.example.com"
+
+	existing := `[host."https://mirror.example.com"]
+  capabilities = ["pull"]
+`
+	got := string(mergeHosts([]byte(existing), host, hostsBlock(host, "/ca.crt", nil, []string{"mirror.example.com"})))
+
+	// Each table is only defined once.
+	for _, table := range []string{hostTableLine("mirror.example.com"), hostTableLine(host)} {
+		if n := strings.Count(got, table); n != 1 {
+			t.Fatalf("expected table %s to be defined once, got %d times in:\n%s", table, n, got)
+		}
+	}
+
+	if !strings.Contains(got, `[host."https://mirror.example.com"]
+  ca = "/ca.crt" # harbor-cert-injector
+  capabilities = ["pull"]`) {
+		t.Fatalf("expected the ca to be set in the existing table, got:\n%s", got)
+	}
+}
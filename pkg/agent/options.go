@@ -0,0 +1,221 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+const (
+	defaultResyncInterval = 5 * time.Minute
+	defaultProbeAddr      = ":8081"
+)
+
+// Options of the node agent.
+type Options struct {
+	// ID identifies the injection the agent serves.
+	// It's used to track the files written by the agent.
+	ID string
+	// Registries to inject.
+	Registries []Registry
+	// CertsDir is the certs.d directory of the container runtime.
+	// It's mounted at the same path as on the node.
+	CertsDir string
+	// HostsTOML indicates whether to generate the containerd hosts.toml.
+	HostsTOML bool
+	// Capabilities of the registry host in the hosts.toml.
+	Capabilities []string
+	// Mirrors in the hosts.toml of the hosts of the first registry.
+	Mirrors []string
+	// ResyncInterval is the interval of re-syncing the files.
+	ResyncInterval time.Duration
+	// ProbeAddr is the address the probe endpoints bind to.
+	ProbeAddr string
+	// Cleanup removes the files instead of writing them.
+	Cleanup bool
+	// Once syncs or cleans up the files once and exits, instead of keeping them synced.
+	Once bool
+	// Bundle is the path of the bundle file listing the registries of all the certs directories.
+	// If it's set, the registries and the certs directory set in the other options are ignored.
+	Bundle string
+}
+
+// BindFlags binds the options to the flag set.
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ID, "id", "", "The ID of the injection the agent serves.")
+	fs.Var(newRegistriesValue(&o.Registries), "registry",
+		"The registry in the host[,host...]=ca-file form, where the hosts are in the host[:port] form. Can be repeated.")
+	fs.StringVar(&o.CertsDir, "certs-dir", "", "The certs.d directory of the container runtime.")
+	fs.BoolVar(&o.HostsTOML, "hosts-toml", false, "Generate the containerd hosts.toml of the registry.")
+	fs.Var(newListValue(&o.Capabilities), "capabilities", "The comma separated capabilities of the registry host in the hosts.toml.")
+	fs.Var(newListValue(&o.Mirrors), "mirrors", "The comma separated mirrors in the hosts.toml of the hosts of the first registry.")
+	fs.DurationVar(&o.ResyncInterval, "resync-interval", defaultResyncInterval, "The interval of re-syncing the injected files.")
+	fs.StringVar(&o.ProbeAddr, "health-probe-bind-address", defaultProbeAddr, "The address the probe endpoint binds to.")
+	fs.BoolVar(&o.Cleanup, "cleanup", false, "Remove the injected files from the node instead of injecting them.")
+	fs.BoolVar(&o.Once, "once", false, "Sync or clean up the files once and exit with the result.")
+	fs.StringVar(&o.Bundle, "bundle", "",
+		"The bundle file listing the registries of all the certs directories, the CA files are relative to its directory.")
+}
+
+// Validate the options.
+func (o *Options) Validate() error {
+	if o.ID == "" {
+		return errs.New("missing injection ID")
+	}
+
+	if o.ResyncInterval <= 0 {
+		return errs.Errorf("invalid resync interval %s", o.ResyncInterval)
+	}
+
+	// The registries are read from the bundle file.
+	if o.Bundle != "" {
+		return nil
+	}
+
+	if o.CertsDir == "" {
+		return errs.New("missing certs directory")
+	}
+
+	if len(o.Registries) == 0 && !o.Cleanup {
+		return errs.New("missing registry")
+	}
+
+	for _, r := range o.Registries {
+		if len(r.Hosts) == 0 {
+			return errs.New("missing registry host")
+		}
+
+		// The CA is not needed when cleaning up.
+		if r.CAFile == "" && !o.Cleanup {
+			return errs.Errorf("missing CA file of registry %s", strings.Join(r.Hosts, ","))
+		}
+	}
+
+	return nil
+}
+
+// Registry to inject.
+type Registry struct {
+	// Hosts of the registry in the host[:port] form.
+	Hosts []string `json:"hosts"`
+	// CAFile is the path of the CA bundle mounted from the secret.
+	CAFile string `json:"caFile,omitempty"`
+	// Capabilities of the registry hosts in the hosts.toml.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Mirrors in the hosts.toml of the registry hosts.
+	Mirrors []string `json:"mirrors,omitempty"`
+	// Retained indicates the files of the registry hosts are no longer managed by the agent but left on the node,
+	// e.g. the injection has switched to another injector taking them over. Only set in the bundle.
+	Retained bool `json:"retained,omitempty"`
+}
+
+// target returns the certs directory and the registries set in the options.
+// The capabilities apply to all the registries and the mirrors only to the first one.
+func (o *Options) target() Target {
+	registries := make([]Registry, 0, len(o.Registries))
+	for i, r := range o.Registries {
+		r.Capabilities = o.Capabilities
+		if i == 0 {
+			r.Mirrors = o.Mirrors
+		}
+
+		registries = append(registries, r)
+	}
+
+	return Target{
+		CertsDir:   o.CertsDir,
+		HostsTOML:  o.HostsTOML,
+		Registries: registries,
+	}
+}
+
+// registriesValue is a repeatable flag.Value of registries in the host[,host...]=ca-file form.
+type registriesValue struct {
+	registries *[]Registry
+}
+
+func newRegistriesValue(registries *[]Registry) *registriesValue {
+	return &registriesValue{registries: registries}
+}
+
+// String implements flag.Value.
+func (rv *registriesValue) String() string {
+	if rv.registries == nil {
+		return ""
+	}
+
+	items := make([]string, 0, len(*rv.registries))
+	for _, r := range *rv.registries {
+		items = append(items, fmt.Sprintf("%s=%s", strings.Join(r.Hosts, ","), r.CAFile))
+	}
+
+	return strings.Join(items, " ")
+}
+
+// Set implements flag.Value.
+func (rv *registriesValue) Set(v string) error {
+	hosts, caFile := v, ""
+	if i := strings.LastIndex(v, "="); i >= 0 {
+		hosts, caFile = v[:i], v[i+1:]
+	}
+
+	r := Registry{CAFile: strings.TrimSpace(caFile)}
+	if err := newListValue(&r.Hosts).Set(hosts); err != nil {
+		return err
+	}
+
+	if len(r.Hosts) == 0 {
+		return errs.Errorf("no host in registry %q", v)
+	}
+
+	*rv.registries = append(*rv.registries, r)
+
+	return nil
+}
+
+// listValue is a flag.Value of comma separated list.
+type listValue struct {
+	list *[]string
+}
+
+func newListValue(list *[]string) *listValue {
+	return &listValue{list: list}
+}
+
+// String implements flag.Value.
+func (lv *listValue) String() string {
+	if lv.list == nil {
+		return ""
+	}
+
+	return strings.Join(*lv.list, ",")
+}
+
+// Set implements flag.Value.
+func (lv *listValue) Set(v string) error {
+	*lv.list = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*lv.list = append(*lv.list, item)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+// stateDirName is the directory under the certs directory keeping the states of the agents.
+// It starts with a dot, then the container runtimes never take it as a registry.
+const stateDirName = ".harbor-cert-injector"
+
+// state records the files written by the agent of an injection,
+// then they can be removed when they're no longer desired.
+// The injections sharing a host keep its files until none of their states has it.
+type state struct {
+	// Owner is the ID of the agent.
+	Owner string `json:"owner,omitempty"`
+	// Hosts of the registry whose files have been written.
+	Hosts []string `json:"hosts"`
+	// HostsTOML indicates whether the hosts.toml has been written.
+	HostsTOML bool `json:"hostsToml"`
+}
+
+func (s *state) hasHost(host string) bool {
+	return contains(s.Hosts, host)
+}
+
+func statePath(certsDir string, id string) string {
+	return filepath.Join(certsDir, stateDirName, fmt.Sprintf("%s.json", id))
+}
+
+// loadState loads the state of the injection. Empty state is returned if it does not exist.
+func loadState(certsDir string, id string) (*state, error) {
+	data, err := readFile(statePath(certsDir, id))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &state{}
+	if data == nil {
+		return s, nil
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, errs.Wrap("failed to unmarshal state", err)
+	}
+
+	return s, nil
+}
+
+// saveState saves the state of the injection.
+func saveState(certsDir string, id string, s *state) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errs.Wrap("failed to marshal state", err)
+	}
+
+	return syncFile(statePath(certsDir, id), data)
+}
+
+// ownedByOthers checks whether the host is recorded in the states of the other agents.
+func ownedByOthers(certsDir string, id string, host string) (bool, error) {
+	paths, err := filepath.Glob(filepath.Join(certsDir, stateDirName, "*.json"))
+	if err != nil {
+		return false, errs.Wrap("failed to list states", err)
+	}
+
+	for _, p := range paths {
+		if p == statePath(certsDir, id) {
+			continue
+		}
+
+		s, err := loadState(certsDir, strings.TrimSuffix(filepath.Base(p), ".json"))
+		if err != nil {
+			return false, err
+		}
+
+		if s.hasHost(host) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// removeState removes the state of the injection.
+func removeState(certsDir string, id string) error {
+	if err := removeFile(statePath(certsDir, id)); err != nil {
+		return err
+	}
+
+	removeDirIfEmpty(filepath.Join(certsDir, stateDirName))
+
+	return nil
+}
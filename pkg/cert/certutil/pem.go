@@ -0,0 +1,140 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+const (
+	pemTypeCertificate = "CERTIFICATE"
+)
+
+// ParseCertificates parses all the PEM encoded certificates in the data.
+// Non-certificate PEM blocks are skipped.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != pemTypeCertificate {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errs.Wrap("failed to parse certificate", err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errs.New("no PEM encoded certificate found")
+	}
+
+	return certs, nil
+}
+
+// EncodeCertificates encodes the certificates into PEM format.
+func EncodeCertificates(certs ...*x509.Certificate) []byte {
+	buf := &bytes.Buffer{}
+	for _, c := range certs {
+		// Writing to a bytes.Buffer never fails.
+		_ = pem.Encode(buf, &pem.Block{
+			Type:  pemTypeCertificate,
+			Bytes: c.Raw,
+		})
+	}
+
+	return buf.Bytes()
+}
+
+// CAFromChain picks the certificate that should be trusted from a certificate chain.
+// The chain is expected in the TLS order: leaf first and then the issuers.
+// The self-signed root is preferred, otherwise the topmost CA certificate of the chain is picked.
+// A single self-signed certificate is trusted as it is.
+func CAFromChain(chain []*x509.Certificate) (*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errs.New("empty certificate chain")
+	}
+
+	var topmost *x509.Certificate
+	for _, c := range chain {
+		if IsSelfSigned(c) {
+			return c, nil
+		}
+
+		if c.IsCA {
+			topmost = c
+		}
+	}
+
+	if topmost == nil {
+		return nil, errs.New("no CA certificate found in the chain")
+	}
+
+	return topmost, nil
+}
+
+// IsSelfSigned checks whether the certificate is signed by itself.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+
+	// CheckSignatureFrom is not used as it rejects the self-signed leaf certificates
+	// which are not marked as CA.
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// ValidateCA checks the data contains PEM encoded certificates which can be trusted as the CA,
+// either marked as CA or self-signed.
+func ValidateCA(data []byte) error {
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range certs {
+		if !c.IsCA && !IsSelfSigned(c) {
+			return errs.Errorf("certificate %q is not a CA certificate", c.Subject.String())
+		}
+	}
+
+	return nil
+}
+
+// FingerprintSHA256 returns the hex encoded SHA-256 fingerprint of the certificate.
+func FingerprintSHA256(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
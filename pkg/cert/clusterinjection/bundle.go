@@ -0,0 +1,216 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clusterinjection
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/secret"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// InjectionName is the name of the CertInjection serving all the cluster cert injections.
+	InjectionName = "cluster-cert-injection"
+	bundlePrefix  = "cluster-ca"
+)
+
+// Bundle is the aggregation of the registries of all the cluster cert injections.
+// The CA secrets referenced from the other namespaces are copied into the operator namespace,
+// as they can't be mounted by the injectors there.
+type Bundle struct {
+	// Registries of the CertInjection, referencing the copied CA secrets.
+	Registries []v1alpha1.Registry
+	// Secrets are the copied CA data keyed by the name of the copied secret.
+	Secrets map[string][]byte
+	// Members are the copied secrets used by each cluster cert injection.
+	Members map[string][]string
+	// Errors are the reasons why the cluster cert injections are not included.
+	Errors map[string]error
+}
+
+// NewBundle aggregates the registries of the cluster cert injections.
+// The injections are handled by the creation time, the one claiming a host first takes it
+// and the later ones claiming the same host are excluded.
+func NewBundle(ctx context.Context, reader client.Reader, items []v1alpha1.ClusterCertInjection) *Bundle {
+	sorted := make([]*v1alpha1.ClusterCertInjection, 0, len(items))
+	for i := range items {
+		if items[i].DeletionTimestamp.IsZero() {
+			sorted = append(sorted, &items[i])
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := sorted[i].CreationTimestamp, sorted[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	b := &Bundle{
+		Secrets: make(map[string][]byte),
+		Members: make(map[string][]string),
+		Errors:  make(map[string]error),
+	}
+
+	claimed := make(map[string]string)
+	for _, cci := range sorted {
+		registries, secrets, err := resolve(ctx, reader, cci, claimed)
+		if err != nil {
+			b.Errors[cci.Name] = err
+			continue
+		}
+
+		for _, r := range registries {
+			for _, h := range r.Hosts {
+				claimed[h] = cci.Name
+			}
+
+			b.Registries = append(b.Registries, r)
+			b.Members[cci.Name] = append(b.Members[cci.Name], r.CertSecret.Name)
+		}
+
+		for name, data := range secrets {
+			b.Secrets[name] = data
+		}
+	}
+
+	return b
+}
+
+// Spec renders the spec of the CertInjection serving the bundle.
+// The first registry is set as ExternalDNS and Aliases, nil is returned if there is no registry.
+func (b *Bundle) Spec(mode v1alpha1.InjectionMode) *v1alpha1.CertInjectionSpec {
+	if len(b.Registries) == 0 {
+		return nil
+	}
+
+	primary := b.Registries[0]
+
+	return &v1alpha1.CertInjectionSpec{
+		ExternalDNS:      primary.Hosts[0],
+		Aliases:          primary.Hosts[1:],
+		CertSecret:       primary.CertSecret,
+		Registries:       b.Registries[1:],
+		ContainerRuntime: v1alpha1.AutoRuntime,
+		Mode:             mode,
+	}
+}
+
+// SecretName returns the name of the copy of the source secret in the operator namespace.
+func SecretName(source types.NamespacedName) string {
+	h := fnv.New32a()
+	// Writing to a hash never fails.
+	_, _ = h.Write([]byte(source.String()))
+
+	return fmt.Sprintf("%s-%08x", bundlePrefix, h.Sum32())
+}
+
+// References checks whether the cluster cert injection references the secret.
+func References(cci *v1alpha1.ClusterCertInjection, secret types.NamespacedName) bool {
+	for _, r := range cci.Spec.Registries {
+		if r.CertSecret.Namespace == secret.Namespace && r.CertSecret.Name == secret.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve normalizes the hosts and reads the CA of the registries of the cluster cert injection.
+// It returns the registries referencing the copied secrets and the data of the copied secrets.
+func resolve(ctx context.Context, reader client.Reader, cci *v1alpha1.ClusterCertInjection,
+	claimed map[string]string) ([]v1alpha1.Registry, map[string][]byte, error) {
+	seen := make(map[string]bool)
+	secrets := make(map[string][]byte)
+
+	registries := make([]v1alpha1.Registry, 0, len(cci.Spec.Registries))
+	for i, r := range cci.Spec.Registries {
+		if len(r.Hosts) == 0 {
+			return nil, nil, errs.Errorf("no hosts set in registry %d", i)
+		}
+
+		hosts := make([]string, 0, len(r.Hosts))
+		for _, h := range r.Hosts {
+			host, err := registry.NormalizeHost(h)
+			if err != nil {
+				return nil, nil, errs.Wrap(fmt.Sprintf("invalid host of registry %d", i), err)
+			}
+
+			if seen[host] {
+				return nil, nil, errs.Errorf("duplicate host %s", host)
+			}
+
+			if owner, ok := claimed[host]; ok {
+				return nil, nil, errs.Errorf("host %s is already claimed by ClusterCertInjection %s", host, owner)
+			}
+
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+
+		source := types.NamespacedName{Namespace: r.CertSecret.Namespace, Name: r.CertSecret.Name}
+		if source.Namespace == "" || source.Name == "" {
+			return nil, nil, errs.Errorf("namespace and name of the CA secret of registry %d are required", i)
+		}
+
+		name := SecretName(source)
+		if _, ok := secrets[name]; !ok {
+			ca, err := readCA(ctx, reader, source)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			secrets[name] = ca
+		}
+
+		registries = append(registries, v1alpha1.Registry{
+			Hosts:      hosts,
+			CertSecret: corev1.LocalObjectReference{Name: name},
+		})
+	}
+
+	return registries, secrets, nil
+}
+
+func readCA(ctx context.Context, reader client.Reader, source types.NamespacedName) ([]byte, error) {
+	s := &corev1.Secret{}
+	if err := reader.Get(ctx, source, s); err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("failed to get CA secret %s", source), err)
+	}
+
+	ca, err := secret.CACert(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := certutil.ValidateCA(ca); err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("invalid CA in secret %s", source), err)
+	}
+
+	return ca, nil
+}
@@ -0,0 +1,270 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clusterinjection
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/internal/certtest"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var created = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newClusterInjection(name string, age time.Duration, registries ...v1alpha1.ClusterRegistry) v1alpha1.ClusterCertInjection {
+	return v1alpha1.ClusterCertInjection{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created.Add(age))},
+		Spec:       v1alpha1.ClusterCertInjectionSpec{Registries: registries},
+	}
+}
+
+func newRegistry(namespace string, name string, hosts ...string) v1alpha1.ClusterRegistry {
+	return v1alpha1.ClusterRegistry{
+		Hosts:      hosts,
+		CertSecret: corev1.SecretReference{Namespace: namespace, Name: name},
+	}
+}
+
+func newSecret(namespace string, name string, ca []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string][]byte{"ca.crt": ca},
+	}
+}
+
+func newReader(objs ...client.Object) client.Reader {
+	return fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(objs...).Build()
+}
+
+func TestNewBundle(t *testing.T) {
+	now := time.Now()
+	rootA, _ := certtest.NewCA(t, "team-a", now.Add(-time.Hour), nil, nil)
+	rootB, _ := certtest.NewCA(t, "team-b", now.Add(-time.Hour), nil, nil)
+	caA, caB := certtest.Encode(rootA), certtest.Encode(rootB)
+
+	secretA := types.NamespacedName{Namespace: "team-a", Name: "registry-ca"}
+	secretB := types.NamespacedName{Namespace: "team-b", Name: "registry-ca"}
+	copyA, copyB := SecretName(secretA), SecretName(secretB)
+
+	reader := newReader(
+		newSecret("team-a", "registry-ca", caA),
+		newSecret("team-b", "registry-ca", caB),
+		newSecret("team-c", "not-ca", []byte("not a certificate")),
+	)
+
+	deleting := newClusterInjection("deleting", 0, newRegistry("team-b", "registry-ca", "deleting.example.com"))
+	deleting.DeletionTimestamp = &metav1.Time{Time: now}
+
+	cases := []struct {
+		name       string
+		items      []v1alpha1.ClusterCertInjection
+		registries []v1alpha1.Registry
+		secrets    map[string][]byte
+		members    map[string][]string
+		errors     []string
+	}{
+		{
+			name: "merged registries",
+			items: []v1alpha1.ClusterCertInjection{
+				newClusterInjection("team-b", time.Minute, newRegistry("team-b", "registry-ca", "b.example.com")),
+				newClusterInjection("team-a", 0,
+					newRegistry("team-a", "registry-ca", "https://A.Example.com/", "a.example.com:8443"),
+					newRegistry("team-a", "registry-ca", "mirror.a.example.com"),
+				),
+			},
+			registries: []v1alpha1.Registry{
+				{Hosts: []string{"a.example.com", "a.example.com:8443"}, CertSecret: corev1.LocalObjectReference{Name: copyA}},
+				{Hosts: []string{"mirror.a.example.com"}, CertSecret: corev1.LocalObjectReference{Name: copyA}},
+				{Hosts: []string{"b.example.com"}, CertSecret: corev1.LocalObjectReference{Name: copyB}},
+			},
+			secrets: map[string][]byte{copyA: caA, copyB: caB},
+			members: map[string][]string{"team-a": {copyA, copyA}, "team-b": {copyB}},
+		},
+		{
+			name: "host claimed by the earlier injection",
+			items: []v1alpha1.ClusterCertInjection{
+				newClusterInjection("team-b", time.Minute, newRegistry("team-b", "registry-ca", "shared.example.com")),
+				newClusterInjection("team-a", 0, newRegistry("team-a", "registry-ca", "Shared.Example.com")),
+			},
+			registries: []v1alpha1.Registry{
+				{Hosts: []string{"shared.example.com"}, CertSecret: corev1.LocalObjectReference{Name: copyA}},
+			},
+			secrets: map[string][]byte{copyA: caA},
+			members: map[string][]string{"team-a": {copyA}},
+			errors:  []string{"team-b"},
+		},
+		{
+			name: "host claimed at the same time",
+			items: []v1alpha1.ClusterCertInjection{
+				newClusterInjection("team-b", 0, newRegistry("team-b", "registry-ca", "shared.example.com")),
+				newClusterInjection("team-a", 0, newRegistry("team-a", "registry-ca", "shared.example.com")),
+			},
+			registries: []v1alpha1.Registry{
+				{Hosts: []string{"shared.example.com"}, CertSecret: corev1.LocalObjectReference{Name: copyA}},
+			},
+			secrets: map[string][]byte{copyA: caA},
+			members: map[string][]string{"team-a": {copyA}},
+			errors:  []string{"team-b"},
+		},
+		{
+			name: "duplicate host",
+			items: []v1alpha1.ClusterCertInjection{
+				newClusterInjection("team-a", 0,
+					newRegistry("team-a", "registry-ca", "a.example.com"),
+					newRegistry("team-b", "registry-ca", "A.example.com"),
+				),
+			},
+			secrets: map[string][]byte{},
+			members: map[string][]string{},
+			errors:  []string{"team-a"},
+		},
+		{
+			name: "deleted injection and namespace",
+			items: []v1alpha1.ClusterCertInjection{
+				deleting,
+				newClusterInjection("team-a", 0, newRegistry("team-a", "registry-ca", "a.example.com")),
+				newClusterInjection("team-d", 0, newRegistry("team-d", "registry-ca", "d.example.com")),
+			},
+			registries: []v1alpha1.Registry{
+				{Hosts: []string{"a.example.com"}, CertSecret: corev1.LocalObjectReference{Name: copyA}},
+			},
+			secrets: map[string][]byte{copyA: caA},
+			members: map[string][]string{"team-a": {copyA}},
+			errors:  []string{"team-d"},
+		},
+		{
+			name: "invalid sources",
+			items: []v1alpha1.ClusterCertInjection{
+				newClusterInjection("not-ca", 0, newRegistry("team-c", "not-ca", "c.example.com")),
+				newClusterInjection("no-namespace", 0, newRegistry("", "registry-ca", "a.example.com")),
+				newClusterInjection("invalid-host", 0, newRegistry("team-a", "registry-ca", "https://a.example.com/v2")),
+				newClusterInjection("no-hosts", 0, newRegistry("team-a", "registry-ca")),
+			},
+			secrets: map[string][]byte{},
+			members: map[string][]string{},
+			errors:  []string{"invalid-host", "no-hosts", "no-namespace", "not-ca"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewBundle(context.Background(), reader, c.items)
+
+			if !reflect.DeepEqual(b.Registries, c.registries) {
+				t.Fatalf("expected registries %v, got %v", c.registries, b.Registries)
+			}
+
+			if !reflect.DeepEqual(b.Secrets, c.secrets) {
+				t.Fatalf("expected secrets %v, got %v", keys(c.secrets), keys(b.Secrets))
+			}
+
+			if !reflect.DeepEqual(b.Members, c.members) {
+				t.Fatalf("expected members %v, got %v", c.members, b.Members)
+			}
+
+			if got := strings.Join(errorKeys(b.Errors), ","); got != strings.Join(c.errors, ",") {
+				t.Fatalf("expected errors of %v, got %v", c.errors, b.Errors)
+			}
+		})
+	}
+}
+
+func TestBundleSpec(t *testing.T) {
+	b := &Bundle{}
+	if spec := b.Spec(v1alpha1.ContainerdHostsMode); spec != nil {
+		t.Fatalf("expected no spec of the empty bundle, got %v", spec)
+	}
+
+	b.Registries = []v1alpha1.Registry{
+		{Hosts: []string{"a.example.com", "a.example.com:8443"}, CertSecret: corev1.LocalObjectReference{Name: "cluster-ca-a"}},
+		{Hosts: []string{"b.example.com"}, CertSecret: corev1.LocalObjectReference{Name: "cluster-ca-b"}},
+	}
+
+	spec := b.Spec(v1alpha1.ContainerdHostsMode)
+	if spec.ExternalDNS != "a.example.com" || !reflect.DeepEqual(spec.Aliases, []string{"a.example.com:8443"}) ||
+		spec.CertSecret.Name != "cluster-ca-a" || !reflect.DeepEqual(spec.Registries, b.Registries[1:]) {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+
+	if spec.ContainerRuntime != v1alpha1.AutoRuntime || spec.Mode != v1alpha1.ContainerdHostsMode {
+		t.Fatalf("expected the auto runtime and the mode, got %s and %s", spec.ContainerRuntime, spec.Mode)
+	}
+}
+
+// TestBundleSourceChange checks the copies follow the sources referenced by the cluster cert injections.
+func TestBundleSourceChange(t *testing.T) {
+	now := time.Now()
+	root, _ := certtest.NewCA(t, "root", now.Add(-time.Hour), nil, nil)
+	reader := newReader(newSecret("team-a", "registry-ca", certtest.Encode(root)),
+		newSecret("team-b", "registry-ca", certtest.Encode(root)))
+
+	oldSource := types.NamespacedName{Namespace: "team-a", Name: "registry-ca"}
+	newSource := types.NamespacedName{Namespace: "team-b", Name: "registry-ca"}
+
+	cci := newClusterInjection("shared", 0, newRegistry(oldSource.Namespace, oldSource.Name, "shared.example.com"))
+	if !References(&cci, oldSource) || References(&cci, newSource) {
+		t.Fatalf("expected only %s referenced", oldSource)
+	}
+
+	cci.Spec.Registries[0].CertSecret = corev1.SecretReference{Namespace: newSource.Namespace, Name: newSource.Name}
+	if References(&cci, oldSource) || !References(&cci, newSource) {
+		t.Fatalf("expected only %s referenced", newSource)
+	}
+
+	b := NewBundle(context.Background(), reader, []v1alpha1.ClusterCertInjection{cci})
+	if _, ok := b.Secrets[SecretName(oldSource)]; ok {
+		t.Fatalf("expected the copy of %s dropped", oldSource)
+	}
+
+	if !reflect.DeepEqual(b.Members["shared"], []string{SecretName(newSource)}) {
+		t.Fatalf("expected the copy of %s, got %v", newSource, b.Members["shared"])
+	}
+
+	if SecretName(oldSource) == SecretName(newSource) {
+		t.Fatalf("expected distinct copies of the sources in different namespaces")
+	}
+}
+
+func keys(m map[string][]byte) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func errorKeys(m map[string]error) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+
+	sort.Strings(result)
+	return result
+}
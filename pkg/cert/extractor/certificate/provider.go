@@ -0,0 +1,178 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager"
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/secret"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// Provider for extracting data from cert-manager certificates.
+// The registry host is the first DNS name of the certificate and the others are the aliases.
+// The CA is read from the ca.crt of the certificate secret, or the secret of the CA issuer.
+type Provider struct {
+	client.Client
+}
+
+// Extract implements extractor.Provider.
+func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Injection, error) {
+	cert, ok := obj.(*certmanagerv1.Certificate)
+	if !ok {
+		return nil, errs.New("expect certmanagerv1.Certificate object")
+	}
+
+	hosts := registryHosts(cert)
+	if len(hosts) == 0 {
+		return nil, errs.Wrap(fmt.Sprintf("no DNS name is set for certificate %s:%s", cert.Namespace, cert.Name),
+			errs.MissingDataError)
+	}
+
+	certSecret := types.NamespacedName{
+		Namespace: cert.Namespace,
+		Name:      cert.Spec.SecretName,
+	}
+
+	s := &corev1.Secret{}
+	if err := p.Get(ctx, certSecret, s); client.IgnoreNotFound(err) != nil {
+		return nil, errs.Wrap("failed to get the certificate secret", err)
+	}
+
+	caCert, issuerSecret, err := p.issuingCA(ctx, cert, s)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceSecrets := []types.NamespacedName{certSecret}
+	if issuerSecret != nil {
+		sourceSecrets = append(sourceSecrets, *issuerSecret)
+	}
+
+	return &mytypes.Injection{
+		ExternalDNS:   hosts[0],
+		Aliases:       hosts[1:],
+		CACert:        caCert,
+		ServerCert:    s.Data[mytypes.TLSCertKeyInSecret],
+		SourceSecrets: sourceSecrets,
+	}, nil
+}
+
+// issuingCA resolves the CA issuing the certificate.
+// The ca.crt set by the issuer in the certificate secret is preferred, otherwise the CA is read from the secret
+// of the CA Issuer or ClusterIssuer. It returns the CA and the secret of the issuer if it's read.
+func (p *Provider) issuingCA(ctx context.Context, cert *certmanagerv1.Certificate,
+	s *corev1.Secret) ([]byte, *types.NamespacedName, error) {
+	if ca := s.Data[mytypes.CAKeyInSecret]; len(ca) > 0 {
+		return ca, nil, nil
+	}
+
+	issuerSecret, err := p.issuerSecret(ctx, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caSecret := &corev1.Secret{}
+	if err := p.Get(ctx, *issuerSecret, caSecret); err != nil {
+		return nil, nil, errs.Wrap("failed to get the CA secret of the issuer", err)
+	}
+
+	// The certificate of the CA issuer is the CA itself.
+	ca, err := secret.CACert(caSecret)
+	if err != nil {
+		return nil, nil, errs.Wrap("failed to read the CA of the issuer", err)
+	}
+
+	return ca, issuerSecret, nil
+}
+
+// issuerSecret returns the secret of the CA Issuer or ClusterIssuer of the certificate.
+func (p *Provider) issuerSecret(ctx context.Context, cert *certmanagerv1.Certificate) (*types.NamespacedName, error) {
+	ref := cert.Spec.IssuerRef
+	if ref.Group != "" && ref.Group != certmanager.GroupName {
+		return nil, errs.Wrap(fmt.Sprintf("no ca.crt in the secret of certificate %s:%s issued by the external issuer %s/%s",
+			cert.Namespace, cert.Name, ref.Group, ref.Name), errs.MissingDataError)
+	}
+
+	var (
+		spec      certmanagerv1.IssuerSpec
+		namespace string
+	)
+
+	switch ref.Kind {
+	case "", certmanagerv1.IssuerKind:
+		issuer := &certmanagerv1.Issuer{}
+		if err := p.Get(ctx, types.NamespacedName{Namespace: cert.Namespace, Name: ref.Name}, issuer); err != nil {
+			return nil, errs.Wrap("failed to get the issuer of the certificate", err)
+		}
+
+		spec, namespace = issuer.Spec, cert.Namespace
+	case certmanagerv1.ClusterIssuerKind:
+		issuer := &certmanagerv1.ClusterIssuer{}
+		if err := p.Get(ctx, types.NamespacedName{Name: ref.Name}, issuer); err != nil {
+			return nil, errs.Wrap("failed to get the cluster issuer of the certificate", err)
+		}
+
+		// The secrets of the cluster issuers are in the cluster resource namespace of cert-manager.
+		spec, namespace = issuer.Spec, config.Get().CertManagerNamespace
+	default:
+		return nil, errs.Errorf("unsupported issuer kind %q of certificate %s:%s", ref.Kind, cert.Namespace, cert.Name)
+	}
+
+	if spec.CA == nil || spec.CA.SecretName == "" {
+		return nil, errs.Wrap(fmt.Sprintf("no ca.crt in the secret of certificate %s:%s and its issuer %s is not a CA issuer",
+			cert.Namespace, cert.Name, ref.Name), errs.MissingDataError)
+	}
+
+	return &types.NamespacedName{Namespace: namespace, Name: spec.CA.SecretName}, nil
+}
+
+// registryHosts returns the DNS names of the certificate, or the common name if no DNS name is set.
+// The wildcard and invalid names are skipped as they're not registry hosts.
+func registryHosts(cert *certmanagerv1.Certificate) []string {
+	names := cert.Spec.DNSNames
+	if len(names) == 0 && cert.Spec.CommonName != "" {
+		names = []string{cert.Spec.CommonName}
+	}
+
+	var hosts []string
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		if strings.HasPrefix(strings.TrimSpace(n), "*") {
+			continue
+		}
+
+		host, err := registry.NormalizeHost(n)
+		if err != nil || seen[host] {
+			continue
+		}
+
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+
+	return hosts
+}
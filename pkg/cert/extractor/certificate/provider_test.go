@@ -0,0 +1,205 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cmacme "github.com/jetstack/cert-manager/pkg/apis/acme/v1"
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/internal/certtest"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newCertificate(dnsNames []string, issuer cmmeta.ObjectReference) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "harbor"},
+		Spec: certmanagerv1.CertificateSpec{
+			DNSNames:   dnsNames,
+			SecretName: "harbor-tls",
+			IssuerRef:  issuer,
+		},
+	}
+}
+
+func newSecret(namespace, name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       data,
+	}
+}
+
+func TestExtract(t *testing.T) {
+	now := time.Now()
+	root, rootKey := certtest.NewCA(t, "root", now.Add(-time.Hour), nil, nil)
+	leaf, _ := certtest.NewLeaf(t, root, rootKey, now.Add(-time.Hour), now.Add(time.Hour), "harbor.example.com")
+	ca := certtest.Encode(root)
+
+	caIssuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "harbor-ca"},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+			CA: &certmanagerv1.CAIssuer{SecretName: "ca-key-pair"},
+		}},
+	}
+	acmeIssuer := &certmanagerv1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "letsencrypt"},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+			ACME: &cmacme.ACMEIssuer{Server: "https://acme.example.com/directory"},
+		}},
+	}
+	clusterIssuer := &certmanagerv1.ClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-ca"},
+		Spec: certmanagerv1.IssuerSpec{IssuerConfig: certmanagerv1.IssuerConfig{
+			CA: &certmanagerv1.CAIssuer{SecretName: "cluster-ca-key-pair"},
+		}},
+	}
+
+	certSecret := types.NamespacedName{Namespace: "harbor", Name: "harbor-tls"}
+	issued := newSecret("harbor", "harbor-tls", map[string][]byte{
+		mytypes.CAKeyInSecret:      ca,
+		mytypes.TLSCertKeyInSecret: certtest.Encode(leaf),
+	})
+
+	cases := []struct {
+		name    string
+		cert    *certmanagerv1.Certificate
+		objects []client.Object
+		host    string
+		aliases []string
+		sources []types.NamespacedName
+		err     func(error) bool
+	}{
+		{
+			name:    "host normalization",
+			cert:    newCertificate([]string{"*.example.com", " Harbor.Example.com", "core.example.com", "harbor.example.com", "bad host"}, cmmeta.ObjectReference{Name: "harbor-ca"}),
+			objects: []client.Object{issued},
+			host:    "harbor.example.com",
+			aliases: []string{"core.example.com"},
+			sources: []types.NamespacedName{certSecret},
+		},
+		{
+			name:    "common name",
+			cert:    &certmanagerv1.Certificate{ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "harbor"}, Spec: certmanagerv1.CertificateSpec{CommonName: "Harbor.Example.com", SecretName: "harbor-tls"}},
+			objects: []client.Object{issued},
+			host:    "harbor.example.com",
+			sources: []types.NamespacedName{certSecret},
+		},
+		{
+			name: "no DNS name",
+			cert: newCertificate([]string{"*.example.com"}, cmmeta.ObjectReference{Name: "harbor-ca"}),
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name: "CA of the issuer",
+			cert: newCertificate([]string{"harbor.example.com"}, cmmeta.ObjectReference{Name: "harbor-ca"}),
+			objects: []client.Object{
+				newSecret("harbor", "harbor-tls", map[string][]byte{mytypes.TLSCertKeyInSecret: certtest.Encode(leaf)}),
+				caIssuer,
+				newSecret("harbor", "ca-key-pair", map[string][]byte{mytypes.TLSCertKeyInSecret: ca}),
+			},
+			host:    "harbor.example.com",
+			sources: []types.NamespacedName{certSecret, {Namespace: "harbor", Name: "ca-key-pair"}},
+		},
+		{
+			name: "CA of the cluster issuer",
+			cert: newCertificate([]string{"harbor.example.com"}, cmmeta.ObjectReference{Kind: certmanagerv1.ClusterIssuerKind, Name: "cluster-ca"}),
+			objects: []client.Object{
+				clusterIssuer,
+				newSecret("cert-manager", "cluster-ca-key-pair", map[string][]byte{mytypes.TLSCertKeyInSecret: ca}),
+			},
+			host:    "harbor.example.com",
+			sources: []types.NamespacedName{certSecret, {Namespace: "cert-manager", Name: "cluster-ca-key-pair"}},
+		},
+		{
+			name:    "missing secret of a non CA issuer",
+			cert:    newCertificate([]string{"harbor.example.com"}, cmmeta.ObjectReference{Name: "letsencrypt"}),
+			objects: []client.Object{acmeIssuer},
+			err:     errs.IsMissingDataError,
+		},
+		{
+			name: "missing secret of an external issuer",
+			cert: newCertificate([]string{"harbor.example.com"}, cmmeta.ObjectReference{Group: "awspca.cert-manager.io", Kind: "AWSPCAIssuer", Name: "pca"}),
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name: "no CA in the secret of the issuer",
+			cert: newCertificate([]string{"harbor.example.com"}, cmmeta.ObjectReference{Name: "harbor-ca"}),
+			objects: []client.Object{
+				caIssuer,
+				newSecret("harbor", "ca-key-pair", map[string][]byte{"tls.key": []byte("key")}),
+			},
+			err: errs.IsMissingDataError,
+		},
+		{
+			name: "unsupported issuer kind",
+			cert: newCertificate([]string{"harbor.example.com"}, cmmeta.ObjectReference{Kind: "Vault", Name: "vault"}),
+			err:  func(err error) bool { return true },
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := certmanagerv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &Provider{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(c.objects...).Build()}
+
+			injection, err := p.Extract(context.Background(), c.cert)
+			if c.err != nil {
+				if err == nil || !c.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != c.host || strings.Join(injection.Aliases, ",") != strings.Join(c.aliases, ",") {
+				t.Fatalf("expected host %s and aliases %v, got %s and %v", c.host, c.aliases, injection.ExternalDNS, injection.Aliases)
+			}
+
+			if string(injection.CACert) != string(ca) {
+				t.Fatalf("expected the root CA, got %q", injection.CACert)
+			}
+
+			if !reflect.DeepEqual(injection.SourceSecrets, c.sources) {
+				t.Fatalf("expected source secrets %v, got %v", c.sources, injection.SourceSecrets)
+			}
+		})
+	}
+}
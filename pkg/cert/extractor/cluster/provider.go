@@ -25,6 +25,7 @@ import (
 
 	goharborv1beta1 "github.com/goharbor/harbor-operator/apis/goharbor.io/v1beta1"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
 	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 )
 
@@ -57,8 +58,50 @@ func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Inj
 		return nil, errs.Wrap("get CA secret of harbor cluster error", err)
 	}
 
+	externalDNS, err := registry.NormalizeHost(harbor.Spec.ExternalURL)
+	if err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("invalid external URL of harbor cluster %s:%s", harbor.Namespace, harbor.Name), err)
+	}
+
 	return &mytypes.Injection{
-		ExternalDNS: strings.TrimPrefix(harbor.Spec.ExternalURL, "https://"),
+		ExternalDNS: externalDNS,
+		Aliases:     aliases(harbor, externalDNS),
 		CACert:      caCert.Data["ca.crt"],
+		ServerCert:  caCert.Data[mytypes.TLSCertKeyInSecret],
+		SourceSecrets: []types.NamespacedName{
+			{Namespace: harbor.Namespace, Name: certRef},
+		},
 	}, nil
 }
+
+// aliases returns the ingress hosts of the harbor cluster other than the external DNS.
+// The notary host is only included when it's served with the same certificate as the core.
+// The invalid hosts are skipped.
+func aliases(harbor *goharborv1beta1.HarborCluster, externalDNS string) []string {
+	var hosts []string
+	add := func(host string) {
+		host, err := registry.NormalizeHost(host)
+		if err != nil || host == externalDNS {
+			return
+		}
+
+		for _, h := range hosts {
+			if h == host {
+				return
+			}
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	add(harbor.Spec.Expose.Core.Ingress.Host)
+
+	// The notary without TLS of its own is not served with the certificate of the core.
+	if notary, core := harbor.Spec.Expose.Notary, harbor.Spec.Expose.Core.TLS; notary != nil && core != nil {
+		if notary.TLS != nil && notary.TLS.CertificateRef == core.CertificateRef {
+			add(notary.Ingress.Host)
+		}
+	}
+
+	return hosts
+}
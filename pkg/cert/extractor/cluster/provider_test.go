@@ -0,0 +1,125 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	goharborv1beta1 "github.com/goharbor/harbor-operator/apis/goharbor.io/v1beta1"
+	harbormetav1 "github.com/goharbor/harbor-operator/apis/meta/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newHarborCluster(coreTLS *harbormetav1.ComponentsTLSSpec, notary *goharborv1beta1.HarborExposeComponentSpec) *goharborv1beta1.HarborCluster {
+	harbor := &goharborv1beta1.HarborCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "harbor"},
+	}
+	harbor.Spec.ExternalURL = "https://harbor.example.com"
+	harbor.Spec.Expose.Core = goharborv1beta1.HarborExposeComponentSpec{
+		TLS:     coreTLS,
+		Ingress: goharborv1beta1.HarborExposeIngressSpec{Host: "core.example.com"},
+	}
+	harbor.Spec.Expose.Notary = notary
+
+	return harbor
+}
+
+func newNotary(tls *harbormetav1.ComponentsTLSSpec) *goharborv1beta1.HarborExposeComponentSpec {
+	return &goharborv1beta1.HarborExposeComponentSpec{
+		TLS:     tls,
+		Ingress: goharborv1beta1.HarborExposeIngressSpec{Host: "Notary.Example.com"},
+	}
+}
+
+func TestExtract(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client-go scheme: %v", err)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "harbor-tls"},
+		Data:       map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("tls")},
+	}).Build()
+	p := &Provider{Client: c}
+
+	coreTLS := &harbormetav1.ComponentsTLSSpec{CertificateRef: "harbor-tls"}
+
+	cases := []struct {
+		name    string
+		harbor  *goharborv1beta1.HarborCluster
+		aliases []string
+		err     func(error) bool
+	}{
+		{
+			name:    "no notary",
+			harbor:  newHarborCluster(coreTLS, nil),
+			aliases: []string{"core.example.com"},
+		},
+		{
+			name:    "notary with the certificate of the core",
+			harbor:  newHarborCluster(coreTLS, newNotary(&harbormetav1.ComponentsTLSSpec{CertificateRef: "harbor-tls"})),
+			aliases: []string{"core.example.com", "notary.example.com"},
+		},
+		{
+			name:    "notary with a certificate of its own",
+			harbor:  newHarborCluster(coreTLS, newNotary(&harbormetav1.ComponentsTLSSpec{CertificateRef: "notary-tls"})),
+			aliases: []string{"core.example.com"},
+		},
+		{
+			name:    "notary without TLS",
+			harbor:  newHarborCluster(coreTLS, newNotary(nil)),
+			aliases: []string{"core.example.com"},
+		},
+		{
+			name:   "core without TLS",
+			harbor: newHarborCluster(nil, newNotary(nil)),
+			err:    errs.IsTLSNotEnabledError,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			injection, err := p.Extract(context.Background(), c.harbor)
+			if c.err != nil {
+				if err == nil || !c.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != "harbor.example.com" {
+				t.Fatalf("expected host harbor.example.com, got %s", injection.ExternalDNS)
+			}
+
+			if !reflect.DeepEqual(injection.Aliases, c.aliases) {
+				t.Fatalf("expected aliases %v, got %v", c.aliases, injection.Aliases)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/secret"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// TLSEndpoint is a group of hosts served with the certificate in the secret, e.g. an Ingress TLS entry
+// or a Gateway listener.
+type TLSEndpoint struct {
+	Hosts  []string
+	Secret types.NamespacedName
+}
+
+// Injection resolves the injection of the TLS endpoints of the object.
+// The registry host is the one set in the annotation mytypes.RegistryHostAnnotationKey of the object,
+// or the first host of the endpoints. The other hosts served with the same secret are the aliases,
+// and the CA is read from the secret. The wildcard hosts are skipped.
+func Injection(ctx context.Context, reader client.Reader, obj client.Object, endpoints []TLSEndpoint) (*mytypes.Injection, error) {
+	endpoints = normalize(endpoints)
+	if len(endpoints) == 0 {
+		return nil, errs.Wrap(fmt.Sprintf("no TLS host is served by %s:%s", obj.GetNamespace(), obj.GetName()), errs.TLSNotEnabledError)
+	}
+
+	host := endpoints[0].Hosts[0]
+	ref := endpoints[0].Secret
+	if annotated := strings.TrimSpace(obj.GetAnnotations()[mytypes.RegistryHostAnnotationKey]); annotated != "" {
+		h, err := registry.NormalizeHost(annotated)
+		if err != nil {
+			return nil, errs.Wrap(fmt.Sprintf("invalid registry host of %s:%s", obj.GetNamespace(), obj.GetName()), err)
+		}
+
+		found := false
+		for _, ep := range endpoints {
+			if contains(ep.Hosts, h) {
+				host, ref, found = h, ep.Secret, true
+				break
+			}
+		}
+
+		if !found {
+			return nil, errs.Wrap(fmt.Sprintf("registry host %s set in annotation %s is not served with TLS by %s:%s",
+				h, mytypes.RegistryHostAnnotationKey, obj.GetNamespace(), obj.GetName()), errs.MissingDataError)
+		}
+	}
+
+	var aliases []string
+	for _, ep := range endpoints {
+		if ep.Secret != ref {
+			continue
+		}
+
+		for _, h := range ep.Hosts {
+			if h != host && !contains(aliases, h) {
+				aliases = append(aliases, h)
+			}
+		}
+	}
+
+	s := &corev1.Secret{}
+	if err := reader.Get(ctx, ref, s); err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("failed to get TLS secret %s", ref), err)
+	}
+
+	caCert, err := secret.CACert(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mytypes.Injection{
+		ExternalDNS:   host,
+		Aliases:       aliases,
+		CACert:        caCert,
+		ServerCert:    s.Data[mytypes.TLSCertKeyInSecret],
+		SourceSecrets: []types.NamespacedName{ref},
+	}, nil
+}
+
+// normalize drops the wildcard and invalid hosts, and the endpoints without hosts or secret.
+func normalize(endpoints []TLSEndpoint) []TLSEndpoint {
+	var result []TLSEndpoint
+	for _, ep := range endpoints {
+		if ep.Secret.Name == "" {
+			continue
+		}
+
+		var hosts []string
+		for _, h := range ep.Hosts {
+			if strings.HasPrefix(strings.TrimSpace(h), "*") {
+				continue
+			}
+
+			host, err := registry.NormalizeHost(h)
+			if err != nil || contains(hosts, host) {
+				continue
+			}
+
+			hosts = append(hosts, host)
+		}
+
+		if len(hosts) > 0 {
+			result = append(result, TLSEndpoint{Hosts: hosts, Secret: ep.Secret})
+		}
+	}
+
+	return result
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,284 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/endpoint"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+const (
+	protocolHTTPS   = "HTTPS"
+	protocolTLS     = "TLS"
+	tlsModeTerminal = "Terminate"
+	defaultTLSPort  = 443
+)
+
+var (
+	// GroupVersionV1 of the Gateway API.
+	GroupVersionV1 = schema.GroupVersion{Group: mytypes.GatewayAPIGroup, Version: "v1"}
+	// GroupVersionV1beta1 of the Gateway API.
+	GroupVersionV1beta1 = schema.GroupVersion{Group: mytypes.GatewayAPIGroup, Version: "v1beta1"}
+	// Versions are the supported versions of the Gateway API in the order of preference.
+	Versions = []string{GroupVersionV1.Version, GroupVersionV1beta1.Version}
+)
+
+// The Gateway API objects are read as unstructured objects, the fields used here are the same in all
+// the supported versions.
+
+type gatewaySpec struct {
+	Listeners []listener `json:"listeners,omitempty"`
+}
+
+type listener struct {
+	Name     string       `json:"name"`
+	Hostname *string      `json:"hostname,omitempty"`
+	Port     int32        `json:"port"`
+	Protocol string       `json:"protocol"`
+	TLS      *listenerTLS `json:"tls,omitempty"`
+}
+
+type listenerTLS struct {
+	Mode            *string     `json:"mode,omitempty"`
+	CertificateRefs []objectRef `json:"certificateRefs,omitempty"`
+}
+
+type objectRef struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      *string `json:"kind,omitempty"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+type routeSpec struct {
+	Hostnames  []string    `json:"hostnames,omitempty"`
+	ParentRefs []parentRef `json:"parentRefs,omitempty"`
+}
+
+type parentRef struct {
+	Group       *string `json:"group,omitempty"`
+	Kind        *string `json:"kind,omitempty"`
+	Namespace   *string `json:"namespace,omitempty"`
+	Name        string  `json:"name"`
+	SectionName *string `json:"sectionName,omitempty"`
+}
+
+// Provider for extracting data from the Gateways of the Gateway API.
+// The registry hosts are the host names of the listeners terminating TLS, and the CA is read from the secret of
+// the first certificate of the listener.
+type Provider struct {
+	client.Client
+}
+
+// Extract implements extractor.Provider.
+func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Injection, error) {
+	gw, ok := obj.(*unstructured.Unstructured)
+	if !ok || gw.GetKind() != mytypes.Gateway {
+		return nil, errs.New("expect unstructured Gateway object")
+	}
+
+	spec := &gatewaySpec{}
+	if err := fromSpec(gw, spec); err != nil {
+		return nil, err
+	}
+
+	var endpoints []endpoint.TLSEndpoint
+	for _, l := range spec.Listeners {
+		secret, ok := listenerSecret(gw.GetNamespace(), l)
+		if !ok || l.Hostname == nil {
+			continue
+		}
+
+		endpoints = append(endpoints, endpoint.TLSEndpoint{
+			Hosts:  []string{hostPort(*l.Hostname, l.Port)},
+			Secret: secret,
+		})
+	}
+
+	return endpoint.Injection(ctx, p.Client, gw, endpoints)
+}
+
+// RouteProvider for extracting data from the HTTPRoutes of the Gateway API.
+// The registry hosts are the host names of the route, and the CA is read from the secret of the listeners of the
+// parent Gateways serving the host names.
+type RouteProvider struct {
+	client.Client
+}
+
+// Extract implements extractor.Provider.
+func (p *RouteProvider) Extract(ctx context.Context, obj client.Object) (*mytypes.Injection, error) {
+	route, ok := obj.(*unstructured.Unstructured)
+	if !ok || route.GetKind() != mytypes.HTTPRoute {
+		return nil, errs.New("expect unstructured HTTPRoute object")
+	}
+
+	spec := &routeSpec{}
+	if err := fromSpec(route, spec); err != nil {
+		return nil, err
+	}
+
+	var endpoints []endpoint.TLSEndpoint
+	for _, key := range ParentGateways(route) {
+		gw := &unstructured.Unstructured{}
+		gw.SetGroupVersionKind(route.GroupVersionKind().GroupVersion().WithKind(mytypes.Gateway))
+		if err := p.Get(ctx, key, gw); err != nil {
+			return nil, errs.Wrap(fmt.Sprintf("failed to get parent gateway %s of route %s:%s", key, route.GetNamespace(), route.GetName()), err)
+		}
+
+		gwSpec := &gatewaySpec{}
+		if err := fromSpec(gw, gwSpec); err != nil {
+			return nil, err
+		}
+
+		for _, ref := range spec.ParentRefs {
+			if !refersTo(ref, route.GetNamespace(), key) {
+				continue
+			}
+
+			for _, l := range gwSpec.Listeners {
+				if ref.SectionName != nil && *ref.SectionName != l.Name {
+					continue
+				}
+
+				secret, ok := listenerSecret(gw.GetNamespace(), l)
+				if !ok {
+					continue
+				}
+
+				var hosts []string
+				for _, h := range spec.Hostnames {
+					if l.Hostname == nil || matchHostname(*l.Hostname, h) {
+						hosts = append(hosts, hostPort(h, l.Port))
+					}
+				}
+
+				endpoints = append(endpoints, endpoint.TLSEndpoint{Hosts: hosts, Secret: secret})
+			}
+		}
+	}
+
+	return endpoint.Injection(ctx, p.Client, route, endpoints)
+}
+
+// ParentGateways returns the Gateways the route is attached to.
+func ParentGateways(route *unstructured.Unstructured) []types.NamespacedName {
+	spec := &routeSpec{}
+	if err := fromSpec(route, spec); err != nil {
+		return nil
+	}
+
+	var keys []types.NamespacedName
+	seen := make(map[types.NamespacedName]bool)
+	for _, ref := range spec.ParentRefs {
+		if (ref.Group != nil && *ref.Group != mytypes.GatewayAPIGroup) || (ref.Kind != nil && *ref.Kind != mytypes.Gateway) {
+			continue
+		}
+
+		key := types.NamespacedName{Namespace: route.GetNamespace(), Name: ref.Name}
+		if ref.Namespace != nil && *ref.Namespace != "" {
+			key.Namespace = *ref.Namespace
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// refersTo checks whether the parent ref refers to the Gateway.
+func refersTo(ref parentRef, namespace string, gateway types.NamespacedName) bool {
+	if ref.Namespace != nil && *ref.Namespace != "" {
+		namespace = *ref.Namespace
+	}
+
+	return (ref.Kind == nil || *ref.Kind == mytypes.Gateway) && namespace == gateway.Namespace && ref.Name == gateway.Name
+}
+
+// listenerSecret returns the secret of the first certificate of the listener terminating TLS.
+func listenerSecret(namespace string, l listener) (types.NamespacedName, bool) {
+	if (l.Protocol != protocolHTTPS && l.Protocol != protocolTLS) || l.TLS == nil {
+		return types.NamespacedName{}, false
+	}
+
+	if l.TLS.Mode != nil && *l.TLS.Mode != tlsModeTerminal {
+		return types.NamespacedName{}, false
+	}
+
+	for _, ref := range l.TLS.CertificateRefs {
+		if (ref.Group != nil && *ref.Group != "") || (ref.Kind != nil && *ref.Kind != mytypes.Secret) {
+			continue
+		}
+
+		key := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+		if ref.Namespace != nil && *ref.Namespace != "" {
+			key.Namespace = *ref.Namespace
+		}
+
+		return key, true
+	}
+
+	return types.NamespacedName{}, false
+}
+
+// matchHostname checks whether the host matches the host name of the listener, which may be a wildcard.
+// The host names are case insensitive.
+func matchHostname(hostname string, host string) bool {
+	hostname, host = strings.ToLower(hostname), strings.ToLower(strings.TrimSpace(host))
+	if strings.HasPrefix(hostname, "*.") {
+		return strings.HasSuffix(host, hostname[1:]) && host != hostname[2:]
+	}
+
+	return hostname == host
+}
+
+// hostPort returns the registry host, the port is only added if it's not the default TLS port.
+func hostPort(host string, port int32) string {
+	if port == 0 || port == defaultTLSPort {
+		return host
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// fromSpec converts the spec of the unstructured object.
+func fromSpec(obj *unstructured.Unstructured, spec interface{}) error {
+	m, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return errs.Wrap(fmt.Sprintf("invalid spec of %s %s:%s", obj.GetKind(), obj.GetNamespace(), obj.GetName()), errs.InvalidDataError)
+	}
+
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, spec); err != nil {
+		return errs.Wrap(fmt.Sprintf("invalid spec of %s %s:%s: %s", obj.GetKind(), obj.GetNamespace(), obj.GetName(), err),
+			errs.InvalidDataError)
+	}
+
+	return nil
+}
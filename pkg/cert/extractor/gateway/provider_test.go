@@ -0,0 +1,237 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newObject(kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetGroupVersionKind(GroupVersionV1.WithKind(kind))
+	u.SetNamespace("harbor")
+	u.SetName(name)
+
+	return u
+}
+
+func newListener(name string, hostname string, port int64, protocol string, secret string) map[string]interface{} {
+	l := map[string]interface{}{
+		"name":     name,
+		"port":     port,
+		"protocol": protocol,
+	}
+
+	if hostname != "" {
+		l["hostname"] = hostname
+	}
+
+	if secret != "" {
+		l["tls"] = map[string]interface{}{
+			"certificateRefs": []interface{}{map[string]interface{}{"name": secret}},
+		}
+	}
+
+	return l
+}
+
+func newSecret(name string, ca string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: name},
+		Data:       map[string][]byte{mytypes.CAKeyInSecret: []byte(ca)},
+	}
+}
+
+func newClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func TestExtract(t *testing.T) {
+	passthrough := newListener("passthrough", "git.example.com", 443, protocolTLS, "harbor-tls")
+	passthrough["tls"].(map[string]interface{})["mode"] = "Passthrough"
+
+	cases := []struct {
+		name      string
+		listeners []interface{}
+		host      string
+		aliases   []string
+		ca        string
+		err       func(error) bool
+	}{
+		{
+			name: "host normalization",
+			listeners: []interface{}{
+				newListener("wildcard", "*.example.com", 443, protocolHTTPS, "harbor-tls"),
+				newListener("harbor", "Harbor.Example.com", 443, protocolHTTPS, "harbor-tls"),
+			},
+			host: "harbor.example.com",
+			ca:   "harbor-ca",
+		},
+		{
+			name: "multiple listeners",
+			listeners: []interface{}{
+				newListener("http", "harbor.example.com", 80, "HTTP", ""),
+				passthrough,
+				newListener("no-hostname", "", 443, protocolHTTPS, "harbor-tls"),
+				newListener("harbor", "harbor.example.com", 443, protocolHTTPS, "harbor-tls"),
+				newListener("notary", "notary.example.com", 443, protocolHTTPS, "notary-tls"),
+				newListener("core", "core.example.com", 8443, protocolTLS, "harbor-tls"),
+			},
+			host:    "harbor.example.com",
+			aliases: []string{"core.example.com:8443"},
+			ca:      "harbor-ca",
+		},
+		{
+			name: "no listener terminating TLS",
+			listeners: []interface{}{
+				newListener("http", "harbor.example.com", 80, "HTTP", ""),
+				passthrough,
+			},
+			err: errs.IsTLSNotEnabledError,
+		},
+		{
+			name:      "invalid listeners",
+			listeners: []interface{}{"harbor"},
+			err:       errs.IsInvalidDataError,
+		},
+	}
+
+	p := &Provider{Client: newClient(t, newSecret("harbor-tls", "harbor-ca"), newSecret("notary-tls", "notary-ca"))}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gw := newObject(mytypes.Gateway, "harbor-gateway", map[string]interface{}{"listeners": c.listeners})
+
+			injection, err := p.Extract(context.Background(), gw)
+			if c.err != nil {
+				if err == nil || !c.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != c.host || strings.Join(injection.Aliases, ",") != strings.Join(c.aliases, ",") {
+				t.Fatalf("expected host %s and aliases %v, got %s and %v", c.host, c.aliases, injection.ExternalDNS, injection.Aliases)
+			}
+
+			if string(injection.CACert) != c.ca {
+				t.Fatalf("expected CA %s, got %s", c.ca, injection.CACert)
+			}
+		})
+	}
+}
+
+func TestExtractRoute(t *testing.T) {
+	gw := newObject(mytypes.Gateway, "harbor-gateway", map[string]interface{}{"listeners": []interface{}{
+		newListener("wildcard", "*.example.com", 443, protocolHTTPS, "wildcard-tls"),
+		newListener("notary", "notary.example.com", 443, protocolHTTPS, "notary-tls"),
+	}})
+
+	cases := []struct {
+		name      string
+		hostnames []interface{}
+		section   string
+		host      string
+		aliases   []string
+		source    string
+		err       func(error) bool
+	}{
+		{
+			name:      "hosts of the wildcard listener",
+			hostnames: []interface{}{"Harbor.Example.com", "core.example.com", "example.com"},
+			host:      "harbor.example.com",
+			aliases:   []string{"core.example.com"},
+			source:    "wildcard-tls",
+		},
+		{
+			name:      "section of the parent",
+			hostnames: []interface{}{"notary.example.com"},
+			section:   "notary",
+			host:      "notary.example.com",
+			source:    "notary-tls",
+		},
+		{
+			name:      "no host served by the section",
+			hostnames: []interface{}{"harbor.example.com"},
+			section:   "notary",
+			err:       errs.IsTLSNotEnabledError,
+		},
+	}
+
+	c := newClient(t, newSecret("wildcard-tls", "wildcard-ca"), newSecret("notary-tls", "notary-ca"))
+	if err := c.Create(context.Background(), gw); err != nil {
+		t.Fatalf("create gateway: %v", err)
+	}
+
+	p := &RouteProvider{Client: c}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := map[string]interface{}{"name": "harbor-gateway"}
+			if tc.section != "" {
+				parent["sectionName"] = tc.section
+			}
+
+			route := newObject(mytypes.HTTPRoute, "harbor-route", map[string]interface{}{
+				"hostnames":  tc.hostnames,
+				"parentRefs": []interface{}{parent},
+			})
+
+			injection, err := p.Extract(context.Background(), route)
+			if tc.err != nil {
+				if err == nil || !tc.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != tc.host || strings.Join(injection.Aliases, ",") != strings.Join(tc.aliases, ",") {
+				t.Fatalf("expected host %s and aliases %v, got %s and %v", tc.host, tc.aliases, injection.ExternalDNS, injection.Aliases)
+			}
+
+			source := types.NamespacedName{Namespace: "harbor", Name: tc.source}
+			if len(injection.SourceSecrets) != 1 || injection.SourceSecrets[0] != source {
+				t.Fatalf("expected source secret %s, got %v", source, injection.SourceSecrets)
+			}
+		})
+	}
+}
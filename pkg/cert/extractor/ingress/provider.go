@@ -0,0 +1,54 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/endpoint"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// Provider for extracting data from ingresses, e.g. the one created by the Harbor Helm chart.
+// The registry hosts are the TLS hosts of the ingress and the CA is read from the TLS secret.
+type Provider struct {
+	client.Client
+}
+
+// Extract implements extractor.Provider.
+func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Injection, error) {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil, errs.New("expect networkingv1.Ingress object")
+	}
+
+	endpoints := make([]endpoint.TLSEndpoint, 0, len(ing.Spec.TLS))
+	for _, tls := range ing.Spec.TLS {
+		endpoints = append(endpoints, endpoint.TLSEndpoint{
+			Hosts: tls.Hosts,
+			Secret: types.NamespacedName{
+				Namespace: ing.Namespace,
+				Name:      tls.SecretName,
+			},
+		})
+	}
+
+	return endpoint.Injection(ctx, p.Client, ing, endpoints)
+}
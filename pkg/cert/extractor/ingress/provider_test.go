@@ -0,0 +1,167 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newIngress(host string, tls ...networkingv1.IngressTLS) *networkingv1.Ingress {
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "harbor-ingress"},
+		Spec:       networkingv1.IngressSpec{TLS: tls},
+	}
+
+	if host != "" {
+		ing.Annotations = map[string]string{mytypes.RegistryHostAnnotationKey: host}
+	}
+
+	return ing
+}
+
+func newSecret(name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: name},
+		Data:       data,
+	}
+}
+
+func TestExtract(t *testing.T) {
+	secrets := []*corev1.Secret{
+		newSecret("harbor-tls", map[string][]byte{mytypes.CAKeyInSecret: []byte("harbor-ca")}),
+		newSecret("notary-tls", map[string][]byte{mytypes.CAKeyInSecret: []byte("notary-ca")}),
+		newSecret("no-ca", map[string][]byte{"tls.key": []byte("key")}),
+	}
+
+	cases := []struct {
+		name    string
+		ingress *networkingv1.Ingress
+		host    string
+		aliases []string
+		ca      string
+		source  string
+		err     func(error) bool
+	}{
+		{
+			name: "host normalization",
+			ingress: newIngress("", networkingv1.IngressTLS{
+				Hosts:      []string{"*.example.com", " Harbor.Example.com", "harbor.example.com", "bad host"},
+				SecretName: "harbor-tls",
+			}),
+			host:   "harbor.example.com",
+			ca:     "harbor-ca",
+			source: "harbor-tls",
+		},
+		{
+			name: "multiple TLS hosts",
+			ingress: newIngress("",
+				networkingv1.IngressTLS{Hosts: []string{"harbor.example.com"}, SecretName: "harbor-tls"},
+				networkingv1.IngressTLS{Hosts: []string{"notary.example.com"}, SecretName: "notary-tls"},
+				networkingv1.IngressTLS{Hosts: []string{"core.example.com", "harbor.example.com"}, SecretName: "harbor-tls"},
+			),
+			host:    "harbor.example.com",
+			aliases: []string{"core.example.com"},
+			ca:      "harbor-ca",
+			source:  "harbor-tls",
+		},
+		{
+			name: "host in the annotation",
+			ingress: newIngress("https://Notary.Example.com/",
+				networkingv1.IngressTLS{Hosts: []string{"harbor.example.com"}, SecretName: "harbor-tls"},
+				networkingv1.IngressTLS{Hosts: []string{"notary.example.com"}, SecretName: "notary-tls"},
+			),
+			host:   "notary.example.com",
+			ca:     "notary-ca",
+			source: "notary-tls",
+		},
+		{
+			name: "host in the annotation not served",
+			ingress: newIngress("registry.example.com",
+				networkingv1.IngressTLS{Hosts: []string{"harbor.example.com"}, SecretName: "harbor-tls"},
+			),
+			err: errs.IsMissingDataError,
+		},
+		{
+			name: "no TLS hosts",
+			ingress: newIngress("",
+				networkingv1.IngressTLS{Hosts: []string{"*.example.com"}, SecretName: "harbor-tls"},
+				networkingv1.IngressTLS{Hosts: []string{"harbor.example.com"}},
+			),
+			err: errs.IsTLSNotEnabledError,
+		},
+		{
+			name: "no CA in the secret",
+			ingress: newIngress("",
+				networkingv1.IngressTLS{Hosts: []string{"harbor.example.com"}, SecretName: "no-ca"},
+			),
+			err: errs.IsMissingDataError,
+		},
+		{
+			// The secret may be issued later, the extraction is retried.
+			name: "missing secret",
+			ingress: newIngress("",
+				networkingv1.IngressTLS{Hosts: []string{"harbor.example.com"}, SecretName: "missing-tls"},
+			),
+			err: apierrors.IsNotFound,
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).
+		WithObjects(secrets[0], secrets[1], secrets[2]).Build()
+	p := &Provider{Client: c}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			injection, err := p.Extract(context.Background(), tc.ingress)
+			if tc.err != nil {
+				if err == nil || !tc.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != tc.host || strings.Join(injection.Aliases, ",") != strings.Join(tc.aliases, ",") {
+				t.Fatalf("expected host %s and aliases %v, got %s and %v", tc.host, tc.aliases, injection.ExternalDNS, injection.Aliases)
+			}
+
+			if string(injection.CACert) != tc.ca {
+				t.Fatalf("expected CA %s, got %s", tc.ca, injection.CACert)
+			}
+
+			source := types.NamespacedName{Namespace: "harbor", Name: tc.source}
+			if len(injection.SourceSecrets) != 1 || injection.SourceSecrets[0] != source {
+				t.Fatalf("expected source secret %s, got %v", source, injection.SourceSecrets)
+			}
+		})
+	}
+}
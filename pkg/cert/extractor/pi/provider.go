@@ -15,23 +15,30 @@
 package pi
 
 import (
+	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/secret"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
 	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 	packagev1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
 )
 
 const (
-	appCatalogSecretRefKey  = "inline-values"
-	tkgPackageSecretRefName = "harbor-default-values"
-	appCatalogCaSecretName  = "harbor-ca-key-pair"
+	appCatalogCaSecretName = "harbor-ca-key-pair"
+	// defaultHarborNamespace is the namespace Harbor is deployed into by the package when it's not set in the values.
+	defaultHarborNamespace = "tanzu-system-registry"
+	decoderBufferSize      = 4096
 )
 
 type packageValues struct {
@@ -42,7 +49,8 @@ type packageValues struct {
 }
 
 type tlsCertificate struct {
-	CACert string `json:"ca.crt"`
+	CACert  string `json:"ca.crt"`
+	TLSCert string `json:"tls.crt"`
 }
 
 // Provider for extracting data from package installs.
@@ -57,100 +65,167 @@ func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Inj
 		return nil, errs.New("expect v1alph1.PackageInstall object")
 	}
 
-	// Find the name of the secret that contains the configuration values.
-	secretRef := getValueSecret(pkgInstall)
-	// Get the configuration values
-	pvs, err := p.getValuesFromSecret(ctx, *secretRef)
+	// Get the configuration values from all the values secrets.
+	pvs, valueSecrets, err := p.getValues(ctx, pkgInstall)
 	if err != nil {
-		return nil, errs.Wrap("failed to get configuration values from the secret", err)
+		return nil, errs.Wrap("failed to get configuration values of the package install", err)
+	}
+
+	if strings.TrimSpace(pvs.HostName) == "" {
+		return nil, errs.Wrap(fmt.Sprintf("hostname is not set in the values of package install %s:%s",
+			pkgInstall.Namespace, pkgInstall.Name), errs.MissingDataError)
 	}
 
 	// There are three ways to set the CA cert, check it one by one.
 	// Set in the `tlsCertificate` field.
 	if pvs.TLSCertificate != nil && len(pvs.TLSCertificate.CACert) > 0 {
 		return &mytypes.Injection{
-			ExternalDNS: pvs.HostName,
-			CACert:      []byte(pvs.TLSCertificate.CACert),
+			ExternalDNS:   pvs.HostName,
+			CACert:        []byte(pvs.TLSCertificate.CACert),
+			ServerCert:    []byte(pvs.TLSCertificate.TLSCert),
+			SourceSecrets: valueSecrets,
 		}, nil
 	}
 
 	// Set with a separate secret,
 	// or inject into a fixed secret by the cert-manager.
 	caSecretRef := appCatalogCaSecretName
-	if pvs.TLSCertificateSecretName != nil {
+	if pvs.TLSCertificateSecretName != nil && *pvs.TLSCertificateSecretName != "" {
 		caSecretRef = *pvs.TLSCertificateSecretName
 	}
 
-	CAContent, err := p.extractCAFromSecret(ctx, types.NamespacedName{
+	namespace := pvs.Namespace
+	if namespace == "" {
+		namespace = defaultHarborNamespace
+	}
+
+	caSecret := types.NamespacedName{
 		Name:      caSecretRef,
-		Namespace: pvs.Namespace,
-	})
+		Namespace: namespace,
+	}
 
+	CAContent, serverCert, err := p.extractCAFromSecret(ctx, caSecret)
 	if err != nil {
 		return nil, errs.Wrap("failed to extract CA from the specified secret", err)
 	}
 
 	return &mytypes.Injection{
-		ExternalDNS: pvs.HostName,
-		CACert:      CAContent,
+		ExternalDNS:   pvs.HostName,
+		CACert:        CAContent,
+		ServerCert:    serverCert,
+		SourceSecrets: append(valueSecrets, caSecret),
 	}, nil
 }
 
-func (p *Provider) getValuesFromSecret(ctx context.Context, secret types.NamespacedName) (*packageValues, error) {
-	vSecret := &corev1.Secret{}
-	if err := p.Get(ctx, secret, vSecret); err != nil {
-		return nil, errs.Wrap("failed to get the values secret object", err)
-	}
+// getValues merges the values of all the values secrets in order, same as kapp-controller does.
+// The values set later override the earlier ones. It returns the values and the secrets they're read from.
+func (p *Provider) getValues(ctx context.Context, pkgInstall *packagev1alpha1.PackageInstall) (*packageValues, []types.NamespacedName, error) {
+	merged := make(map[string]interface{})
+	var valueSecrets []types.NamespacedName
+
+	for _, v := range pkgInstall.Spec.Values {
+		if v.SecretRef == nil || v.SecretRef.Name == "" {
+			continue
+		}
+
+		secretRef := types.NamespacedName{
+			Name:      v.SecretRef.Name,
+			Namespace: pkgInstall.Namespace,
+		}
+
+		vSecret := &corev1.Secret{}
+		if err := p.Get(ctx, secretRef, vSecret); err != nil {
+			return nil, nil, errs.Wrap(fmt.Sprintf("failed to get the values secret %s", secretRef), err)
+		}
+
+		valueSecrets = append(valueSecrets, secretRef)
+
+		// All the keys of the secret are values files in the order of the names if the key is not set.
+		keys := []string{v.SecretRef.Key}
+		if v.SecretRef.Key == "" {
+			keys = make([]string, 0, len(vSecret.Data))
+			for k := range vSecret.Data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+		}
 
-	var decodedV []byte
-	// There will be only 1 field.
-	// Because the TKG package and TMC app catalog use different key and the key in TKG package is not fixed,
-	// then we just get the first and only field.
-	for _, encodedV := range vSecret.Data {
-		if _, err := base64.StdEncoding.Decode(decodedV, encodedV); err != nil {
-			return nil, errs.Wrap("failed to decode the base64 encoded configuration values", err)
+		for _, k := range keys {
+			// The data of the secret has been decoded from base64 by the client.
+			data, ok := vSecret.Data[k]
+			if !ok {
+				return nil, nil, errs.Wrap(fmt.Sprintf("missing key %s in the values secret %s", k, secretRef), errs.MissingDataError)
+			}
+
+			if err := mergeValuesFile(merged, data); err != nil {
+				return nil, nil, errs.Wrap(fmt.Sprintf("invalid values in key %s of the values secret %s", k, secretRef), err)
+			}
 		}
+	}
 
-		break
+	if len(valueSecrets) == 0 {
+		return nil, nil, errs.Wrap(fmt.Sprintf("no values secret is set for package install %s:%s",
+			pkgInstall.Namespace, pkgInstall.Name), errs.MissingDataError)
 	}
 
 	// Unmarshal the required data.
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, errs.Wrap("failed to marshal the merged configuration values", err)
+	}
+
 	pvs := &packageValues{}
-	if err := json.Unmarshal(decodedV, pvs); err != nil {
-		return nil, errs.Wrap("failed to unmarshal configuration values", err)
+	if err := json.Unmarshal(data, pvs); err != nil {
+		return nil, nil, errs.Wrap(fmt.Sprintf("failed to unmarshal configuration values: %s", err), errs.InvalidDataError)
 	}
 
-	return pvs, nil
+	return pvs, valueSecrets, nil
 }
 
-func (p *Provider) extractCAFromSecret(ctx context.Context, secretRef types.NamespacedName) ([]byte, error) {
-	caSecret := &corev1.Secret{}
-	if err := p.Get(ctx, secretRef, caSecret); err != nil {
-		return nil, errs.Wrap("failed to get the CA secret object", err)
-	}
+// mergeValuesFile merges the YAML or JSON documents of a values file into the values.
+func mergeValuesFile(values map[string]interface{}, data []byte) error {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), decoderBufferSize)
+	for {
+		doc := make(map[string]interface{})
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return nil
+			}
 
-	var decodedV []byte
-	if encodedV, ok := caSecret.Data[mytypes.CAKeyInSecret]; ok {
-		if _, err := base64.StdEncoding.Decode(decodedV, encodedV); err != nil {
-			return nil, errs.Wrap("failed to decode the base64 encoded CA content", err)
+			return errs.Wrap(err.Error(), errs.InvalidDataError)
 		}
 
-		return decodedV, nil
+		mergeValues(values, doc)
 	}
-
-	return nil, errs.Errorf("missing %s in the secret data", mytypes.CAKeyInSecret)
 }
 
-func getValueSecret(pkgInstall *packagev1alpha1.PackageInstall) *types.NamespacedName {
-	for _, v := range pkgInstall.Spec.Values {
-		if v.SecretRef.Key == appCatalogSecretRefKey ||
-			v.SecretRef.Name == tkgPackageSecretRefName {
-			return &types.NamespacedName{
-				Name:      v.SecretRef.Name,
-				Namespace: pkgInstall.Namespace,
-			}
+// mergeValues merges the values from src into dst recursively.
+// The maps are merged, and the other values in src override the ones in dst.
+func mergeValues(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
 		}
+
+		dst[k] = v
+	}
+}
+
+// extractCAFromSecret returns the CA and the server certificate chain in the secret.
+func (p *Provider) extractCAFromSecret(ctx context.Context, secretRef types.NamespacedName) ([]byte, []byte, error) {
+	caSecret := &corev1.Secret{}
+	if err := p.Get(ctx, secretRef, caSecret); err != nil {
+		return nil, nil, errs.Wrap("failed to get the CA secret object", err)
+	}
+
+	// The data of the secret has been decoded from base64 by the client.
+	ca, err := secret.CACert(caSecret)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
+	return ca, caSecret.Data[mytypes.TLSCertKeyInSecret], nil
 }
@@ -0,0 +1,216 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	packagev1alpha1 "github.com/vmware-tanzu/carvel-kapp-controller/pkg/apis/packaging/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const pkgNamespace = "tanzu-packages"
+
+func newSecret(namespace string, name string, data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       make(map[string][]byte, len(data)),
+	}
+
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+
+	return s
+}
+
+func newPackageInstall(refs ...packagev1alpha1.PackageInstallValuesSecretRef) *packagev1alpha1.PackageInstall {
+	pi := &packagev1alpha1.PackageInstall{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pkgNamespace, Name: "harbor"},
+	}
+
+	for i := range refs {
+		pi.Spec.Values = append(pi.Spec.Values, packagev1alpha1.PackageInstallValues{SecretRef: &refs[i]})
+	}
+
+	return pi
+}
+
+func TestExtract(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client-go scheme: %v", err)
+	}
+
+	objs := []client.Object{
+		// The CA inline in the values.
+		newSecret(pkgNamespace, "inline-values", map[string]string{"values.yaml": `
+hostname: harbor.example.com
+tlsCertificate:
+  ca.crt: inline-ca
+  tls.crt: inline-tls
+`}),
+		// The CA in the secret referenced by the values.
+		newSecret(pkgNamespace, "secret-ref-values", map[string]string{"values.yaml": `
+hostname: harbor.example.com
+namespace: harbor
+tlsCertificateSecretName: harbor-tls
+`}),
+		newSecret("harbor", "harbor-tls", map[string]string{"ca.crt": "secret-ca", "tls.crt": "secret-tls"}),
+		// The CA in the default secret of the package.
+		newSecret(pkgNamespace, "default-values", map[string]string{"values.yaml": `{"hostname": "harbor.example.com"}`}),
+		newSecret(defaultHarborNamespace, appCatalogCaSecretName, map[string]string{"ca.crt": "default-ca"}),
+		// The values overriding the ones of the earlier secrets.
+		newSecret(pkgNamespace, "override-values", map[string]string{
+			"01-hostname.yaml": "hostname: core.example.com",
+			"02-tls.yaml": `
+tlsCertificate:
+  tls.crt: override-tls
+---
+hostname: registry.example.com
+`,
+		}),
+		newSecret(pkgNamespace, "no-hostname-values", map[string]string{"values.yaml": "namespace: harbor"}),
+		newSecret(pkgNamespace, "invalid-values", map[string]string{"values.yaml": "hostname: ["}),
+	}
+
+	p := &Provider{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+
+	values := func(name string) types.NamespacedName {
+		return types.NamespacedName{Namespace: pkgNamespace, Name: name}
+	}
+
+	cases := []struct {
+		name          string
+		refs          []packagev1alpha1.PackageInstallValuesSecretRef
+		host          string
+		ca            string
+		serverCert    string
+		sourceSecrets []types.NamespacedName
+		err           func(error) bool
+	}{
+		{
+			name:          "inline CA",
+			refs:          []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "inline-values"}},
+			host:          "harbor.example.com",
+			ca:            "inline-ca",
+			serverCert:    "inline-tls",
+			sourceSecrets: []types.NamespacedName{values("inline-values")},
+		},
+		{
+			name:       "CA in the referenced secret",
+			refs:       []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "secret-ref-values", Key: "values.yaml"}},
+			host:       "harbor.example.com",
+			ca:         "secret-ca",
+			serverCert: "secret-tls",
+			sourceSecrets: []types.NamespacedName{
+				values("secret-ref-values"),
+				{Namespace: "harbor", Name: "harbor-tls"},
+			},
+		},
+		{
+			name: "CA in the default secret",
+			refs: []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "default-values"}},
+			host: "harbor.example.com",
+			ca:   "default-ca",
+			sourceSecrets: []types.NamespacedName{
+				values("default-values"),
+				{Namespace: defaultHarborNamespace, Name: appCatalogCaSecretName},
+			},
+		},
+		{
+			name:          "inline CA over the referenced secret",
+			refs:          []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "secret-ref-values"}, {Name: "inline-values"}},
+			host:          "harbor.example.com",
+			ca:            "inline-ca",
+			serverCert:    "inline-tls",
+			sourceSecrets: []types.NamespacedName{values("secret-ref-values"), values("inline-values")},
+		},
+		{
+			name:          "later values override the earlier ones",
+			refs:          []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "inline-values"}, {Name: "override-values"}},
+			host:          "registry.example.com",
+			ca:            "inline-ca",
+			serverCert:    "override-tls",
+			sourceSecrets: []types.NamespacedName{values("inline-values"), values("override-values")},
+		},
+		{
+			name:          "earlier values overridden by the later ones",
+			refs:          []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "override-values", Key: "02-tls.yaml"}, {Name: "inline-values"}},
+			host:          "harbor.example.com",
+			ca:            "inline-ca",
+			serverCert:    "inline-tls",
+			sourceSecrets: []types.NamespacedName{values("override-values"), values("inline-values")},
+		},
+		{
+			name: "no values secret",
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name: "missing key",
+			refs: []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "inline-values", Key: "missing.yaml"}},
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name: "missing hostname",
+			refs: []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "no-hostname-values"}},
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name: "invalid values",
+			refs: []packagev1alpha1.PackageInstallValuesSecretRef{{Name: "invalid-values"}},
+			err:  errs.IsInvalidDataError,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			injection, err := p.Extract(context.Background(), newPackageInstall(c.refs...))
+			if c.err != nil {
+				if err == nil || !c.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != c.host {
+				t.Fatalf("expected host %s, got %s", c.host, injection.ExternalDNS)
+			}
+
+			if string(injection.CACert) != c.ca || string(injection.ServerCert) != c.serverCert {
+				t.Fatalf("expected CA %q and server cert %q, got %q and %q", c.ca, c.serverCert, injection.CACert, injection.ServerCert)
+			}
+
+			if !reflect.DeepEqual(injection.SourceSecrets, c.sourceSecrets) {
+				t.Fatalf("expected source secrets %v, got %v", c.sourceSecrets, injection.SourceSecrets)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/secret"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+// Provider for extracting data from the custom resources of the kind targeted by a CertSourceProfile.
+// The registry hosts and the CA secret are read from the custom resource by the JSONPath of the profile.
+type Provider struct {
+	client.Client
+
+	Profile *v1alpha1.CertSourceProfile
+}
+
+// Extract implements extractor.Provider.
+func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Injection, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, errs.New("expect unstructured.Unstructured object")
+	}
+
+	spec := p.Profile.Spec
+	source := fmt.Sprintf("%s %s:%s", u.GetKind(), u.GetNamespace(), u.GetName())
+
+	hosts, err := Evaluate(spec.HostPath, u)
+	if err != nil {
+		return nil, errs.Wrap("failed to read the registry host", err)
+	}
+
+	if len(hosts) == 0 {
+		return nil, errs.Wrap(fmt.Sprintf("no registry host at %s of %s", spec.HostPath, source), errs.MissingDataError)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(hosts[0]), "http://") {
+		return nil, errs.Wrap(source, errs.TLSNotEnabledError)
+	}
+
+	host, err := registry.NormalizeHost(hosts[0])
+	if err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("invalid registry host of %s: %s", source, err), errs.InvalidDataError)
+	}
+
+	aliases, err := p.aliases(u, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := p.caSecret(u)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &corev1.Secret{}
+	if err := p.Get(ctx, ref, s); err != nil {
+		return nil, errs.Wrap("failed to get the CA secret", err)
+	}
+
+	caCert, err := p.caCert(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mytypes.Injection{
+		ExternalDNS:   host,
+		Aliases:       aliases,
+		CACert:        caCert,
+		ServerCert:    s.Data[mytypes.TLSCertKeyInSecret],
+		SourceSecrets: []types.NamespacedName{ref},
+	}, nil
+}
+
+// aliases returns the normalized aliases other than the registry host, the invalid ones are skipped.
+func (p *Provider) aliases(u *unstructured.Unstructured, host string) ([]string, error) {
+	if p.Profile.Spec.AliasesPath == "" {
+		return nil, nil
+	}
+
+	values, err := Evaluate(p.Profile.Spec.AliasesPath, u)
+	if err != nil {
+		return nil, errs.Wrap("failed to read the registry aliases", err)
+	}
+
+	var aliases []string
+	for _, v := range values {
+		for _, a := range strings.Split(v, ",") {
+			alias, err := registry.NormalizeHost(a)
+			if err != nil || alias == host || contains(aliases, alias) {
+				continue
+			}
+
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases, nil
+}
+
+// caSecret returns the secret containing the CA, which is in the namespace of the custom resource by default.
+// The other namespaces must be allowed by the profile.
+func (p *Provider) caSecret(u *unstructured.Unstructured) (types.NamespacedName, error) {
+	spec := p.Profile.Spec
+
+	names, err := Evaluate(spec.CASecretNamePath, u)
+	if err != nil {
+		return types.NamespacedName{}, errs.Wrap("failed to read the CA secret name", err)
+	}
+
+	if len(names) == 0 {
+		return types.NamespacedName{}, errs.Wrap(fmt.Sprintf("no CA secret at %s of %s %s:%s",
+			spec.CASecretNamePath, u.GetKind(), u.GetNamespace(), u.GetName()), errs.MissingDataError)
+	}
+
+	ref := types.NamespacedName{Namespace: u.GetNamespace(), Name: names[0]}
+	if spec.CASecretNamespacePath == "" {
+		return ref, nil
+	}
+
+	namespaces, err := Evaluate(spec.CASecretNamespacePath, u)
+	if err != nil {
+		return types.NamespacedName{}, errs.Wrap("failed to read the CA secret namespace", err)
+	}
+
+	// The secret in another namespace is only read if the profile allows it.
+	if len(namespaces) > 0 && namespaces[0] != ref.Namespace {
+		if !contains(spec.AllowedCASecretNamespaces, namespaces[0]) {
+			return types.NamespacedName{}, errs.Wrap(fmt.Sprintf("CA secret namespace %s of %s %s:%s is not allowed by the profile",
+				namespaces[0], u.GetKind(), u.GetNamespace(), u.GetName()), errs.InvalidDataError)
+		}
+
+		ref.Namespace = namespaces[0]
+	}
+
+	return ref, nil
+}
+
+// caCert reads the CA from the key of the profile, or the default keys if it's not set.
+func (p *Provider) caCert(s *corev1.Secret) ([]byte, error) {
+	key := p.Profile.Spec.CAKey
+	if key == "" {
+		return secret.CACert(s)
+	}
+
+	ca, ok := s.Data[key]
+	if !ok || len(ca) == 0 {
+		return nil, errs.Wrap(fmt.Sprintf("%s is not set in secret %s:%s", key, s.Namespace, s.Name), errs.MissingDataError)
+	}
+
+	return ca, nil
+}
+
+// Parse parses the JSONPath template, the braces can be omitted, e.g. .spec.host is taken as {.spec.host}.
+func Parse(path string) (*jsonpath.JSONPath, error) {
+	tmpl := strings.TrimSpace(path)
+	if !strings.Contains(tmpl, "{") {
+		tmpl = "{" + tmpl + "}"
+	}
+
+	jp := jsonpath.New("profile").AllowMissingKeys(true)
+	if err := jp.Parse(tmpl); err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("invalid JSONPath %q", path), err)
+	}
+
+	return jp, nil
+}
+
+// Evaluate returns the non-empty string values found at the JSONPath of the object.
+// The values of the lists found are flattened, and the object not matching the path is invalid.
+func Evaluate(path string, u *unstructured.Unstructured) ([]string, error) {
+	jp, err := Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := jp.FindResults(u.Object)
+	if err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("failed to evaluate JSONPath %q: %s", path, err), errs.InvalidDataError)
+	}
+
+	var values []string
+	for _, result := range results {
+		for _, v := range result {
+			values = appendValue(values, v)
+		}
+	}
+
+	return values, nil
+}
+
+func appendValue(values []string, v reflect.Value) []string {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return values
+		}
+
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			values = appendValue(values, v.Index(i))
+		}
+	case reflect.String:
+		if s := strings.TrimSpace(v.String()); s != "" {
+			values = append(values, s)
+		}
+	case reflect.Map, reflect.Struct, reflect.Invalid:
+		// Only the scalar values are taken.
+	default:
+		values = append(values, fmt.Sprint(v.Interface()))
+	}
+
+	return values
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
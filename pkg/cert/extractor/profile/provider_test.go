@@ -0,0 +1,250 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newRegistry(spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetAPIVersion("registry.example.com/v1")
+	u.SetKind("Registry")
+	u.SetNamespace("tenant")
+	u.SetName("registry")
+
+	return u
+}
+
+func TestCASecretNamespace(t *testing.T) {
+	cases := []struct {
+		name      string
+		namespace string
+		allowed   []string
+		expected  types.NamespacedName
+	}{
+		{
+			name:     "namespace of the resource by default",
+			expected: types.NamespacedName{Namespace: "tenant", Name: "registry-tls"},
+		},
+		{
+			name:      "namespace of the resource",
+			namespace: "tenant",
+			expected:  types.NamespacedName{Namespace: "tenant", Name: "registry-tls"},
+		},
+		{
+			name:      "allowed namespace",
+			namespace: "shared-certs",
+			allowed:   []string{"shared-certs"},
+			expected:  types.NamespacedName{Namespace: "shared-certs", Name: "registry-tls"},
+		},
+		{
+			name:      "namespace not allowed",
+			namespace: "kube-system",
+			allowed:   []string{"shared-certs"},
+		},
+		{
+			name:      "no namespace allowed",
+			namespace: "shared-certs",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &Provider{Profile: &v1alpha1.CertSourceProfile{Spec: v1alpha1.CertSourceProfileSpec{
+				CASecretNamePath:          ".spec.tls.secretName",
+				CASecretNamespacePath:     ".spec.tls.namespace",
+				AllowedCASecretNamespaces: c.allowed,
+			}}}
+
+			tls := map[string]interface{}{"secretName": "registry-tls"}
+			if c.namespace != "" {
+				tls["namespace"] = c.namespace
+			}
+
+			ref, err := p.caSecret(newRegistry(map[string]interface{}{"tls": tls}))
+			if c.expected.Name == "" {
+				if err == nil || !errs.IsInvalidDataError(err) {
+					t.Fatalf("expected the invalid data error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CA secret: %v", err)
+			}
+
+			if ref != c.expected {
+				t.Fatalf("expected CA secret %s, got %s", c.expected, ref)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	registry := map[string]interface{}{
+		"externalURL": "https://Registry.Example.com/",
+		"aliases":     []interface{}{"Core.Example.com", "registry.example.com", "bad host", "notary.example.com,core.example.com"},
+		"tls":         map[string]interface{}{"secretName": "registry-tls"},
+	}
+
+	cases := []struct {
+		name    string
+		spec    v1alpha1.CertSourceProfileSpec
+		fields  map[string]interface{}
+		host    string
+		aliases []string
+		ca      string
+		err     func(error) bool
+	}{
+		{
+			name: "host normalization",
+			spec: v1alpha1.CertSourceProfileSpec{
+				HostPath:         ".spec.externalURL",
+				AliasesPath:      "{.spec.aliases}",
+				CASecretNamePath: ".spec.tls.secretName",
+			},
+			host:    "registry.example.com",
+			aliases: []string{"core.example.com", "notary.example.com"},
+			ca:      "registry-ca",
+		},
+		{
+			name: "CA key of the profile",
+			spec: v1alpha1.CertSourceProfileSpec{
+				HostPath:         ".spec.externalURL",
+				CASecretNamePath: ".spec.tls.secretName",
+				CAKey:            "bundle.pem",
+			},
+			host: "registry.example.com",
+			ca:   "bundle",
+		},
+		{
+			name:   "TLS not enabled",
+			spec:   v1alpha1.CertSourceProfileSpec{HostPath: ".spec.externalURL", CASecretNamePath: ".spec.tls.secretName"},
+			fields: map[string]interface{}{"externalURL": "http://registry.example.com"},
+			err:    errs.IsTLSNotEnabledError,
+		},
+		{
+			name: "no registry host",
+			spec: v1alpha1.CertSourceProfileSpec{HostPath: ".spec.host", CASecretNamePath: ".spec.tls.secretName"},
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name:   "invalid registry host",
+			spec:   v1alpha1.CertSourceProfileSpec{HostPath: ".spec.externalURL", CASecretNamePath: ".spec.tls.secretName"},
+			fields: map[string]interface{}{"externalURL": "https://registry.example.com/v2/"},
+			err:    errs.IsInvalidDataError,
+		},
+		{
+			name: "no CA secret",
+			spec: v1alpha1.CertSourceProfileSpec{HostPath: ".spec.externalURL", CASecretNamePath: ".spec.tls.name"},
+			err:  errs.IsMissingDataError,
+		},
+		{
+			name: "no CA key in the secret",
+			spec: v1alpha1.CertSourceProfileSpec{
+				HostPath:         ".spec.externalURL",
+				CASecretNamePath: ".spec.tls.secretName",
+				CAKey:            "root.pem",
+			},
+			err: errs.IsMissingDataError,
+		},
+		{
+			// The secret may be created later, the extraction is retried.
+			name:   "missing secret",
+			spec:   v1alpha1.CertSourceProfileSpec{HostPath: ".spec.externalURL", CASecretNamePath: ".spec.tls.secretName"},
+			fields: map[string]interface{}{"tls": map[string]interface{}{"secretName": "missing-tls"}},
+			err:    apierrors.IsNotFound,
+		},
+		{
+			name: "JSONPath evaluation error",
+			spec: v1alpha1.CertSourceProfileSpec{HostPath: ".spec.externalURL[0]", CASecretNamePath: ".spec.tls.secretName"},
+			err:  errs.IsInvalidDataError,
+		},
+		{
+			name: "JSONPath evaluation error of the aliases",
+			spec: v1alpha1.CertSourceProfileSpec{
+				HostPath:         ".spec.externalURL",
+				AliasesPath:      ".spec.aliases[9]",
+				CASecretNamePath: ".spec.tls.secretName",
+			},
+			err: errs.IsInvalidDataError,
+		},
+		{
+			name: "invalid JSONPath",
+			spec: v1alpha1.CertSourceProfileSpec{HostPath: "{.spec[}", CASecretNamePath: ".spec.tls.secretName"},
+			err:  func(err error) bool { return true },
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "registry-tls"},
+		Data:       map[string][]byte{"ca.crt": []byte("registry-ca"), "bundle.pem": []byte("bundle")},
+	}).Build()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := make(map[string]interface{}, len(registry))
+			for k, v := range registry {
+				spec[k] = v
+			}
+
+			for k, v := range tc.fields {
+				spec[k] = v
+			}
+
+			p := &Provider{Client: c, Profile: &v1alpha1.CertSourceProfile{Spec: tc.spec}}
+			injection, err := p.Extract(context.Background(), newRegistry(spec))
+			if tc.err != nil {
+				if err == nil || !tc.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != tc.host || strings.Join(injection.Aliases, ",") != strings.Join(tc.aliases, ",") {
+				t.Fatalf("expected host %s and aliases %v, got %s and %v", tc.host, tc.aliases, injection.ExternalDNS, injection.Aliases)
+			}
+
+			if string(injection.CACert) != tc.ca {
+				t.Fatalf("expected CA %s, got %s", tc.ca, injection.CACert)
+			}
+
+			source := types.NamespacedName{Namespace: "tenant", Name: "registry-tls"}
+			if len(injection.SourceSecrets) != 1 || injection.SourceSecrets[0] != source {
+				t.Fatalf("expected source secret %s, got %v", source, injection.SourceSecrets)
+			}
+		})
+	}
+}
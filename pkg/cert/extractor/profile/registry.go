@@ -0,0 +1,52 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"sync"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+)
+
+var (
+	lock     sync.RWMutex
+	profiles = map[string]*v1alpha1.CertSourceProfile{}
+)
+
+// Register sets the profile serving the GVK of its target, the one registered before is replaced.
+func Register(profile *v1alpha1.CertSourceProfile) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	profiles[profile.Spec.Target.GroupVersionKind().String()] = profile.DeepCopy()
+}
+
+// Unregister removes the profile serving the GVK if it's the one with the name.
+func Unregister(gvk string, name string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if p, ok := profiles[gvk]; ok && p.Name == name {
+		delete(profiles, gvk)
+	}
+}
+
+// Lookup returns the profile serving the GVK, nil is returned if there is none.
+func Lookup(gvk string) *v1alpha1.CertSourceProfile {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return profiles[gvk]
+}
@@ -18,10 +18,16 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 
 	goharborv1beta1 "github.com/goharbor/harbor-operator/apis/goharbor.io/v1beta1"
+	certmanagerv1 "github.com/jetstack/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/certificate"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/cluster"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/gateway"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/ingress"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/pi"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/profile"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor/secret"
 	"github.com/szlabs/harbor-cert-injector/pkg/types"
 	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
@@ -55,11 +61,32 @@ type defaultFactory struct {
 }
 
 // Get implements ProviderFactory.
+// The built-in sources take precedence over the kinds targeted by the CertSourceProfiles.
 func (df *defaultFactory) Get(GVK string) Provider {
 	if len(GVK) == 0 {
 		return nil
 	}
 
+	if p := df.builtIn(GVK); p != nil {
+		return p
+	}
+
+	if p := profile.Lookup(GVK); p != nil {
+		return &profile.Provider{
+			Client:  df.Client,
+			Profile: p,
+		}
+	}
+
+	return nil
+}
+
+// IsBuiltIn checks whether the GVK is a built-in source, which can't be targeted by a CertSourceProfile.
+func IsBuiltIn(GVK string) bool {
+	return (&defaultFactory{}).builtIn(GVK) != nil
+}
+
+func (df *defaultFactory) builtIn(GVK string) Provider {
 	switch GVK {
 	case packagev1alpha1.SchemeGroupVersion.WithKind(mytypes.PackageInstall).String():
 		return &pi.Provider{
@@ -73,6 +100,24 @@ func (df *defaultFactory) Get(GVK string) Provider {
 		return &secret.Provider{
 			Client: df.Client,
 		}
+	case certmanagerv1.SchemeGroupVersion.WithKind(mytypes.Certificate).String():
+		return &certificate.Provider{
+			Client: df.Client,
+		}
+	case networkingv1.SchemeGroupVersion.WithKind(mytypes.Ingress).String():
+		return &ingress.Provider{
+			Client: df.Client,
+		}
+	case gateway.GroupVersionV1.WithKind(mytypes.Gateway).String(),
+		gateway.GroupVersionV1beta1.WithKind(mytypes.Gateway).String():
+		return &gateway.Provider{
+			Client: df.Client,
+		}
+	case gateway.GroupVersionV1.WithKind(mytypes.HTTPRoute).String(),
+		gateway.GroupVersionV1beta1.WithKind(mytypes.HTTPRoute).String():
+		return &gateway.RouteProvider{
+			Client: df.Client,
+		}
 	default:
 		return nil
 	}
@@ -16,16 +16,115 @@ package secret
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
-	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 )
 
 // Provider for extracting data from labeled secrets.
+//
+// The labeled secret is expected to have:
+//   - the registry host set in the annotation mytypes.RegistryHostAnnotationKey
+//     or in the data key mytypes.RegistryHostKeyInSecret;
+//   - optionally the other hosts of the registry set in the annotation mytypes.RegistryAliasesAnnotationKey;
+//   - the CA certificate set in the data key mytypes.CAKeyInSecret, or a certificate chain
+//     in the data key mytypes.TLSCertKeyInSecret where the CA is picked from.
 type Provider struct {
 	client.Client
 }
 
+// Extract implements extractor.Provider.
 func (p *Provider) Extract(ctx context.Context, obj client.Object) (*mytypes.Injection, error) {
-	return nil, nil
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, errs.New("expected corev1.Secret obj but not")
+	}
+
+	host := registryHost(secret)
+	if host == "" {
+		return nil, errs.Wrap(fmt.Sprintf("registry host is not set in annotation %s or data key %s of secret %s:%s",
+			mytypes.RegistryHostAnnotationKey, mytypes.RegistryHostKeyInSecret, secret.Namespace, secret.Name), errs.MissingDataError)
+	}
+
+	host, err := registry.NormalizeHost(host)
+	if err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("invalid registry host of secret %s:%s", secret.Namespace, secret.Name), err)
+	}
+
+	aliases, err := registryAliases(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, err := CACert(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mytypes.Injection{
+		ExternalDNS: host,
+		Aliases:     aliases,
+		CACert:      caCert,
+		ServerCert:  secret.Data[mytypes.TLSCertKeyInSecret],
+	}, nil
+}
+
+func registryAliases(secret *corev1.Secret) ([]string, error) {
+	var aliases []string
+	for _, a := range strings.Split(secret.GetAnnotations()[mytypes.RegistryAliasesAnnotationKey], ",") {
+		if strings.TrimSpace(a) == "" {
+			continue
+		}
+
+		alias, err := registry.NormalizeHost(a)
+		if err != nil {
+			return nil, errs.Wrap(fmt.Sprintf("invalid registry aliases of secret %s:%s", secret.Namespace, secret.Name), err)
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
+
+func registryHost(secret *corev1.Secret) string {
+	host := secret.GetAnnotations()[mytypes.RegistryHostAnnotationKey]
+	if strings.TrimSpace(host) == "" {
+		host = string(secret.Data[mytypes.RegistryHostKeyInSecret])
+	}
+
+	return strings.TrimSpace(host)
+}
+
+// CACert returns the CA certificate of the secret, which is read from the data key mytypes.CAKeyInSecret,
+// or picked from the certificate chain in the data key mytypes.TLSCertKeyInSecret.
+func CACert(secret *corev1.Secret) ([]byte, error) {
+	if ca, ok := secret.Data[mytypes.CAKeyInSecret]; ok && len(ca) > 0 {
+		return ca, nil
+	}
+
+	chainData, ok := secret.Data[mytypes.TLSCertKeyInSecret]
+	if !ok || len(chainData) == 0 {
+		return nil, errs.Wrap(fmt.Sprintf("neither %s nor %s is set in secret %s:%s",
+			mytypes.CAKeyInSecret, mytypes.TLSCertKeyInSecret, secret.Namespace, secret.Name), errs.MissingDataError)
+	}
+
+	chain, err := certutil.ParseCertificates(chainData)
+	if err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("invalid %s in secret %s:%s", mytypes.TLSCertKeyInSecret, secret.Namespace, secret.Name), err)
+	}
+
+	ca, err := certutil.CAFromChain(chain)
+	if err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("no CA in %s of secret %s:%s", mytypes.TLSCertKeyInSecret, secret.Namespace, secret.Name), err)
+	}
+
+	return certutil.EncodeCertificates(ca), nil
 }
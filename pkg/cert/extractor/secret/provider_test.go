@@ -0,0 +1,196 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/internal/certtest"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/controller"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSecret(annotations map[string]string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "harbor",
+			Name:        "registry-ca",
+			Labels:      map[string]string{"goharbor.io/cert-injection": "enabled"},
+			Annotations: annotations,
+		},
+		Data: data,
+	}
+}
+
+func TestExtract(t *testing.T) {
+	now := time.Now()
+	root, rootKey := certtest.NewCA(t, "root", now.Add(-time.Hour), nil, nil)
+	leaf, _ := certtest.NewLeaf(t, root, rootKey, now.Add(-time.Hour), now.Add(time.Hour), "harbor.example.com")
+
+	hostAnnotation := map[string]string{mytypes.RegistryHostAnnotationKey: "https://Harbor.Example.com/"}
+
+	cases := []struct {
+		name    string
+		secret  *corev1.Secret
+		host    string
+		aliases []string
+		ca      []byte
+		err     func(error) bool
+	}{
+		{
+			name:   "host in the annotation",
+			secret: newSecret(hostAnnotation, map[string][]byte{mytypes.CAKeyInSecret: certtest.Encode(root)}),
+			host:   "harbor.example.com",
+			ca:     certtest.Encode(root),
+		},
+		{
+			name: "host in the data key",
+			secret: newSecret(nil, map[string][]byte{
+				mytypes.RegistryHostKeyInSecret: []byte(" harbor.example.com:8443 "),
+				mytypes.CAKeyInSecret:           certtest.Encode(root),
+			}),
+			host: "harbor.example.com:8443",
+			ca:   certtest.Encode(root),
+		},
+		{
+			name: "annotation over the data key",
+			secret: newSecret(hostAnnotation, map[string][]byte{
+				mytypes.RegistryHostKeyInSecret: []byte("core.example.com"),
+				mytypes.CAKeyInSecret:           certtest.Encode(root),
+			}),
+			host: "harbor.example.com",
+			ca:   certtest.Encode(root),
+		},
+		{
+			name: "aliases in the annotation",
+			secret: newSecret(map[string]string{
+				mytypes.RegistryHostAnnotationKey:    "harbor.example.com",
+				mytypes.RegistryAliasesAnnotationKey: "Core.Example.com, ,notary.example.com:443",
+			}, map[string][]byte{mytypes.CAKeyInSecret: certtest.Encode(root)}),
+			host:    "harbor.example.com",
+			aliases: []string{"core.example.com", "notary.example.com:443"},
+			ca:      certtest.Encode(root),
+		},
+		{
+			name:   "missing ca.crt picked from tls.crt",
+			secret: newSecret(hostAnnotation, map[string][]byte{mytypes.TLSCertKeyInSecret: certtest.Encode(leaf, root)}),
+			host:   "harbor.example.com",
+			ca:     certtest.Encode(root),
+		},
+		{
+			name:   "missing ca.crt and tls.crt",
+			secret: newSecret(hostAnnotation, map[string][]byte{"other": []byte("data")}),
+			err:    errs.IsMissingDataError,
+		},
+		{
+			name:   "missing host",
+			secret: newSecret(nil, map[string][]byte{mytypes.CAKeyInSecret: certtest.Encode(root)}),
+			err:    errs.IsMissingDataError,
+		},
+		{
+			name:   "tls.crt not PEM",
+			secret: newSecret(hostAnnotation, map[string][]byte{mytypes.TLSCertKeyInSecret: []byte("not a certificate")}),
+			err:    func(err error) bool { return true },
+		},
+		{
+			// The CA is rejected by the verification before it reaches the nodes.
+			name:   "ca.crt not PEM",
+			secret: newSecret(hostAnnotation, map[string][]byte{mytypes.CAKeyInSecret: []byte("not a certificate")}),
+			host:   "harbor.example.com",
+			ca:     []byte("not a certificate"),
+		},
+		{
+			name: "invalid alias",
+			secret: newSecret(map[string]string{
+				mytypes.RegistryHostAnnotationKey:    "harbor.example.com",
+				mytypes.RegistryAliasesAnnotationKey: "https://",
+			}, map[string][]byte{mytypes.CAKeyInSecret: certtest.Encode(root)}),
+			err: func(err error) bool { return true },
+		},
+	}
+
+	p := &Provider{}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			injection, err := p.Extract(context.Background(), c.secret)
+			if c.err != nil {
+				if err == nil || !c.err(err) {
+					t.Fatalf("expected the error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if injection.ExternalDNS != c.host || !reflect.DeepEqual(injection.Aliases, c.aliases) {
+				t.Fatalf("expected host %s and aliases %v, got %s and %v", c.host, c.aliases, injection.ExternalDNS, injection.Aliases)
+			}
+
+			if string(injection.CACert) != string(c.ca) {
+				t.Fatalf("expected CA %q, got %q", c.ca, injection.CACert)
+			}
+
+			// The secret itself is the source, no other secret is read.
+			if len(injection.SourceSecrets) != 0 {
+				t.Fatalf("expected no source secrets, got %v", injection.SourceSecrets)
+			}
+		})
+	}
+}
+
+// TestOptIn checks the labeled secrets are opted in by the label or the annotation.
+func TestOptIn(t *testing.T) {
+	cases := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		selected    bool
+	}{
+		{name: "label", labels: map[string]string{"goharbor.io/cert-injection": "enabled"}, selected: true},
+		{name: "annotation", annotations: map[string]string{"goharbor.io/inject-ca": "true"}, selected: true},
+		{name: "label disabled", labels: map[string]string{"goharbor.io/cert-injection": "disabled"}},
+		{name: "neither", annotations: map[string]string{mytypes.RegistryHostAnnotationKey: "harbor.example.com"}},
+	}
+
+	selector, err := controller.NewOptInSelector(&config.Options{
+		OptInLabelSelector: config.DefaultOptInLabelSelector,
+		OptInAnnotation:    "goharbor.io/inject-ca=true",
+	}, nil, mytypes.Secret)
+	if err != nil {
+		t.Fatalf("new selector: %v", err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newSecret(c.annotations, nil)
+			s.Labels = c.labels
+
+			if got := selector.Selects(context.Background(), s); got != c.selected {
+				t.Fatalf("expected selected %v, got %v", c.selected, got)
+			}
+		})
+	}
+}
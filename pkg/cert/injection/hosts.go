@@ -0,0 +1,69 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injection
+
+import (
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/registry"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// normalizeHosts normalizes the registry hosts extracted from the source into the host[:port] form,
+// which is the same as the hosts of the CertInjection normalized by its webhook.
+// The aliases duplicated or the same as the external DNS are dropped.
+func normalizeHosts(injection *mytypes.Injection) error {
+	host, err := registry.NormalizeHost(injection.ExternalDNS)
+	if err != nil {
+		return errs.Wrap("invalid registry host", err)
+	}
+
+	seen := map[string]bool{host: true}
+	aliases := make([]string, 0, len(injection.Aliases))
+	for _, a := range injection.Aliases {
+		alias, err := registry.NormalizeHost(a)
+		if err != nil {
+			return errs.Wrap("invalid registry alias", err)
+		}
+
+		if !seen[alias] {
+			seen[alias] = true
+			aliases = append(aliases, alias)
+		}
+	}
+
+	injection.ExternalDNS = host
+	injection.Aliases = aliases
+
+	return nil
+}
+
+// hostsDiffer checks whether the registry hosts of the CertInjection differ from the normalized ones extracted.
+// The hosts of the CertInjection are normalized in the same way first, then the ones normalized by the webhook
+// are not taken as changed on every reconcile.
+func hostsDiffer(spec *v1alpha1.CertInjectionSpec, injection *mytypes.Injection) bool {
+	current := &mytypes.Injection{
+		ExternalDNS: spec.ExternalDNS,
+		Aliases:     spec.Aliases,
+	}
+
+	if err := normalizeHosts(current); err != nil {
+		return true
+	}
+
+	return current.ExternalDNS != injection.ExternalDNS || !equality.Semantic.DeepEqual(current.Aliases, injection.Aliases)
+}
@@ -0,0 +1,82 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injection
+
+import (
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+)
+
+func TestHostsDiffer(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    v1alpha1.CertInjectionSpec
+		hosts   []string
+		changed bool
+	}{
+		{
+			name:  "same hosts",
+			spec:  v1alpha1.CertInjectionSpec{ExternalDNS: "harbor.example.com", Aliases: []string{"notary.example.com"}},
+			hosts: []string{"harbor.example.com", "notary.example.com"},
+		},
+		{
+			name:  "extracted with scheme and upper case",
+			spec:  v1alpha1.CertInjectionSpec{ExternalDNS: "harbor.example.com:8443"},
+			hosts: []string{"https://Harbor.Example.com:8443/"},
+		},
+		{
+			name:  "spec not normalized yet",
+			spec:  v1alpha1.CertInjectionSpec{ExternalDNS: "https://harbor.example.com/", Aliases: []string{"Notary.example.com"}},
+			hosts: []string{"harbor.example.com", "notary.example.com"},
+		},
+		{
+			name:  "duplicated aliases",
+			spec:  v1alpha1.CertInjectionSpec{ExternalDNS: "harbor.example.com"},
+			hosts: []string{"harbor.example.com", "https://harbor.example.com"},
+		},
+		{
+			name:    "host changed",
+			spec:    v1alpha1.CertInjectionSpec{ExternalDNS: "harbor.example.com"},
+			hosts:   []string{"core.example.com"},
+			changed: true,
+		},
+		{
+			name:    "alias added",
+			spec:    v1alpha1.CertInjectionSpec{ExternalDNS: "harbor.example.com"},
+			hosts:   []string{"harbor.example.com", "notary.example.com"},
+			changed: true,
+		},
+		{
+			name:    "new cert injection",
+			hosts:   []string{"harbor.example.com"},
+			changed: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			injection := &mytypes.Injection{ExternalDNS: c.hosts[0], Aliases: c.hosts[1:]}
+			if err := normalizeHosts(injection); err != nil {
+				t.Fatalf("normalize hosts: %v", err)
+			}
+
+			if got := hostsDiffer(&c.spec, injection); got != c.changed {
+				t.Fatalf("expected changed %v, got %v", c.changed, got)
+			}
+		})
+	}
+}
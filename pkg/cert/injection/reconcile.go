@@ -17,6 +17,8 @@ package injection
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
 
@@ -25,19 +27,24 @@ import (
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/extractor"
 	"github.com/szlabs/harbor-cert-injector/pkg/cert/secret"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	"github.com/szlabs/harbor-cert-injector/pkg/metrics"
 	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/tools/reference"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 const (
 	caInjectionNamePrefix = "ca-injection"
+	unknownKind           = "Unknown"
 )
 
 // ObjectFactoryFunc for newing a typed object
@@ -61,6 +68,8 @@ type ReconcilerBuilder interface {
 	WithLogger(logger logr.Logger) ReconcilerBuilder
 	// UseClient sets client.
 	UseClient(client client.Client) ReconcilerBuilder
+	// WithRecorder sets the event recorder.
+	WithRecorder(recorder record.EventRecorder) ReconcilerBuilder
 	// Reconciler returns the ready Reconciler.
 	Reconciler() Reconciler
 }
@@ -69,6 +78,7 @@ type commonController struct {
 	client.Client
 	scheme    *runtime.Scheme
 	logger    logr.Logger
+	recorder  record.EventRecorder
 	secretMgr secret.Manager
 }
 
@@ -78,7 +88,13 @@ func NewBuilder() ReconcilerBuilder {
 }
 
 // Reconcile implements Reconciler.
-func (cc *commonController) Reconcile(ctx context.Context, name types.NamespacedName, objFacFunc ObjectFactoryFunc) error {
+func (cc *commonController) Reconcile(ctx context.Context, name types.NamespacedName, objFacFunc ObjectFactoryFunc) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ReconcileDuration.WithLabelValues(cc.sourceKind(objFacFunc), metrics.Result(err)).
+			Observe(time.Since(start).Seconds())
+	}()
+
 	if err := cc.validate(); err != nil {
 		return errs.Wrap("common reconciler", err)
 	}
@@ -104,9 +120,34 @@ func (cc *commonController) Reconcile(ctx context.Context, name types.Namespaced
 	}
 
 	// Extract cert injection data from the target object for latter usage.
-	GVK := target.GetObjectKind().GroupVersionKind()
-	injection, err := extractor.Providers(cc.Client).Get(GVK.String()).Extract(ctx, target)
+	// The GVK is resolved by the scheme as the TypeMeta of the typed objects may be cleared.
+	GVK, err := apiutil.GVKForObject(target, cc.scheme)
+	if err != nil {
+		return errs.Wrap("failed to get the GVK of the target resource", err)
+	}
+
+	provider := extractor.Providers(cc.Client).Get(GVK.String())
+	if provider == nil {
+		return errs.Errorf("no extractor provider found for %s", GVK)
+	}
+
+	injection, err := provider.Extract(ctx, target)
 	if err != nil {
+		if errs.IsTLSNotEnabledError(err) {
+			cc.event(target, corev1.EventTypeNormal, mytypes.EventReasonTLSNotEnabled, "Skip injecting the CA as TLS is not enabled")
+		} else {
+			metrics.ExtractErrors.WithLabelValues(GVK.Kind).Inc()
+			cc.event(target, corev1.EventTypeWarning, mytypes.EventReasonExtractFailed, "Failed to extract the CA: %s", err)
+		}
+
+		return errs.Wrap("extract cert data error", err)
+	}
+
+	// The hosts are verified and compared with the ones of the CertInjection in the normalized form.
+	if err := normalizeHosts(injection); err != nil {
+		metrics.ExtractErrors.WithLabelValues(GVK.Kind).Inc()
+		cc.event(target, corev1.EventTypeWarning, mytypes.EventReasonExtractFailed, "Failed to extract the CA: %s", err)
+
 		return errs.Wrap("extract cert data error", err)
 	}
 
@@ -119,13 +160,33 @@ func (cc *commonController) Reconcile(ctx context.Context, name types.Namespaced
 		return errs.Wrap("unable to list underlying cert injections", err)
 	}
 
+	// Verify the CA before it reaches the nodes, the CA injected before is kept if it fails.
+	verified, skipped := verifyCA(injection)
+	if len(skipped) > 0 {
+		cc.event(target, corev1.EventTypeWarning, mytypes.EventReasonCAVerifyFailed,
+			"Aliases are not injected as the server certificate is not valid for them: %s", strings.Join(skipped, ", "))
+	}
+
+	if verified.Status == corev1.ConditionFalse {
+		cc.event(target, corev1.EventTypeWarning, mytypes.EventReasonCAVerifyFailed,
+			"CA is not injected as it fails the verification: %s", verified.Message)
+
+		if len(ciList.Items) != 0 {
+			if err := cc.recordVerification(ctx, &ciList.Items[0], verified); err != nil {
+				return err
+			}
+		}
+
+		return errs.Errorf("CA verification failed: %s", verified.Message)
+	}
+
 	var certInjection *v1alpha1.CertInjection
 	if len(ciList.Items) != 0 {
 		certInjection = &ciList.Items[0]
 	} else {
 		cc.logger.Info("Create new as underlying cert injection not found")
 		// Not found and create a new CR.
-		cij, err := cc.createCertInjectionCR(target)
+		cij, err := cc.createCertInjectionCR(target, GVK)
 		if err != nil {
 			return errs.Wrap("failed to create CertInjection CR", err)
 		}
@@ -142,17 +203,33 @@ func (cc *commonController) Reconcile(ctx context.Context, name types.Namespaced
 
 	cc.logger.V(5).Info("Handle CA secret", "secret reference", secretRef)
 
-	// Secret has been changed (created or updated).
-	if secretRef.Name != "" {
+	// Secret has been changed (created or updated) or the registry hosts have been changed.
+	secretChanged := secretRef.Name != ""
+	hostsChanged := hostsDiffer(&certInjection.Spec, injection)
+	// The source secrets are recorded, then the source is reconciled again when any of them is rotated.
+	sourceSecrets := controller.FormatSourceSecrets(injection.SourceSecrets)
+	sourceSecretsChanged := certInjection.GetAnnotations()[mytypes.SourceSecretsAnnotationKey] != sourceSecrets
+	if secretChanged || hostsChanged || sourceSecretsChanged {
 		isCreate := certInjection.Spec.ExternalDNS == ""
 
-		cc.logger.Info("Source CA secret has changes", "isCreate", isCreate)
+		cc.logger.Info("Source CA secret or registry hosts have changes", "isCreate", isCreate)
 
 		// Set the spec.
 		certInjection.Spec.ExternalDNS = injection.ExternalDNS
-		certInjection.Spec.CertSecret = secretRef
+		certInjection.Spec.Aliases = injection.Aliases
+		if secretChanged {
+			certInjection.Spec.CertSecret = secretRef
+		}
+		if certInjection.Annotations == nil {
+			certInjection.Annotations = make(map[string]string)
+		}
 		// Update the last-update timestamp.
 		certInjection.Annotations[mytypes.LastUpdateTimestampAnnotationKey] = fmt.Sprintf("%s", metav1.NowMicro())
+		if sourceSecrets != "" {
+			certInjection.Annotations[mytypes.SourceSecretsAnnotationKey] = sourceSecrets
+		} else {
+			delete(certInjection.Annotations, mytypes.SourceSecretsAnnotationKey)
+		}
 
 		// Update the status condition.
 		for _, c := range certInjection.Status.Conditions {
@@ -170,13 +247,15 @@ func (cc *commonController) Reconcile(ctx context.Context, name types.Namespaced
 			}
 
 			cc.logger.Info("Cert injection is created", "name", certInjection.GetName())
+			cc.event(target, corev1.EventTypeNormal, mytypes.EventReasonCertInjectionCreated,
+				"Cert injection %s is created for registry %s", certInjection.GetName(), injection.ExternalDNS)
 
 			// Set owner reference to the created CA secret.
 			if err := cc.secretMgr.AssignOwner(ctx, certInjection, secretRef); err != nil {
 				return errs.Wrap("failed to assign owner to secret", err)
 			}
 
-			return nil
+			return cc.recordVerification(ctx, certInjection, verified)
 		}
 
 		// Need to update the CertInjection CR.
@@ -185,9 +264,15 @@ func (cc *commonController) Reconcile(ctx context.Context, name types.Namespaced
 		}
 
 		cc.logger.Info("Cert injection is updated", "name", certInjection.GetName())
+
+		if secretChanged {
+			msgFmt := "CA secret %s is rotated as the CA of the source is changed"
+			cc.event(target, corev1.EventTypeNormal, mytypes.EventReasonCASecretRotated, msgFmt, secretRef.Name)
+			cc.event(certInjection, corev1.EventTypeNormal, mytypes.EventReasonCASecretRotated, msgFmt, secretRef.Name)
+		}
 	}
 
-	return nil
+	return cc.recordVerification(ctx, certInjection, verified)
 }
 
 // WithScheme implements ReconcilerBuilder.
@@ -214,6 +299,12 @@ func (cc *commonController) UseClient(client client.Client) ReconcilerBuilder {
 	return cc
 }
 
+// WithRecorder implements ReconcilerBuilder.
+func (cc *commonController) WithRecorder(recorder record.EventRecorder) ReconcilerBuilder {
+	cc.recorder = recorder
+	return cc
+}
+
 // Reconciler implements ReconcilerBuilder.
 func (cc *commonController) Reconciler() Reconciler {
 	if cc.secretMgr == nil {
@@ -225,6 +316,27 @@ func (cc *commonController) Reconciler() Reconciler {
 	return cc
 }
 
+// event records the event if the recorder is set.
+func (cc *commonController) event(obj runtime.Object, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if cc.recorder != nil {
+		cc.recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+	}
+}
+
+// sourceKind returns the kind of the objects created by the factory func.
+func (cc *commonController) sourceKind(objFacFunc ObjectFactoryFunc) string {
+	if objFacFunc == nil || cc.scheme == nil {
+		return unknownKind
+	}
+
+	gvk, err := apiutil.GVKForObject(objFacFunc(), cc.scheme)
+	if err != nil {
+		return unknownKind
+	}
+
+	return gvk.Kind
+}
+
 func (cc *commonController) validate() error {
 	if cc.Client == nil {
 		return errs.New("missing client")
@@ -241,7 +353,7 @@ func (cc *commonController) validate() error {
 	return nil
 }
 
-func (cc *commonController) createCertInjectionCR(target client.Object) (*v1alpha1.CertInjection, error) {
+func (cc *commonController) createCertInjectionCR(target client.Object, gvk schema.GroupVersionKind) (*v1alpha1.CertInjection, error) {
 	targetREF, err := reference.GetReference(cc.scheme, target)
 	if err != nil {
 		return nil, errs.Wrap("get object reference error", err)
@@ -259,7 +371,7 @@ func (cc *commonController) createCertInjectionCR(target client.Object) (*v1alph
 				mytypes.LastUpdateTimestampAnnotationKey: metav1.NowMicro().String(),
 			},
 			Labels: map[string]string{
-				mytypes.OwnerGVKLabel:  controller.FormatGVKToLabelValue(target.GetObjectKind().GroupVersionKind()),
+				mytypes.OwnerGVKLabel:  controller.FormatGVKToLabelValue(gvk),
 				mytypes.OwnerNameLabel: target.GetName(),
 			},
 		},
@@ -0,0 +1,173 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injection
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ReasonCAVerified ...
+	ReasonCAVerified = "Verified"
+	// ReasonInvalidCA ...
+	ReasonInvalidCA = "InvalidCA"
+	// ReasonChainNotTrusted ...
+	ReasonChainNotTrusted = "ChainNotTrusted"
+	// ReasonHostnameMismatch ...
+	ReasonHostnameMismatch = "HostnameMismatch"
+	// ReasonNoServerCert ...
+	ReasonNoServerCert = "NoServerCert"
+)
+
+// verifyCA checks the extracted CA before it reaches the nodes and returns the CAVerified condition.
+// The CA must contain CA certificates, and the server certificate of the source, if any, must be issued by the CA
+// for the registry host. The condition is unknown if the source has no server certificate.
+// The aliases the server certificate is not valid for are dropped from the injection and returned,
+// they don't block the CA of the registry host.
+func verifyCA(injection *mytypes.Injection) (v1alpha1.CertInjectionCondition, []string) {
+	condition := v1alpha1.CertInjectionCondition{
+		Type:   mytypes.ConditionCAVerified,
+		Status: corev1.ConditionFalse,
+	}
+
+	// A leaf certificate set as the CA is rejected here.
+	if err := certutil.ValidateCA(injection.CACert); err != nil {
+		condition.Reason = ReasonInvalidCA
+		condition.Message = err.Error()
+
+		return condition, nil
+	}
+
+	if len(injection.ServerCert) == 0 {
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = ReasonNoServerCert
+		condition.Message = "No server certificate in the source to verify the CA against"
+
+		return condition, nil
+	}
+
+	leaf, err := verifyChain(injection.CACert, injection.ServerCert)
+	if err != nil {
+		condition.Reason = ReasonChainNotTrusted
+		condition.Message = err.Error()
+
+		return condition, nil
+	}
+
+	if err := verifyHostname(leaf, injection.ExternalDNS); err != nil {
+		condition.Reason = ReasonHostnameMismatch
+		condition.Message = fmt.Sprintf("server certificate is not valid for registry %s: %s", injection.ExternalDNS, err)
+
+		return condition, nil
+	}
+
+	var aliases, skipped []string
+	for _, a := range injection.Aliases {
+		if err := verifyHostname(leaf, a); err != nil {
+			skipped = append(skipped, a)
+			continue
+		}
+
+		aliases = append(aliases, a)
+	}
+	injection.Aliases = aliases
+
+	condition.Status = corev1.ConditionTrue
+	condition.Reason = ReasonCAVerified
+	condition.Message = fmt.Sprintf("CA verifies the server certificate of registry %s",
+		strings.Join(append([]string{injection.ExternalDNS}, aliases...), ", "))
+	if len(skipped) > 0 {
+		condition.Message = fmt.Sprintf("%s, aliases not covered by the server certificate are skipped: %s",
+			condition.Message, strings.Join(skipped, ", "))
+	}
+
+	return condition, skipped
+}
+
+// verifyHostname checks the leaf is valid for the registry host in the host[:port] form.
+func verifyHostname(leaf *x509.Certificate, host string) error {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	// The IPv6 address without port is still in the brackets.
+	return leaf.VerifyHostname(strings.Trim(host, "[]"))
+}
+
+// verifyChain verifies the server certificate chain against the pool of the CA, and returns the leaf.
+// The chain is verified at a time the leaf is valid, as the expiry is not a fault of the CA.
+func verifyChain(ca []byte, serverCert []byte) (*x509.Certificate, error) {
+	roots, err := certutil.ParseCertificates(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, c := range roots {
+		pool.AddCert(c)
+	}
+
+	chain, err := certutil.ParseCertificates(serverCert)
+	if err != nil {
+		return nil, errs.Wrap("invalid server certificate", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	leaf := chain[0]
+	at := time.Now()
+	if at.Before(leaf.NotBefore) || at.After(leaf.NotAfter) {
+		at = leaf.NotBefore
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+	}); err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("server certificate %q is not issued by the CA", leaf.Subject.String()), err)
+	}
+
+	return leaf, nil
+}
+
+// recordVerification sets the CAVerified condition of the cert injection.
+func (cc *commonController) recordVerification(ctx context.Context, certInjection *v1alpha1.CertInjection,
+	condition v1alpha1.CertInjectionCondition) error {
+	if !certInjection.Status.SetCondition(condition) {
+		return nil
+	}
+
+	if err := cc.Status().Update(ctx, certInjection); err != nil {
+		return errs.Wrap("failed to update the CAVerified condition of cert injection", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injection
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/internal/certtest"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestVerifyCA(t *testing.T) {
+	now := time.Now()
+
+	root, rootKey := certtest.NewCA(t, "root", now.Add(-72*time.Hour), nil, nil)
+	intermediate, intermediateKey := certtest.NewCA(t, "intermediate", now.Add(-72*time.Hour), root, rootKey)
+	other, _ := certtest.NewCA(t, "other", now.Add(-72*time.Hour), nil, nil)
+
+	dnsLeaf, _ := certtest.NewLeaf(t, root, rootKey, now.Add(-time.Hour), now.Add(time.Hour), "harbor.example.com", "notary.example.com")
+	expiredLeaf, _ := certtest.NewLeaf(t, root, rootKey, now.Add(-48*time.Hour), now.Add(-24*time.Hour), "harbor.example.com")
+	ipLeaf, _ := certtest.NewLeaf(t, root, rootKey, now.Add(-time.Hour), now.Add(time.Hour), "10.0.0.1", "::1")
+	chainLeaf, _ := certtest.NewLeaf(t, intermediate, intermediateKey, now.Add(-time.Hour), now.Add(time.Hour), "harbor.example.com")
+
+	cases := []struct {
+		name       string
+		ca         []byte
+		serverCert []byte
+		host       string
+		aliases    []string
+		status     corev1.ConditionStatus
+		reason     string
+		injected   []string
+		skipped    []string
+	}{
+		{
+			name:       "valid chain",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "harbor.example.com",
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+		},
+		{
+			name:       "valid chain with intermediate",
+			ca:         certtest.Encode(root),
+			serverCert: append(certtest.Encode(chainLeaf), certtest.Encode(intermediate)...),
+			host:       "harbor.example.com",
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+		},
+		{
+			name:       "wrong CA",
+			ca:         certtest.Encode(other),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "harbor.example.com",
+			status:     corev1.ConditionFalse,
+			reason:     ReasonChainNotTrusted,
+		},
+		{
+			name:       "missing intermediate",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(chainLeaf),
+			host:       "harbor.example.com",
+			status:     corev1.ConditionFalse,
+			reason:     ReasonChainNotTrusted,
+		},
+		{
+			name:       "expired leaf",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(expiredLeaf),
+			host:       "harbor.example.com",
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+		},
+		{
+			name:       "host with port",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "harbor.example.com:8443",
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+		},
+		{
+			name:       "IP host",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(ipLeaf),
+			host:       "10.0.0.1",
+			aliases:    []string{"10.0.0.1:8443", "[::1]", "[::1]:8443"},
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+			injected:   []string{"10.0.0.1:8443", "[::1]", "[::1]:8443"},
+		},
+		{
+			name:       "hostname mismatch",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "core.example.com",
+			status:     corev1.ConditionFalse,
+			reason:     ReasonHostnameMismatch,
+		},
+		{
+			name:       "valid aliases",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "harbor.example.com",
+			aliases:    []string{"notary.example.com:443"},
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+			injected:   []string{"notary.example.com:443"},
+		},
+		{
+			name:       "alias mismatch skipped",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "harbor.example.com",
+			aliases:    []string{"notary.example.com", "core.example.com"},
+			status:     corev1.ConditionTrue,
+			reason:     ReasonCAVerified,
+			injected:   []string{"notary.example.com"},
+			skipped:    []string{"core.example.com"},
+		},
+		{
+			name:       "host mismatch with valid aliases",
+			ca:         certtest.Encode(root),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "core.example.com",
+			aliases:    []string{"harbor.example.com"},
+			status:     corev1.ConditionFalse,
+			reason:     ReasonHostnameMismatch,
+		},
+		{
+			name:       "leaf as CA",
+			ca:         certtest.Encode(dnsLeaf),
+			serverCert: certtest.Encode(dnsLeaf),
+			host:       "harbor.example.com",
+			status:     corev1.ConditionFalse,
+			reason:     ReasonInvalidCA,
+		},
+		{
+			name:   "no server certificate",
+			ca:     certtest.Encode(root),
+			host:   "harbor.example.com",
+			status: corev1.ConditionUnknown,
+			reason: ReasonNoServerCert,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			injection := &mytypes.Injection{
+				ExternalDNS: c.host,
+				Aliases:     c.aliases,
+				CACert:      c.ca,
+				ServerCert:  c.serverCert,
+			}
+			condition, skipped := verifyCA(injection)
+
+			if condition.Type != mytypes.ConditionCAVerified {
+				t.Fatalf("expected condition %s, got %s", mytypes.ConditionCAVerified, condition.Type)
+			}
+
+			if condition.Status != c.status || condition.Reason != c.reason {
+				t.Fatalf("expected %s/%s, got %s/%s: %s", c.status, c.reason, condition.Status, condition.Reason, condition.Message)
+			}
+
+			if c.status == corev1.ConditionTrue && !reflect.DeepEqual(injection.Aliases, c.injected) {
+				t.Fatalf("expected aliases %v injected, got %v", c.injected, injection.Aliases)
+			}
+
+			if !reflect.DeepEqual(skipped, c.skipped) {
+				t.Fatalf("expected aliases %v skipped, got %v", c.skipped, skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	cleanerDsNamePrefix = "cert-cleanup-ds"
+	cleanerRole         = "cleaner"
+)
+
+// Cleanup implements injector.Provider.
+func (p *provider) Cleanup(ctx context.Context, injection *v1alpha1.CertInjection) (bool, error) {
+	if injection == nil {
+		return false, errs.New("nil cert injection obj")
+	}
+
+	dsList := &appv1.DaemonSetList{}
+	if err := p.List(ctx, dsList, client.InNamespace(injection.Namespace), client.MatchingLabels{
+		mytypes.OwnerGVKLabel:  ownerGVKLabelValue(),
+		mytypes.OwnerNameLabel: injection.GetName(),
+	}); err != nil {
+		return false, errs.Wrap("failed to list the underlying ds resources", err)
+	}
+
+	// Remove the injectors first to avoid the files being copied again.
+	cleaners := make(map[string]*appv1.DaemonSet)
+	for i := range dsList.Items {
+		ds := &dsList.Items[i]
+		if ds.Labels[mytypes.InjectorRoleLabel] == cleanerRole {
+			cleaners[ds.Name] = ds
+			continue
+		}
+
+		if err := p.Delete(ctx, ds); client.IgnoreNotFound(err) != nil {
+			return false, errs.Wrap("failed to delete injector ds", err)
+		}
+	}
+
+	groups, err := p.runtimeGroups(ctx, injection)
+	if err != nil {
+		return false, err
+	}
+
+	done := true
+	for _, g := range groups {
+		desired := p.desiredCleaner(injection, g.runtime, g.restricted)
+
+		ds, ok := cleaners[desired.Name]
+		if !ok {
+			if err := controllerutil.SetOwnerReference(injection, desired, p.scheme); err != nil {
+				return false, errs.Wrap("failed to set owner reference of cleaner ds", err)
+			}
+
+			if err := p.Create(ctx, desired); err != nil {
+				if isNamespaceTerminating(err) {
+					p.event(injection, corev1.EventTypeWarning, mytypes.EventReasonCleanupSkipped,
+						"Injected files are left on the nodes as the namespace is terminating")
+					return true, nil
+				}
+
+				return false, errs.Wrap("failed to create cleaner ds", err)
+			}
+
+			p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonCleanupStarted,
+				"Cleaner %s is created to remove the injected files from the nodes", desired.Name)
+
+			done = false
+			continue
+		}
+
+		cleaned, err := p.cleanedUp(ctx, ds)
+		if err != nil {
+			return false, err
+		}
+
+		if !cleaned {
+			done = false
+		}
+	}
+
+	if !done {
+		return false, nil
+	}
+
+	// All the nodes have been cleaned up.
+	for _, ds := range cleaners {
+		if err := p.Delete(ctx, ds); client.IgnoreNotFound(err) != nil {
+			return false, errs.Wrap("failed to delete cleaner ds", err)
+		}
+	}
+
+	p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonCleanupCompleted, "Injected files have been removed from all the nodes")
+
+	return true, nil
+}
+
+// desiredCleaner renders the ds removing the injected files from the nodes of the container runtime.
+func (p *provider) desiredCleaner(injection *v1alpha1.CertInjection, runtime v1alpha1.ContainerRuntime, restricted bool) *appv1.DaemonSet {
+	name := runtimeDsName(cleanerDsNamePrefix, injection.Name, runtime, restricted)
+
+	podSpec := agentPodSpec(injection, runtime, true)
+	// The cleaner reports ready after the injected files are removed.
+	podSpec.Containers[0].ReadinessProbe = agentProbe("/readyz", 5)
+	podSpec.Affinity = runtimeAffinity(podSpec.Affinity, runtime, restricted)
+
+	return &appv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: injection.Namespace,
+			Labels: map[string]string{
+				"k8s-app":                     "cert-auto-injector",
+				mytypes.OwnerGVKLabel:         ownerGVKLabelValue(),
+				mytypes.OwnerNameLabel:        injection.GetName(),
+				mytypes.ContainerRuntimeLabel: strings.ToLower(string(runtime)),
+				mytypes.InjectorRoleLabel:     cleanerRole,
+			},
+		},
+		Spec: appv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": name,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"name": name,
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// isRolledOut checks whether the pods of the ds are ready on all the scheduled nodes.
+func isRolledOut(ds *appv1.DaemonSet) bool {
+	return ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberReady == ds.Status.DesiredNumberScheduled
+}
+
+// cleanedUp checks whether the pods of the ds are ready on all the ready and schedulable nodes.
+// The nodes not ready or unschedulable may never run the pods, then they're not waited for.
+func (p *provider) cleanedUp(ctx context.Context, ds *appv1.DaemonSet) (bool, error) {
+	if isRolledOut(ds) {
+		return true, nil
+	}
+
+	if ds.Status.ObservedGeneration < ds.Generation {
+		return false, nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := p.List(ctx, pods, client.InNamespace(ds.Namespace), client.MatchingLabels(ds.Spec.Selector.MatchLabels)); err != nil {
+		return false, errs.Wrap("failed to list the cleaner pods", err)
+	}
+
+	// The pods are not created yet.
+	if int32(len(pods.Items)) < ds.Status.DesiredNumberScheduled {
+		return false, nil
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if isPodReady(pod) {
+			continue
+		}
+
+		node := &corev1.Node{}
+		if err := p.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, node); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			return false, errs.Wrap("failed to get the node of the cleaner pod", err)
+		}
+
+		if isNodeAvailable(node) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// isNodeAvailable checks whether the node is ready and schedulable.
+func isNodeAvailable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// isNamespaceTerminating checks whether the object is forbidden to be created as the namespace is terminating.
+func isNamespaceTerminating(err error) bool {
+	return apierrors.IsForbidden(err) && apierrors.HasStatusCause(err, corev1.NamespaceTerminatingCause)
+}
@@ -0,0 +1,160 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"testing"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestCleanupUnavailableNodes checks the cleanup doesn't wait for the nodes not ready or unschedulable.
+func TestCleanupUnavailableNodes(t *testing.T) {
+	notReady := newNode("node-2")
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+
+	unschedulable := newNode("node-2")
+	unschedulable.Spec.Unschedulable = true
+
+	cases := []struct {
+		name string
+		node *corev1.Node
+		done bool
+	}{
+		{name: "ready node", node: newNode("node-2")},
+		{name: "node not ready", node: notReady, done: true},
+		{name: "unschedulable node", node: unschedulable, done: true},
+		{name: "node removed", done: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			scheme := newScheme(t)
+
+			injection := newInjection()
+			objs := []client.Object{injection, newNode("node-1")}
+			if c.node != nil {
+				objs = append(objs, c.node)
+			}
+
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+			p := NewDaemonSetProvider(cl, scheme, nil)
+
+			// The cleaner is created.
+			if done, err := p.Cleanup(ctx, injection); err != nil || done {
+				t.Fatalf("expected cleanup not done, got %v, %v", done, err)
+			}
+
+			ds := &appv1.DaemonSet{}
+			if err := cl.Get(ctx, client.ObjectKey{
+				Namespace: injection.Namespace,
+				Name:      runtimeDsName(cleanerDsNamePrefix, injection.Name, injection.Spec.ContainerRuntime, false),
+			}, ds); err != nil {
+				t.Fatalf("get cleaner: %v", err)
+			}
+
+			// The pod on node-2 never gets ready.
+			ds.Status = appv1.DaemonSetStatus{
+				ObservedGeneration:     ds.Generation,
+				DesiredNumberScheduled: 2,
+				UpdatedNumberScheduled: 2,
+				NumberReady:            1,
+			}
+			if err := cl.Status().Update(ctx, ds); err != nil {
+				t.Fatalf("update cleaner status: %v", err)
+			}
+
+			for node, ready := range map[string]corev1.ConditionStatus{"node-1": corev1.ConditionTrue, "node-2": corev1.ConditionFalse} {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: injection.Namespace,
+						Name:      ds.Name + "-" + node,
+						Labels:    ds.Spec.Selector.MatchLabels,
+					},
+					Spec: corev1.PodSpec{NodeName: node},
+					Status: corev1.PodStatus{
+						Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+					},
+				}
+				if err := cl.Create(ctx, pod); err != nil {
+					t.Fatalf("create pod: %v", err)
+				}
+			}
+
+			done, err := p.Cleanup(ctx, injection)
+			if err != nil {
+				t.Fatalf("cleanup: %v", err)
+			}
+
+			if done != c.done {
+				t.Fatalf("expected cleanup done %v, got %v", c.done, done)
+			}
+		})
+	}
+}
+
+// terminatingClient forbids creating objects as the namespace is terminating.
+type terminatingClient struct {
+	client.Client
+}
+
+func (c *terminatingClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	err := apierrors.NewForbidden(schema.GroupResource{Resource: "daemonsets"}, obj.GetName(), nil)
+	err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: corev1.NamespaceTerminatingCause}}
+
+	return err
+}
+
+// TestCleanupNamespaceTerminating checks the cleanup is done when the cleaners can't be created in the terminating
+// namespace, and it fails with the other forbidden errors.
+func TestCleanupNamespaceTerminating(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newInjection()
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection, newNode("node-1")).Build()
+
+	for _, p := range []Provider{
+		NewDaemonSetProvider(&terminatingClient{Client: cl}, scheme, nil),
+		NewJobProvider(&terminatingClient{Client: cl}, scheme, nil),
+	} {
+		done, err := p.Cleanup(ctx, injection)
+		if err != nil || !done {
+			t.Fatalf("expected cleanup done, got %v, %v", done, err)
+		}
+	}
+
+	forbidden := &forbiddenClient{Client: cl}
+	if _, err := NewDaemonSetProvider(forbidden, scheme, nil).Cleanup(ctx, injection); err == nil {
+		t.Fatal("expected the forbidden error")
+	}
+}
+
+// forbiddenClient forbids creating objects for the other causes.
+type forbiddenClient struct {
+	client.Client
+}
+
+func (c *forbiddenClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	return apierrors.NewForbidden(schema.GroupResource{Resource: "daemonsets"}, obj.GetName(), nil)
+}
@@ -17,6 +17,7 @@ package injector
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/szlabs/harbor-cert-injector/pkg/controller"
 
@@ -26,21 +27,26 @@ import (
 
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/tools/reference"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 const (
-	injectorImage       = "ghcr.io/szlabs/busybox:v0.0.0-20220402"
-	compatibleCertsPath = "/etc/docker/certs.d"
-	caMountPath         = "/tmp"
-	dsNamePrefix        = "cert-injection-ds"
+	agentCmd  = "/agent"
+	agentPort = 8081
 	// Containerd also supports Docker's Certificate File Pattern.
 	// Check details here: https://github.com/containerd/containerd/blob/main/docs/hosts.md#support-for-dockers-certificate-file-pattern
-	cmdArgPattern = `cp %s/ca-cert /etc/docker/certs.d/%s/ca.crt && exec tail -f /dev/null`
+	compatibleCertsPath = "/etc/docker/certs.d"
+	caMountPath         = "/etc/harbor-cert-injector/ca"
+	caFileName          = "ca.crt"
+	dsNamePrefix        = "cert-injection-ds"
+	injectorRole        = "injector"
 )
 
 var terminationGracePeriodSeconds int64 = 30
@@ -48,14 +54,23 @@ var terminationGracePeriodSeconds int64 = 30
 // provider for doing injection through daemon set.
 type provider struct {
 	client.Client
-	scheme *runtime.Scheme
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+func init() {
+	Register(DaemonSetStrategy, func(opts *Options) Provider {
+		return NewDaemonSetProvider(opts.Client, opts.Scheme, opts.Recorder)
+	})
 }
 
 // NewDaemonSetProvider news a daemonset provider.
-func NewDaemonSetProvider(client client.Client, scheme *runtime.Scheme) Provider {
+// The recorder is optional, no event is recorded if it's nil.
+func NewDaemonSetProvider(client client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) Provider {
 	return &provider{
-		Client: client,
-		scheme: scheme,
+		Client:   client,
+		scheme:   scheme,
+		recorder: recorder,
 	}
 }
 
@@ -65,55 +80,186 @@ func (p *provider) Inject(ctx context.Context, injection *v1alpha1.CertInjection
 		return errs.New("nil cert injection obj")
 	}
 
-	dsCR := p.DesiredInjector(injection)
+	desired, err := p.desiredDaemonSets(ctx, injection)
+	if err != nil {
+		return errs.Wrap("failed to get desired injectors", err)
+	}
 
-	// Set owner reference.
-	if err := controllerutil.SetOwnerReference(injection, dsCR, p.scheme); err != nil {
-		return errs.Wrap("failed to set owner reference of ds", err)
+	// List the existing injectors.
+	existing, err := p.listInjectors(ctx, injection)
+	if err != nil {
+		return err
 	}
 
-	// Create the ds now.
-	if err := p.Create(ctx, dsCR); err != nil {
-		return errs.Wrap("failed to create ds", err)
+	var refs []corev1.ObjectReference
+	for _, dsCR := range desired {
+		if ds, ok := existing[dsCR.Name]; ok {
+			delete(existing, dsCR.Name)
+
+			if err := p.update(ctx, injection, ds, dsCR); err != nil {
+				return err
+			}
+
+			dsCR = ds
+		} else {
+			// Set owner reference.
+			// Use the controller reference, then the status changes of ds trigger the reconciling of the injection.
+			if err := controllerutil.SetControllerReference(injection, dsCR, p.scheme); err != nil {
+				return errs.Wrap("failed to set owner reference of ds", err)
+			}
+
+			// Create the ds now.
+			if err := p.Create(ctx, dsCR); err != nil {
+				return errs.Wrap("failed to create ds", err)
+			}
+
+			p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonInjectorCreated, "Injector %s is created", dsCR.Name)
+		}
+
+		// Get the object reference.
+		objRef, err := reference.GetReference(p.scheme, dsCR)
+		if err != nil {
+			return errs.Wrap("failed to get ds reference", err)
+		}
+
+		refs = append(refs, *objRef)
 	}
 
-	// Get the object reference.
-	objRef, err := reference.GetReference(p.scheme, dsCR)
+	// Remove the injectors of the container runtimes which are no longer in use.
+	for _, ds := range existing {
+		if err := p.Delete(ctx, ds); client.IgnoreNotFound(err) != nil {
+			return errs.Wrap("failed to delete stale ds", err)
+		}
+
+		p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonInjectorDeleted, "Stale injector %s is deleted", ds.Name)
+	}
+
+	p.setInjectors(injection, refs)
+
+	return nil
+}
+
+// Observe implements injector.Provider.
+func (p *provider) Observe(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	existing, err := p.listInjectors(ctx, injection)
 	if err != nil {
-		return errs.Wrap("failed to get ds reference", err)
+		return err
 	}
 
-	injection.Status.Injector = objRef
-	injection.Status.Conditions = append(injection.Status.Conditions, v1alpha1.CertInjectionCondition{
-		Type:    mytypes.ConditionInjector,
-		Status:  corev1.ConditionTrue,
-		Message: "Injector has been created",
-	})
-	if err := p.Status().Update(ctx, injection); err != nil {
-		return errs.Wrap("update status of cert injection error", err)
+	injectors := make([]*appv1.DaemonSet, 0, len(existing))
+	for _, ds := range existing {
+		injectors = append(injectors, ds)
 	}
 
-	return nil
+	return p.observeNodes(ctx, injection, injectors)
 }
 
-// DesiredInjector implements injector.Provider.
-func (p *provider) DesiredInjector(injection *v1alpha1.CertInjection) *appv1.DaemonSet {
+// Release implements injector.Provider.
+func (p *provider) Release(ctx context.Context, injection *v1alpha1.CertInjection) error {
 	if injection == nil {
-		return nil
+		return errs.New("nil cert injection obj")
 	}
 
+	return p.removeOwnInjectors(ctx, injection, fmt.Sprintf("%s injectors", StrategyOf(injection)))
+}
+
+// Watches implements injector.Provider.
+func (p *provider) Watches() []Watch {
+	return []Watch{{Type: &appv1.DaemonSet{}, Owned: true}}
+}
+
+// DependsOnNodes implements injector.Provider.
+// The injectors are restricted to the nodes of each runtime when the runtime is detected from the nodes.
+func (p *provider) DependsOnNodes(injection *v1alpha1.CertInjection) bool {
+	return IsAutoRuntime(injection)
+}
+
+// DesiredInjectors implements injector.Provider.
+func (p *provider) DesiredInjectors(ctx context.Context, injection *v1alpha1.CertInjection) ([]client.Object, error) {
+	dsList, err := p.desiredDaemonSets(ctx, injection)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]client.Object, 0, len(dsList))
+	for _, ds := range dsList {
+		objs = append(objs, ds)
+	}
+
+	return objs, nil
+}
+
+// listInjectors lists the injectors of the injection, keyed by the names. The cleaners are skipped.
+func (p *provider) listInjectors(ctx context.Context, injection *v1alpha1.CertInjection) (map[string]*appv1.DaemonSet, error) {
+	dsList := &appv1.DaemonSetList{}
+	if err := p.List(ctx, dsList, client.InNamespace(injection.Namespace), client.MatchingLabels{
+		mytypes.OwnerGVKLabel:  ownerGVKLabelValue(),
+		mytypes.OwnerNameLabel: injection.GetName(),
+	}); err != nil {
+		return nil, errs.Wrap("failed to list the underlying ds resources", err)
+	}
+
+	existing := make(map[string]*appv1.DaemonSet, len(dsList.Items))
+	for i := range dsList.Items {
+		// Skip the cleaners.
+		if dsList.Items[i].Labels[mytypes.InjectorRoleLabel] == cleanerRole {
+			continue
+		}
+
+		existing[dsList.Items[i].Name] = &dsList.Items[i]
+	}
+
+	return existing, nil
+}
+
+// desiredDaemonSets renders the injectors of the injection, one for each container runtime in use.
+func (p *provider) desiredDaemonSets(ctx context.Context, injection *v1alpha1.CertInjection) ([]*appv1.DaemonSet, error) {
+	if injection == nil {
+		return nil, nil
+	}
+
+	groups, err := p.runtimeGroups(ctx, injection)
+	if err != nil {
+		return nil, err
+	}
+
+	dsList := make([]*appv1.DaemonSet, 0, len(groups))
+	for _, g := range groups {
+		dsList = append(dsList, p.desiredInjector(injection, g.runtime, g.restricted))
+	}
+
+	return dsList, nil
+}
+
+// desiredInjector renders the injector of the container runtime.
+// If restricted, the injector only runs on the nodes of the runtime.
+func (p *provider) desiredInjector(injection *v1alpha1.CertInjection, runtime v1alpha1.ContainerRuntime, restricted bool) *appv1.DaemonSet {
+	name := runtimeDsName(dsNamePrefix, injection.Name, runtime, restricted)
+
+	podSpec := agentPodSpec(injection, runtime, false)
+	// The pod is ready only when the injected files are verified.
+	podSpec.Containers[0].ReadinessProbe = agentProbe("/readyz", 10)
+	podSpec.Containers[0].LivenessProbe = agentProbe("/healthz", 30)
+	podSpec.Affinity = runtimeAffinity(podSpec.Affinity, runtime, restricted)
+
 	return &appv1.DaemonSet{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "DaemonSet",
 			APIVersion: "apps/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      dsName(injection.Name),
+			Name:      name,
 			Namespace: injection.Namespace,
 			Labels: map[string]string{
-				"k8s-app":              "cert-auto-injector",
-				mytypes.OwnerGVKLabel:  controller.FormatGVKToLabelValue(injection.GetObjectKind().GroupVersionKind()),
-				mytypes.OwnerNameLabel: injection.GetName(),
+				"k8s-app":                     "cert-auto-injector",
+				mytypes.OwnerGVKLabel:         ownerGVKLabelValue(),
+				mytypes.OwnerNameLabel:        injection.GetName(),
+				mytypes.ContainerRuntimeLabel: strings.ToLower(string(runtime)),
+				mytypes.InjectorRoleLabel:     injectorRole,
 			},
 			Annotations: map[string]string{
 				mytypes.InjectionVersionAnnotationKey: injection.GetResourceVersion(),
@@ -122,72 +268,292 @@ func (p *provider) DesiredInjector(injection *v1alpha1.CertInjection) *appv1.Dae
 		Spec: appv1.DaemonSetSpec{
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
-					"name": dsName(injection.Name),
+					"name": name,
 				},
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{
-						"name": dsName(injection.Name),
+						"name": name,
 					},
 				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  "cert-injector",
-							Image: injectorImage,
-							Command: []string{
-								"sh",
-							},
-							Args: []string{
-								"-c",
-								cmdArg(injection.Spec.ExternalDNS),
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "compatible-certs-path",
-									MountPath: registryCertPath(injection.Spec.ExternalDNS),
-								},
-								{
-									Name:      "ca-cert",
-									MountPath: caMountPath,
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "compatible-certs-path",
-							VolumeSource: corev1.VolumeSource{
-								HostPath: &corev1.HostPathVolumeSource{
-									Path: registryCertPath(injection.Spec.ExternalDNS),
-								},
-							},
-						},
-						{
-							Name: "ca-cert",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: injection.Spec.CertSecret.Name,
-								},
-							},
-						},
-					},
-					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// agentPodSpec renders the spec of the pod running the agent to inject or clean up the CA on the nodes of the
+// container runtime.
+func agentPodSpec(injection *v1alpha1.CertInjection, runtime v1alpha1.ContainerRuntime, cleanup bool) corev1.PodSpec {
+	// Mount the certs directory of the container runtime at the same path as on the node,
+	// then the agent can remove the stale files and the paths in the hosts.toml are valid on the node.
+	hostPath := certsPath(runtime, injection.Spec.Mode)
+
+	container := corev1.Container{
+		Name: "cert-injector",
+		Command: []string{
+			agentCmd,
+		},
+		Args: agentArgs(injection, runtime, cleanup),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "compatible-certs-path",
+				MountPath: hostPath,
+			},
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "probe",
+				ContainerPort: agentPort,
+			},
+		},
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name: "compatible-certs-path",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: hostPath,
 				},
 			},
 		},
 	}
+
+	if cleanup {
+		container.Name = "cert-cleaner"
+	} else {
+		// The CA files are not needed by the cleaner.
+		caVolumes, caMounts := caSecretVolumes(injection)
+		container.VolumeMounts = append(container.VolumeMounts, caMounts...)
+		volumes = append(volumes, caVolumes...)
+	}
+
+	podSpec := corev1.PodSpec{
+		Containers:                    []corev1.Container{container},
+		Volumes:                       volumes,
+		TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
+	}
+	applyAgentSettings(&podSpec)
+	applyScheduling(&podSpec, schedulingOf(injection))
+
+	return podSpec
+}
+
+func (p *provider) update(ctx context.Context, injection *v1alpha1.CertInjection, ds *appv1.DaemonSet, desired *appv1.DaemonSet) error {
+	oldInjectionV := ds.GetAnnotations()[mytypes.InjectionVersionAnnotationKey]
+	newInjectionV := desired.GetAnnotations()[mytypes.InjectionVersionAnnotationKey]
+	isControlled := metav1.GetControllerOf(ds) != nil
+
+	// If update is needed.
+	// The injectors rendered by the early versions run other images or arguments.
+	if oldInjectionV == newInjectionV && isControlled && sameContainers(ds, desired) &&
+		sameScheduling(&ds.Spec.Template.Spec, &desired.Spec.Template.Spec) &&
+		sameAgentSettings(&ds.Spec.Template.Spec, &desired.Spec.Template.Spec) {
+		return nil
+	}
+
+	ds.Spec = *desired.Spec.DeepCopy()
+	if ds.Annotations == nil {
+		ds.Annotations = make(map[string]string)
+	}
+	ds.Annotations[mytypes.InjectionVersionAnnotationKey] = newInjectionV
+	ds.Labels = desired.Labels
+
+	// The injectors created by the early versions are not controlled by the injection.
+	if err := controllerutil.SetControllerReference(injection, ds, p.scheme); err != nil {
+		return errs.Wrap("failed to set owner reference of ds", err)
+	}
+
+	if err := p.Update(ctx, ds); err != nil {
+		return errs.Wrap("failed to update the underlying ds", err)
+	}
+
+	p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonInjectorUpdated, "Injector %s is updated", ds.Name)
+
+	return nil
+}
+
+// removeOwnInjectors removes the injectors and the cleaners created for the injection.
+func (p *provider) removeOwnInjectors(ctx context.Context, injection *v1alpha1.CertInjection, replacedBy string) error {
+	dsList := &appv1.DaemonSetList{}
+	if err := p.List(ctx, dsList, client.InNamespace(injection.Namespace), client.MatchingLabels{
+		mytypes.OwnerGVKLabel:  ownerGVKLabelValue(),
+		mytypes.OwnerNameLabel: injection.GetName(),
+	}); err != nil {
+		return errs.Wrap("failed to list the underlying ds resources", err)
+	}
+
+	for i := range dsList.Items {
+		if err := p.Delete(ctx, &dsList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return errs.Wrap("failed to delete ds", err)
+		}
+
+		p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonInjectorDeleted,
+			"Injector %s is replaced by the %s", dsList.Items[i].Name, replacedBy)
+	}
+
+	return nil
+}
+
+// event records the event if the recorder is set.
+func (p *provider) event(obj runtime.Object, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if p.recorder != nil {
+		p.recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+	}
+}
+
+func (p *provider) setInjectors(injection *v1alpha1.CertInjection, refs []corev1.ObjectReference) {
+	var injector *corev1.ObjectReference
+	if len(refs) > 0 {
+		injector = refs[0].DeepCopy()
+	}
+
+	injection.Status.Injector = injector
+	injection.Status.Injectors = refs
+	injection.Status.SetCondition(v1alpha1.CertInjectionCondition{
+		Type:    mytypes.ConditionInjector,
+		Status:  corev1.ConditionTrue,
+		Message: "Injector has been created",
+	})
+}
+
+// ownerGVKLabelValue returns the value of the owner GVK label of the objects created for the cert injections.
+// It's not read from the TypeMeta of the injection, which is cleared when the object is decoded by the typed client.
+func ownerGVKLabelValue() string {
+	return controller.FormatGVKToLabelValue(v1alpha1.GroupVersion.WithKind(mytypes.CertInjection))
+}
+
+// runtimeDsName returns the name of the ds serving the container runtime.
+// The runtime is only added when the ds is restricted to the nodes of the runtime.
+func runtimeDsName(prefix string, name string, runtime v1alpha1.ContainerRuntime, restricted bool) string {
+	dsName := fmt.Sprintf("%s-%s", prefix, name)
+	if restricted {
+		dsName = fmt.Sprintf("%s-%s", dsName, strings.ToLower(string(runtime)))
+	}
+
+	return dsName
+}
+
+// agentArgs renders the arguments of the agent serving the injection on the nodes of the container runtime.
+func agentArgs(injection *v1alpha1.CertInjection, runtime v1alpha1.ContainerRuntime, cleanup bool) []string {
+	args := []string{
+		fmt.Sprintf("--id=%s_%s", injection.Namespace, injection.Name),
+		fmt.Sprintf("--certs-dir=%s", certsPath(runtime, injection.Spec.Mode)),
+		fmt.Sprintf("--health-probe-bind-address=:%d", agentPort),
+	}
+
+	if useHostsConfig(runtime, injection.Spec.Mode) {
+		args = append(args, "--hosts-toml")
+
+		if cfg := injection.Spec.HostsConfig; cfg != nil && !cleanup {
+			if len(cfg.Capabilities) > 0 {
+				capabilities := make([]string, 0, len(cfg.Capabilities))
+				for _, c := range cfg.Capabilities {
+					capabilities = append(capabilities, string(c))
+				}
+
+				args = append(args, fmt.Sprintf("--capabilities=%s", strings.Join(capabilities, ",")))
+			}
+
+			if len(cfg.Mirrors) > 0 {
+				args = append(args, fmt.Sprintf("--mirrors=%s", strings.Join(cfg.Mirrors, ",")))
+			}
+		}
+	}
+
+	// The CA files are not needed by the cleaner.
+	secretIndexes := caSecretIndexes(injection)
+	for _, r := range injection.Spec.EffectiveRegistries() {
+		registry := fmt.Sprintf("--registry=%s", strings.Join(r.Hosts, ","))
+		if !cleanup {
+			registry = fmt.Sprintf("%s=%s", registry, caFilePath(secretIndexes[r.CertSecret.Name]))
+		}
+
+		args = append(args, registry)
+	}
+
+	if cleanup {
+		return append(args, "--cleanup")
+	}
+
+	return args
+}
+
+// caSecretIndexes indexes the distinct CA secrets of the registries in order.
+func caSecretIndexes(injection *v1alpha1.CertInjection) map[string]int {
+	indexes := make(map[string]int)
+	for _, r := range injection.Spec.EffectiveRegistries() {
+		if _, ok := indexes[r.CertSecret.Name]; !ok {
+			indexes[r.CertSecret.Name] = len(indexes)
+		}
+	}
+
+	return indexes
+}
+
+// caSecretVolumes renders the volumes and mounts of the distinct CA secrets of the registries.
+// Each secret is mounted into its own directory under caMountPath.
+func caSecretVolumes(injection *v1alpha1.CertInjection) ([]corev1.Volume, []corev1.VolumeMount) {
+	indexes := caSecretIndexes(injection)
+
+	volumes := make([]corev1.Volume, len(indexes))
+	mounts := make([]corev1.VolumeMount, len(indexes))
+	for name, i := range indexes {
+		volumes[i] = corev1.Volume{
+			Name: caVolumeName(i),
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: name,
+				},
+			},
+		}
+		mounts[i] = corev1.VolumeMount{
+			Name:      caVolumeName(i),
+			MountPath: fmt.Sprintf("%s/%d", caMountPath, i),
+			ReadOnly:  true,
+		}
+	}
+
+	return volumes, mounts
+}
+
+func caVolumeName(index int) string {
+	return fmt.Sprintf("ca-cert-%d", index)
 }
 
-func dsName(name string) string {
-	return fmt.Sprintf("%s-%s", dsNamePrefix, name)
+func caFilePath(index int) string {
+	return fmt.Sprintf("%s/%d/%s", caMountPath, index, caFileName)
 }
 
-func registryCertPath(externalDNS string) string {
-	return fmt.Sprintf("%s/%s", compatibleCertsPath, externalDNS)
+// agentProbe renders the probe checking the endpoint of the agent.
+func agentProbe(path string, periodSeconds int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromInt(agentPort),
+			},
+		},
+		PeriodSeconds: periodSeconds,
+	}
 }
 
-func cmdArg(externalDNS string) string {
-	return fmt.Sprintf(cmdArgPattern, caMountPath, externalDNS)
+// sameContainers checks whether the ds runs the same images with the same arguments as the desired one.
+func sameContainers(ds *appv1.DaemonSet, desired *appv1.DaemonSet) bool {
+	current, expected := ds.Spec.Template.Spec.Containers, desired.Spec.Template.Spec.Containers
+	if len(current) != len(expected) {
+		return false
+	}
+
+	for i := range current {
+		if current[i].Image != expected[i].Image ||
+			!equality.Semantic.DeepEqual(current[i].Args, expected[i].Args) ||
+			!equality.Semantic.DeepEqual(current[i].Resources, expected[i].Resources) {
+			return false
+		}
+	}
+
+	return true
 }
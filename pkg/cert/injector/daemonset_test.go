@@ -0,0 +1,99 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client-go scheme: %v", err)
+	}
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add v1alpha1 scheme: %v", err)
+	}
+
+	return scheme
+}
+
+func newInjection() *v1alpha1.CertInjection {
+	return &v1alpha1.CertInjection{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "ca-injection-harbor"},
+		Spec: v1alpha1.CertInjectionSpec{
+			ExternalDNS:      "harbor.example.com",
+			CertSecret:       corev1.LocalObjectReference{Name: "ca-secret"},
+			ContainerRuntime: v1alpha1.DockerRuntime,
+		},
+	}
+}
+
+// TestInjectAfterUpdate checks the injectors are labeled with the owner GVK after the TypeMeta of the injection
+// is cleared by the typed client.
+func TestInjectAfterUpdate(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newInjection()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection).Build()
+
+	injection.Finalizers = []string{mytypes.CleanupFinalizer}
+	if err := c.Update(ctx, injection); err != nil {
+		t.Fatalf("update injection: %v", err)
+	}
+
+	// The real client decodes the response into the typed object without the TypeMeta.
+	injection.TypeMeta = metav1.TypeMeta{}
+
+	p := NewDaemonSetProvider(c, scheme, nil)
+	for i := 0; i < 2; i++ {
+		if err := p.Inject(ctx, injection); err != nil {
+			t.Fatalf("inject #%d: %v", i, err)
+		}
+	}
+
+	dsList := &appv1.DaemonSetList{}
+	if err := c.List(ctx, dsList, client.InNamespace(injection.Namespace)); err != nil {
+		t.Fatalf("list ds: %v", err)
+	}
+
+	if len(dsList.Items) != 1 {
+		t.Fatalf("expected 1 injector, got %d", len(dsList.Items))
+	}
+
+	if got, want := dsList.Items[0].Labels[mytypes.OwnerGVKLabel], "day2-operations.goharbor.io_v1alpha1_CertInjection"; got != want {
+		t.Fatalf("expected owner GVK label %q, got %q", want, got)
+	}
+
+	if len(injection.Status.Injectors) != 1 {
+		t.Fatalf("expected 1 injector in status, got %d", len(injection.Status.Injectors))
+	}
+}
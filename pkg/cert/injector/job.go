@@ -0,0 +1,541 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	injectorJobNamePrefix = "cert-injection-job"
+	cleanerJobNamePrefix  = "cert-cleanup-job"
+	// jobBackoffLimit is the retries of a job before it's marked as failed.
+	jobBackoffLimit int32 = 3
+)
+
+// jobProvider injects the CA by a job on each node, the job writes the files, verifies them and exits.
+// A new job is launched on the node when the CA certs or the injection settings are changed, or the node joins.
+type jobProvider struct {
+	*provider
+}
+
+func init() {
+	Register(JobStrategy, func(opts *Options) Provider {
+		return NewJobProvider(opts.Client, opts.Scheme, opts.Recorder)
+	})
+}
+
+// NewJobProvider news a provider doing injection through the jobs.
+// The recorder is optional, no event is recorded if it's nil.
+func NewJobProvider(client client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) Provider {
+	return &jobProvider{
+		provider: &provider{
+			Client:   client,
+			scheme:   scheme,
+			recorder: recorder,
+		},
+	}
+}
+
+// nodeJob is the desired job of a node.
+type nodeJob struct {
+	node     string
+	revision string
+	job      *batchv1.Job
+}
+
+// Inject implements injector.Provider.
+func (p *jobProvider) Inject(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	desired, err := p.desiredJobs(ctx, injection, false)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.listJobs(ctx, injection, injectorRole)
+	if err != nil {
+		return err
+	}
+
+	for _, nj := range desired {
+		if job, ok := existing[nj.job.Name]; ok {
+			delete(existing, nj.job.Name)
+
+			status := v1alpha1.NodeInjectionStatus{}
+			observeJob(job, &status)
+			if status.Phase != v1alpha1.NodeInjectionFailed {
+				continue
+			}
+
+			// Launch it again after the backoff limit is exceeded, it's created once the deletion is observed.
+			if err := p.deleteJob(ctx, job); err != nil {
+				return err
+			}
+
+			p.event(injection, corev1.EventTypeWarning, mytypes.EventReasonInjectFailed,
+				"Injection job %s failed on node %s and is launched again: %s", job.Name, nj.node, status.Message)
+
+			continue
+		}
+
+		if err := controllerutil.SetControllerReference(injection, nj.job, p.scheme); err != nil {
+			return errs.Wrap("failed to set owner reference of job", err)
+		}
+
+		if err := p.Create(ctx, nj.job); err != nil {
+			return errs.Wrap("failed to create injection job", err)
+		}
+
+		p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonInjectorCreated,
+			"Injection job %s is created on node %s", nj.job.Name, nj.node)
+	}
+
+	// Remove the jobs of the previous revisions and the nodes which have left.
+	for _, job := range existing {
+		if err := p.deleteJob(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	p.setInjectors(injection, nil)
+
+	return nil
+}
+
+// Observe implements injector.Provider.
+// The injection result of each node is read from the job of the current revision.
+func (p *jobProvider) Observe(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	desired, err := p.desiredJobs(ctx, injection, false)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.listJobs(ctx, injection, injectorRole)
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]v1alpha1.NodeInjectionStatus, 0, len(desired))
+	for _, nj := range desired {
+		status := v1alpha1.NodeInjectionStatus{
+			Node:     nj.node,
+			Revision: nj.revision,
+			Job:      nj.job.Name,
+			Phase:    v1alpha1.NodeInjectionPending,
+		}
+
+		if job, ok := existing[nj.job.Name]; ok {
+			observeJob(job, &status)
+		}
+
+		nodes = append(nodes, status)
+	}
+
+	p.setNodes(injection, nodes)
+
+	return nil
+}
+
+// Release implements injector.Provider.
+// The jobs are removed, the files on the nodes are left to the new strategy.
+func (p *jobProvider) Release(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	for _, role := range []string{injectorRole, cleanerRole} {
+		jobs, err := p.listJobs(ctx, injection, role)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if err := p.deleteJob(ctx, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	injection.Status.Nodes = nil
+
+	return nil
+}
+
+// Watches implements injector.Provider.
+func (p *jobProvider) Watches() []Watch {
+	return []Watch{{Type: &batchv1.Job{}, Owned: true}}
+}
+
+// DependsOnNodes implements injector.Provider.
+// A job is launched on each node.
+func (p *jobProvider) DependsOnNodes(_ *v1alpha1.CertInjection) bool {
+	return true
+}
+
+// DesiredInjectors implements injector.Provider.
+func (p *jobProvider) DesiredInjectors(ctx context.Context, injection *v1alpha1.CertInjection) ([]client.Object, error) {
+	if injection == nil {
+		return nil, nil
+	}
+
+	desired, err := p.desiredJobs(ctx, injection, false)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]client.Object, 0, len(desired))
+	for _, nj := range desired {
+		objs = append(objs, nj.job)
+	}
+
+	return objs, nil
+}
+
+// Cleanup implements injector.Provider.
+// The injection jobs are removed and a cleanup job is launched on each node.
+func (p *jobProvider) Cleanup(ctx context.Context, injection *v1alpha1.CertInjection) (bool, error) {
+	if injection == nil {
+		return false, errs.New("nil cert injection obj")
+	}
+
+	injectors, err := p.listJobs(ctx, injection, injectorRole)
+	if err != nil {
+		return false, err
+	}
+
+	for _, job := range injectors {
+		if err := p.deleteJob(ctx, job); err != nil {
+			return false, err
+		}
+	}
+
+	desired, err := p.desiredJobs(ctx, injection, true)
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := p.listJobs(ctx, injection, cleanerRole)
+	if err != nil {
+		return false, err
+	}
+
+	done := true
+	for _, nj := range desired {
+		job, ok := existing[nj.job.Name]
+		if !ok {
+			if err := controllerutil.SetOwnerReference(injection, nj.job, p.scheme); err != nil {
+				return false, errs.Wrap("failed to set owner reference of cleanup job", err)
+			}
+
+			if err := p.Create(ctx, nj.job); err != nil {
+				if isNamespaceTerminating(err) {
+					p.event(injection, corev1.EventTypeWarning, mytypes.EventReasonCleanupSkipped,
+						"Injected files are left on the nodes as the namespace is terminating")
+					return true, nil
+				}
+
+				return false, errs.Wrap("failed to create cleanup job", err)
+			}
+
+			p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonCleanupStarted,
+				"Cleanup job %s is created to remove the injected files from node %s", nj.job.Name, nj.node)
+
+			done = false
+			continue
+		}
+
+		status := v1alpha1.NodeInjectionStatus{}
+		observeJob(job, &status)
+
+		switch status.Phase {
+		case v1alpha1.NodeInjectionFailed:
+			// Launch it again.
+			if err := p.deleteJob(ctx, job); err != nil {
+				return false, err
+			}
+
+			done = false
+		case v1alpha1.NodeInjectionPending:
+			done = false
+		}
+	}
+
+	if !done {
+		return false, nil
+	}
+
+	// All the nodes have been cleaned up.
+	for _, job := range existing {
+		if err := p.deleteJob(ctx, job); err != nil {
+			return false, err
+		}
+	}
+
+	p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonCleanupCompleted, "Injected files have been removed from all the nodes")
+
+	return true, nil
+}
+
+// desiredJobs renders the injection or cleanup job of each node.
+func (p *jobProvider) desiredJobs(ctx context.Context, injection *v1alpha1.CertInjection, cleanup bool) ([]nodeJob, error) {
+	nodes := &corev1.NodeList{}
+	if err := p.List(ctx, nodes); err != nil {
+		return nil, errs.Wrap("failed to list nodes", err)
+	}
+
+	// The CA certs are part of the revision, then the nodes are injected again when they're changed.
+	var caData []byte
+	if !cleanup {
+		data, err := p.caData(ctx, injection)
+		if err != nil {
+			return nil, err
+		}
+
+		caData = data
+	}
+
+	// The jobs bypass the scheduler, then only the nodes the injectors can be scheduled to are handled.
+	scheduling := schedulingOf(injection)
+
+	jobs := make([]nodeJob, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !schedulable(node, scheduling) {
+			continue
+		}
+
+		// The cleanup jobs may never run on the nodes not ready or unschedulable, then they're not waited for.
+		if cleanup && !isNodeAvailable(node) {
+			continue
+		}
+
+		runtime := injection.Spec.ContainerRuntime
+		if IsAutoRuntime(injection) {
+			runtime = RuntimeOfNode(node)
+		}
+
+		podSpec := agentPodSpec(injection, runtime, cleanup)
+		podSpec.Containers[0].Args = append(podSpec.Containers[0].Args, "--once")
+		// The probes are not served by the agent running once.
+		podSpec.Containers[0].Ports = nil
+		podSpec.NodeName = node.Name
+		podSpec.RestartPolicy = corev1.RestartPolicyOnFailure
+
+		revision := jobRevision(podSpec.Containers[0].Image, podSpec.Containers[0].Args, caData)
+
+		prefix, role := injectorJobNamePrefix, injectorRole
+		if cleanup {
+			prefix, role = cleanerJobNamePrefix, cleanerRole
+		}
+
+		backoffLimit := jobBackoffLimit
+		job := &batchv1.Job{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Job",
+				APIVersion: "batch/v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName(prefix, injection, node.Name, revision),
+				Namespace: injection.Namespace,
+				Labels: map[string]string{
+					"k8s-app":                     "cert-auto-injector",
+					mytypes.OwnerGVKLabel:         ownerGVKLabelValue(),
+					mytypes.OwnerNameLabel:        injection.GetName(),
+					mytypes.ContainerRuntimeLabel: strings.ToLower(string(runtime)),
+					mytypes.InjectorRoleLabel:     role,
+				},
+			},
+			Spec: batchv1.JobSpec{
+				BackoffLimit: &backoffLimit,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"k8s-app": "cert-auto-injector",
+						},
+					},
+					Spec: podSpec,
+				},
+			},
+		}
+
+		jobs = append(jobs, nodeJob{
+			node:     node.Name,
+			revision: revision,
+			job:      job,
+		})
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].node < jobs[j].node
+	})
+
+	return jobs, nil
+}
+
+// caData returns the data of the CA secrets of the injection.
+func (p *jobProvider) caData(ctx context.Context, injection *v1alpha1.CertInjection) ([]byte, error) {
+	names := make([]string, 0)
+	for name := range caSecretIndexes(injection) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var data []byte
+	for _, name := range names {
+		secret := &corev1.Secret{}
+		if err := p.Get(ctx, types.NamespacedName{Namespace: injection.Namespace, Name: name}, secret); err != nil {
+			return nil, errs.Wrap(fmt.Sprintf("failed to get CA secret %s", name), err)
+		}
+
+		data = append(data, []byte(name)...)
+		data = append(data, secret.Data[caFileName]...)
+	}
+
+	return data, nil
+}
+
+// listJobs lists the jobs of the injection in the role, keyed by the names.
+func (p *jobProvider) listJobs(ctx context.Context, injection *v1alpha1.CertInjection, role string) (map[string]*batchv1.Job, error) {
+	jobList := &batchv1.JobList{}
+	if err := p.List(ctx, jobList, client.InNamespace(injection.Namespace), client.MatchingLabels{
+		mytypes.OwnerGVKLabel:     ownerGVKLabelValue(),
+		mytypes.OwnerNameLabel:    injection.GetName(),
+		mytypes.InjectorRoleLabel: role,
+	}); err != nil {
+		return nil, errs.Wrap("failed to list jobs", err)
+	}
+
+	jobs := make(map[string]*batchv1.Job, len(jobList.Items))
+	for i := range jobList.Items {
+		jobs[jobList.Items[i].Name] = &jobList.Items[i]
+	}
+
+	return jobs, nil
+}
+
+// deleteJob deletes the job with its pods.
+func (p *jobProvider) deleteJob(ctx context.Context, job *batchv1.Job) error {
+	if err := p.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+		return errs.Wrap("failed to delete job", err)
+	}
+
+	return nil
+}
+
+// setNodes sets the injection results of the nodes and the NodesInjected condition.
+func (p *jobProvider) setNodes(injection *v1alpha1.CertInjection, nodes []v1alpha1.NodeInjectionStatus) {
+	var injected, pending int32
+	var failing []string
+	for _, n := range nodes {
+		switch n.Phase {
+		case v1alpha1.NodeInjectionInjected:
+			injected++
+		case v1alpha1.NodeInjectionPending:
+			pending++
+		default:
+			failing = append(failing, n.Node)
+		}
+	}
+
+	desired := int32(len(nodes))
+
+	injection.Status.Nodes = nodes
+	injection.Status.DesiredNodes = desired
+	injection.Status.InjectedNodes = injected
+	injection.Status.FailedNodes = desired - injected
+
+	cond := v1alpha1.CertInjectionCondition{
+		Type:    mytypes.ConditionNodesInjected,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonAllInjected,
+		Message: fmt.Sprintf("CA cert has been injected into %d nodes", injected),
+	}
+
+	switch {
+	case len(failing) > 0:
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = reasonInjectionFailed
+		cond.Message = fmt.Sprintf("CA cert is not injected into %d of %d nodes: %s", len(failing), desired, formatNodes(failing))
+	case pending > 0:
+		cond.Status = corev1.ConditionUnknown
+		cond.Reason = reasonRollingOut
+		cond.Message = fmt.Sprintf("Injection jobs are running on %d nodes", pending)
+	}
+
+	injection.Status.SetCondition(cond)
+}
+
+// observeJob sets the phase of the node from the status of the job.
+func observeJob(job *batchv1.Job, status *v1alpha1.NodeInjectionStatus) {
+	status.Phase = v1alpha1.NodeInjectionPending
+
+	if job.Status.Succeeded > 0 {
+		status.Phase = v1alpha1.NodeInjectionInjected
+		status.CompletionTime = job.Status.CompletionTime
+		return
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			status.Phase = v1alpha1.NodeInjectionFailed
+			status.Message = c.Message
+			return
+		}
+	}
+}
+
+// jobRevision hashes the image, the arguments and the CA data of the job.
+func jobRevision(image string, args []string, caData []byte) string {
+	h := sha256.New()
+	// Writing to a hash never fails.
+	_, _ = h.Write([]byte(image))
+	_, _ = h.Write([]byte(strings.Join(args, " ")))
+	_, _ = h.Write(caData)
+
+	return hex.EncodeToString(h.Sum(nil))[:10]
+}
+
+// jobName returns the name of the job of the node.
+// The job name is used as a label value of its pods, so it's kept short with the node hashed.
+func jobName(prefix string, injection *v1alpha1.CertInjection, node string, revision string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s", injection.Namespace, injection.Name, node)))
+
+	return fmt.Sprintf("%s-%s-%s", prefix, hex.EncodeToString(sum[:])[:10], revision)
+}
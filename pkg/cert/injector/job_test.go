@@ -0,0 +1,293 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestJobName(t *testing.T) {
+	injection := newInjection()
+
+	name := jobName(injectorJobNamePrefix, injection, "node-1", "0123456789")
+	if !strings.HasPrefix(name, injectorJobNamePrefix+"-") || !strings.HasSuffix(name, "-0123456789") {
+		t.Fatalf("expected the name with the prefix and the revision, got %s", name)
+	}
+
+	if again := jobName(injectorJobNamePrefix, injection, "node-1", "0123456789"); again != name {
+		t.Fatalf("expected the same name of the same node and revision, got %s and %s", name, again)
+	}
+
+	// The job name is a label value of its pods.
+	long := jobName(injectorJobNamePrefix, injection, strings.Repeat("n", 253), "0123456789")
+	if len(long) > 63 {
+		t.Fatalf("expected the name within 63 characters, got %d", len(long))
+	}
+
+	others := map[string]string{
+		"other node":      jobName(injectorJobNamePrefix, injection, "node-2", "0123456789"),
+		"other revision":  jobName(injectorJobNamePrefix, injection, "node-1", "9876543210"),
+		"other prefix":    jobName(cleanerJobNamePrefix, injection, "node-1", "0123456789"),
+		"other injection": jobName(injectorJobNamePrefix, &v1alpha1.CertInjection{ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "other"}}, "node-1", "0123456789"),
+	}
+
+	for desc, other := range others {
+		if other == name {
+			t.Fatalf("expected a different name of %s, got %s", desc, other)
+		}
+	}
+}
+
+func TestJobRevision(t *testing.T) {
+	const image = "ghcr.io/szlabs/cert-injector-agent:v0.1.0"
+	args := []string{"--id=harbor", "--once"}
+	ca := []byte("ca")
+
+	revision := jobRevision(image, args, ca)
+	if len(revision) != 10 {
+		t.Fatalf("expected a revision of 10 characters, got %q", revision)
+	}
+
+	cases := []struct {
+		name    string
+		image   string
+		args    []string
+		ca      []byte
+		changed bool
+	}{
+		{name: "same", image: image, args: []string{"--id=harbor", "--once"}, ca: []byte("ca")},
+		{name: "image changed", image: image + "-1", args: args, ca: ca, changed: true},
+		{name: "args changed", image: image, args: []string{"--id=harbor", "--once", "--hosts-toml"}, ca: ca, changed: true},
+		{name: "args reordered", image: image, args: []string{"--once", "--id=harbor"}, ca: ca, changed: true},
+		{name: "CA changed", image: image, args: args, ca: []byte("rotated"), changed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := jobRevision(c.image, c.args, c.ca) != revision; got != c.changed {
+				t.Fatalf("expected changed %v, got %v", c.changed, got)
+			}
+		})
+	}
+}
+
+func newNode(name string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func listJobs(t *testing.T, c client.Client) []batchv1.Job {
+	t.Helper()
+
+	jobList := &batchv1.JobList{}
+	if err := c.List(context.Background(), jobList, client.InNamespace("harbor")); err != nil {
+		t.Fatalf("list jobs: %v", err)
+	}
+
+	return jobList.Items
+}
+
+// TestJobInjectRevision checks the jobs are only launched again when the revision is changed.
+func TestJobInjectRevision(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newInjection()
+	secret := newCASecret()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection, secret, newNode("node-1"), newNode("node-2")).Build()
+
+	p := NewJobProvider(c, scheme, nil)
+	if err := p.Inject(ctx, injection); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+
+	jobs := listJobs(t, c)
+	if len(jobs) != 2 {
+		t.Fatalf("expected a job on each node, got %d", len(jobs))
+	}
+
+	names := make(map[string]bool)
+	for _, job := range jobs {
+		names[job.Name] = true
+	}
+
+	// The same revision keeps the jobs.
+	if err := p.Inject(ctx, injection); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+
+	for _, job := range listJobs(t, c) {
+		if !names[job.Name] {
+			t.Fatalf("expected the jobs to be kept, got new job %s", job.Name)
+		}
+	}
+
+	// The rotated CA changes the revision.
+	secret.Data[caFileName] = []byte("rotated")
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatalf("update CA secret: %v", err)
+	}
+
+	if err := p.Inject(ctx, injection); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+
+	jobs = listJobs(t, c)
+	if len(jobs) != 2 {
+		t.Fatalf("expected a job on each node, got %d", len(jobs))
+	}
+
+	for _, job := range jobs {
+		if names[job.Name] {
+			t.Fatalf("expected the job of the previous revision to be replaced, got %s", job.Name)
+		}
+	}
+
+	if err := p.Observe(ctx, injection); err != nil {
+		t.Fatalf("observe: %v", err)
+	}
+
+	if len(injection.Status.Nodes) != 2 || injection.Status.Nodes[0].Phase != v1alpha1.NodeInjectionPending {
+		t.Fatalf("expected 2 pending nodes, got %+v", injection.Status.Nodes)
+	}
+}
+
+// TestJobInjectRelaunch checks the failed injection job is launched again with the same revision.
+func TestJobInjectRelaunch(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newInjection()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection, newCASecret(), newNode("node-1")).Build()
+
+	p := NewJobProvider(c, scheme, nil)
+	inject := func() []batchv1.Job {
+		t.Helper()
+
+		if err := p.Inject(ctx, injection); err != nil {
+			t.Fatalf("inject: %v", err)
+		}
+
+		return listJobs(t, c)
+	}
+
+	jobs := inject()
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 injection job, got %d", len(jobs))
+	}
+
+	name := jobs[0].Name
+	jobs[0].Status = batchv1.JobStatus{
+		Conditions: []batchv1.JobCondition{{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Message: "BackoffLimitExceeded",
+		}},
+	}
+	if err := c.Status().Update(ctx, &jobs[0]); err != nil {
+		t.Fatalf("update job status: %v", err)
+	}
+
+	// The failed job is removed, and then launched again.
+	if jobs := inject(); len(jobs) != 0 {
+		t.Fatalf("expected the failed job to be removed, got %d", len(jobs))
+	}
+
+	jobs = inject()
+	if len(jobs) != 1 || jobs[0].Name != name || len(jobs[0].Status.Conditions) != 0 {
+		t.Fatalf("expected the job %s launched again, got %+v", name, jobs)
+	}
+
+	// The job running is kept.
+	rv := jobs[0].ResourceVersion
+	if jobs := inject(); len(jobs) != 1 || jobs[0].ResourceVersion != rv {
+		t.Fatalf("expected the job kept, got %+v", jobs)
+	}
+}
+
+// TestJobCleanupRelaunch checks the failed cleanup job is launched again until it succeeds.
+func TestJobCleanupRelaunch(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newInjection()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection, newNode("node-1")).Build()
+
+	p := NewJobProvider(c, scheme, nil)
+	cleanup := func(expected bool) {
+		t.Helper()
+
+		done, err := p.Cleanup(ctx, injection)
+		if err != nil {
+			t.Fatalf("cleanup: %v", err)
+		}
+
+		if done != expected {
+			t.Fatalf("expected cleanup done %v, got %v", expected, done)
+		}
+	}
+
+	setStatus := func(status batchv1.JobStatus) {
+		t.Helper()
+
+		jobs := listJobs(t, c)
+		if len(jobs) != 1 {
+			t.Fatalf("expected 1 cleanup job, got %d", len(jobs))
+		}
+
+		jobs[0].Status = status
+		if err := c.Status().Update(ctx, &jobs[0]); err != nil {
+			t.Fatalf("update job status: %v", err)
+		}
+	}
+
+	// The cleanup job is launched.
+	cleanup(false)
+	setStatus(batchv1.JobStatus{
+		Conditions: []batchv1.JobCondition{{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Message: "BackoffLimitExceeded",
+		}},
+	})
+
+	// The failed job is removed, and then launched again.
+	cleanup(false)
+	if jobs := listJobs(t, c); len(jobs) != 0 {
+		t.Fatalf("expected the failed job to be removed, got %d", len(jobs))
+	}
+
+	cleanup(false)
+	setStatus(batchv1.JobStatus{Succeeded: 1})
+
+	cleanup(true)
+	if jobs := listJobs(t, c); len(jobs) != 0 {
+		t.Fatalf("expected the cleanup jobs to be removed, got %d", len(jobs))
+	}
+}
@@ -17,18 +17,48 @@ package injector
 import (
 	"context"
 
-	appv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
 )
 
 // Provider for injecting self-signed CA.
+// Each provider implements a strategy of injecting the CA, registered by its name.
 type Provider interface {
+	// DesiredInjectors indicates the desired injector objects align with the provided injection.
+	DesiredInjectors(ctx context.Context, injection *v1alpha1.CertInjection) ([]client.Object, error)
+
 	// Inject the specified CA certificate.
-	// Cert is the data bytes of the self-signed certificate.
-	// The underlying injector will be created and updated into the injection status object.
+	// The underlying injectors will be created or updated to align with the injection and the stale ones are removed,
+	// and they will be updated into the injection status object.
 	Inject(ctx context.Context, injection *v1alpha1.CertInjection) error
 
-	// DesiredInjector indicates the desired injector object align with the provided injection.
-	DesiredInjector(injection *v1alpha1.CertInjection) *appv1.DaemonSet
+	// Observe the injection results on the nodes and update them into the injection status object.
+	Observe(ctx context.Context, injection *v1alpha1.CertInjection) error
+
+	// Release removes the injectors of the injection but leaves the injected files on the nodes,
+	// which are taken over by the injectors of another strategy.
+	Release(ctx context.Context, injection *v1alpha1.CertInjection) error
+
+	// Cleanup removes the injectors and the injected files from the nodes.
+	// It returns true when all the nodes have been cleaned up, otherwise it should be called again later.
+	Cleanup(ctx context.Context, injection *v1alpha1.CertInjection) (bool, error)
+
+	// Watches returns the injector objects whose changes trigger the reconciling of the injections.
+	Watches() []Watch
+
+	// DependsOnNodes checks whether the injectors of the injection change with the nodes joining, leaving
+	// or changing container runtime.
+	DependsOnNodes(injection *v1alpha1.CertInjection) bool
+}
+
+// Watch defines the injector objects watched by the controller.
+type Watch struct {
+	// Type of the injector objects.
+	Type client.Object
+	// Owned indicates the objects are controlled by the injection.
+	// Otherwise, all the injections of the strategy are reconciled when the objects with the Labels change.
+	Owned bool
+	// Labels of the objects not owned by the injections.
+	Labels map[string]string
 }
@@ -0,0 +1,98 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DaemonSetStrategy keeps the CA certs synced on the nodes by the DaemonSets of each injection.
+	DaemonSetStrategy = "DaemonSet"
+	// SharedStrategy serves all the injections by the shared DaemonSets in the operator namespace.
+	SharedStrategy = "Shared"
+	// JobStrategy injects the CA certs by a job on each node.
+	JobStrategy = "Job"
+)
+
+var strategies sync.Map
+
+// Options to create the providers.
+type Options struct {
+	Client client.Client
+	Scheme *runtime.Scheme
+	// Recorder is optional, no event is recorded if it's nil.
+	Recorder record.EventRecorder
+	// Namespace of the operator.
+	Namespace string
+}
+
+// Factory creates the provider of a strategy.
+type Factory func(opts *Options) Provider
+
+// Register the factory of the strategy. The strategy registered first wins.
+func Register(strategy string, factory Factory) {
+	if strategy != "" && factory != nil {
+		strategies.LoadOrStore(strategy, factory)
+	}
+}
+
+// Get the provider of the strategy. Nil is returned if the strategy is not registered.
+func Get(strategy string, opts *Options) Provider {
+	v, ok := strategies.Load(strategy)
+	if !ok {
+		return nil
+	}
+
+	factory, ok := v.(Factory)
+	if !ok {
+		return nil
+	}
+
+	return factory(opts)
+}
+
+// Strategies returns the names of all the registered strategies.
+func Strategies() []string {
+	var names []string
+	strategies.Range(func(k, _ interface{}) bool {
+		if name, ok := k.(string); ok {
+			names = append(names, name)
+		}
+
+		return true
+	})
+
+	sort.Strings(names)
+
+	return names
+}
+
+// StrategyOf returns the strategy of the injection, which defaults to the strategy set for the operator.
+func StrategyOf(injection *v1alpha1.CertInjection) string {
+	if injection.Spec.Strategy != "" {
+		return injection.Spec.Strategy
+	}
+
+	return config.Get().Injector
+}
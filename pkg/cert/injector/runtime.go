@@ -0,0 +1,201 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Check details of the hosts.toml here: https://github.com/containerd/containerd/blob/main/docs/hosts.md
+	containerdCertsPath = "/etc/containerd/certs.d"
+	// CRI-O and Podman read the registry certificates from here.
+	containersCertsPath = "/etc/containers/certs.d"
+
+	crioVersionPrefix   = "cri-o://"
+	dockerVersionPrefix = "docker://"
+)
+
+// RuntimeOfNode detects the container runtime of the node from its status.
+// Containerd is assumed if the runtime is not recognized.
+func RuntimeOfNode(node *corev1.Node) v1alpha1.ContainerRuntime {
+	v := node.Status.NodeInfo.ContainerRuntimeVersion
+	switch {
+	case strings.HasPrefix(v, crioVersionPrefix):
+		return v1alpha1.CRIORuntime
+	case strings.HasPrefix(v, dockerVersionPrefix):
+		return v1alpha1.DockerRuntime
+	default:
+		return v1alpha1.ContainerdRuntime
+	}
+}
+
+// IsAutoRuntime checks whether the container runtime of the injection is detected from the nodes.
+func IsAutoRuntime(injection *v1alpha1.CertInjection) bool {
+	return injection.Spec.ContainerRuntime == "" || injection.Spec.ContainerRuntime == v1alpha1.AutoRuntime
+}
+
+// runtimeGroup is a group of nodes running the same container runtime.
+type runtimeGroup struct {
+	runtime v1alpha1.ContainerRuntime
+	// restricted means the injectors only run on the nodes labeled with the runtime, otherwise on all the nodes.
+	restricted bool
+}
+
+// runtimeGroups returns the container runtimes the injection should serve.
+// If all the nodes share the same runtime, no need to restrict the nodes.
+func (p *provider) runtimeGroups(ctx context.Context, injection *v1alpha1.CertInjection) ([]runtimeGroup, error) {
+	if !IsAutoRuntime(injection) {
+		return []runtimeGroup{{runtime: injection.Spec.ContainerRuntime}}, nil
+	}
+
+	groups, err := p.nodeRuntimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) <= 1 {
+		runtime := v1alpha1.ContainerdRuntime
+		for rt := range groups {
+			runtime = rt
+		}
+
+		return []runtimeGroup{{runtime: runtime}}, nil
+	}
+
+	runtimes := make([]string, 0, len(groups))
+	for rt := range groups {
+		runtimes = append(runtimes, string(rt))
+	}
+	sort.Strings(runtimes)
+
+	res := make([]runtimeGroup, 0, len(runtimes))
+	for _, rt := range runtimes {
+		res = append(res, runtimeGroup{
+			runtime:    v1alpha1.ContainerRuntime(rt),
+			restricted: true,
+		})
+	}
+
+	return res, nil
+}
+
+// nodeRuntimes groups the names of the nodes by their container runtimes.
+// The nodes are labeled with their runtimes, which the injectors restricted to a runtime select the nodes by,
+// then the injectors are not changed when the nodes join or leave.
+func (p *provider) nodeRuntimes(ctx context.Context) (map[v1alpha1.ContainerRuntime][]string, error) {
+	nodes := &corev1.NodeList{}
+	if err := p.List(ctx, nodes); err != nil {
+		return nil, errs.Wrap("failed to list nodes", err)
+	}
+
+	groups := make(map[v1alpha1.ContainerRuntime][]string)
+	for i := range nodes.Items {
+		rt := RuntimeOfNode(&nodes.Items[i])
+		if err := p.labelRuntime(ctx, &nodes.Items[i], rt); err != nil {
+			return nil, err
+		}
+
+		groups[rt] = append(groups[rt], nodes.Items[i].Name)
+	}
+
+	for _, names := range groups {
+		sort.Strings(names)
+	}
+
+	return groups, nil
+}
+
+// labelRuntime labels the node with its container runtime if it's not labeled yet.
+func (p *provider) labelRuntime(ctx context.Context, node *corev1.Node, runtime v1alpha1.ContainerRuntime) error {
+	value := runtimeLabelValue(runtime)
+	if node.Labels[mytypes.NodeContainerRuntimeLabel] == value {
+		return nil
+	}
+
+	patch := client.MergeFrom(node.DeepCopy())
+	if node.Labels == nil {
+		node.Labels = make(map[string]string)
+	}
+	node.Labels[mytypes.NodeContainerRuntimeLabel] = value
+
+	if err := p.Patch(ctx, node, patch); err != nil {
+		return errs.Wrap(fmt.Sprintf("failed to label node %s with the container runtime", node.Name), err)
+	}
+
+	return nil
+}
+
+// runtimeLabelValue returns the value of the container runtime labels of the nodes and the injectors.
+func runtimeLabelValue(runtime v1alpha1.ContainerRuntime) string {
+	return strings.ToLower(string(runtime))
+}
+
+// runtimeAffinity restricts the injector with the affinity to the nodes labeled with the container runtime.
+// The nodes joined are labeled when the injections depending on the nodes are reconciled.
+func runtimeAffinity(affinity *corev1.Affinity, runtime v1alpha1.ContainerRuntime, restricted bool) *corev1.Affinity {
+	if !restricted {
+		return affinity
+	}
+
+	return mergeAffinity(affinity, &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      mytypes.NodeContainerRuntimeLabel,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{runtimeLabelValue(runtime)},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+// certsPath returns the node directory where the registry certificates are located for the container runtime.
+func certsPath(runtime v1alpha1.ContainerRuntime, mode v1alpha1.InjectionMode) string {
+	switch runtime {
+	case v1alpha1.CRIORuntime:
+		return containersCertsPath
+	case v1alpha1.DockerRuntime:
+		return compatibleCertsPath
+	default:
+		if mode == v1alpha1.ContainerdHostsMode {
+			return containerdCertsPath
+		}
+
+		return compatibleCertsPath
+	}
+}
+
+// useHostsConfig checks whether the containerd hosts.toml should be generated.
+func useHostsConfig(runtime v1alpha1.ContainerRuntime, mode v1alpha1.InjectionMode) bool {
+	return certsPath(runtime, mode) == containerdCertsPath
+}
@@ -0,0 +1,120 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newRuntimeNode(name string, version string) *corev1.Node {
+	node := newNode(name)
+	node.Status.NodeInfo.ContainerRuntimeVersion = version
+
+	return node
+}
+
+// TestMixedRuntimeInject checks the injectors of the mixed runtimes select the nodes by the runtime label,
+// and they're not changed when a node joins.
+func TestMixedRuntimeInject(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newInjection()
+	injection.Spec.ContainerRuntime = v1alpha1.AutoRuntime
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection,
+		newRuntimeNode("node-1", "docker://20.10.7"),
+		newRuntimeNode("node-2", "containerd://1.6.2"),
+	).Build()
+
+	p := NewDaemonSetProvider(c, scheme, nil)
+	if err := p.Inject(ctx, injection); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+
+	injectors := listInjectors(t, c)
+	expected := map[string]string{
+		"cert-injection-ds-ca-injection-harbor-containerd": "containerd",
+		"cert-injection-ds-ca-injection-harbor-docker":     "docker",
+	}
+	if len(injectors) != len(expected) {
+		t.Fatalf("expected %d injectors, got %d", len(expected), len(injectors))
+	}
+
+	for name, runtime := range expected {
+		ds, ok := injectors[name]
+		if !ok {
+			t.Fatalf("injector %s not found", name)
+		}
+
+		term := requiredTerm(ds.Spec.Template.Spec.Affinity)
+		if term == nil || len(term.MatchFields) != 0 || len(term.MatchExpressions) != 1 ||
+			term.MatchExpressions[0].Key != mytypes.NodeContainerRuntimeLabel ||
+			!equality.Semantic.DeepEqual(term.MatchExpressions[0].Values, []string{runtime}) {
+			t.Fatalf("expected injector %s restricted to the %s nodes, got %+v", name, runtime, term)
+		}
+	}
+
+	for name, runtime := range map[string]string{"node-1": "docker", "node-2": "containerd"} {
+		node := &corev1.Node{}
+		if err := c.Get(ctx, client.ObjectKey{Name: name}, node); err != nil {
+			t.Fatalf("get node %s: %v", name, err)
+		}
+
+		if node.Labels[mytypes.NodeContainerRuntimeLabel] != runtime {
+			t.Fatalf("expected node %s labeled with %s, got %v", name, runtime, node.Labels)
+		}
+	}
+
+	// A node of a runtime in use joins.
+	if err := c.Create(ctx, newRuntimeNode("node-3", "containerd://1.6.2")); err != nil {
+		t.Fatalf("create node: %v", err)
+	}
+
+	if err := p.Inject(ctx, injection); err != nil {
+		t.Fatalf("inject after the node joined: %v", err)
+	}
+
+	for name, ds := range listInjectors(t, c) {
+		if ds.ResourceVersion != injectors[name].ResourceVersion {
+			t.Fatalf("expected injector %s not changed after the node joined", name)
+		}
+	}
+}
+
+func listInjectors(t *testing.T, c client.Client) map[string]*appv1.DaemonSet {
+	t.Helper()
+
+	dsList := &appv1.DaemonSetList{}
+	if err := c.List(context.Background(), dsList, client.InNamespace("harbor")); err != nil {
+		t.Fatalf("list ds: %v", err)
+	}
+
+	injectors := make(map[string]*appv1.DaemonSet, len(dsList.Items))
+	for i := range dsList.Items {
+		injectors[dsList.Items[i].Name] = &dsList.Items[i]
+	}
+
+	return injectors
+}
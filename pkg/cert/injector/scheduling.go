@@ -0,0 +1,266 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"strconv"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const nodeNameField = "metadata.name"
+
+// schedulingOf returns the scheduling of the injectors of the injection.
+// The fields not set by the injection default to the scheduling set for the operator.
+func schedulingOf(injection *v1alpha1.CertInjection) *v1alpha1.Scheduling {
+	s := &v1alpha1.Scheduling{}
+	if defaults := config.Get().InjectorScheduling; defaults != nil {
+		s = defaults.DeepCopy()
+	}
+
+	if injection == nil || injection.Spec.Scheduling == nil {
+		return s
+	}
+
+	own := injection.Spec.Scheduling.DeepCopy()
+	if own.NodeSelector != nil {
+		s.NodeSelector = own.NodeSelector
+	}
+
+	if own.Tolerations != nil {
+		s.Tolerations = own.Tolerations
+	}
+
+	if own.Affinity != nil {
+		s.Affinity = own.Affinity
+	}
+
+	if own.PriorityClassName != "" {
+		s.PriorityClassName = own.PriorityClassName
+	}
+
+	if own.Resources != nil {
+		s.Resources = own.Resources
+	}
+
+	s.TolerateAll = s.TolerateAll || own.TolerateAll
+
+	return s
+}
+
+// applyScheduling sets the scheduling to the pod spec.
+func applyScheduling(podSpec *corev1.PodSpec, s *v1alpha1.Scheduling) {
+	podSpec.NodeSelector = s.NodeSelector
+	podSpec.Tolerations = tolerations(s)
+	podSpec.PriorityClassName = s.PriorityClassName
+
+	if s.Resources != nil {
+		for i := range podSpec.Containers {
+			podSpec.Containers[i].Resources = *s.Resources.DeepCopy()
+		}
+	}
+
+	podSpec.Affinity = s.Affinity.DeepCopy()
+}
+
+// tolerations returns the tolerations of the scheduling.
+func tolerations(s *v1alpha1.Scheduling) []corev1.Toleration {
+	if s.TolerateAll {
+		return []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	}
+
+	return s.Tolerations
+}
+
+// mergeAffinity adds the first required node selector term of the restriction into each of the required terms of
+// the affinity, then the pod is scheduled to the nodes matching both of them.
+func mergeAffinity(affinity *corev1.Affinity, restriction *corev1.Affinity) *corev1.Affinity {
+	if affinity == nil {
+		return restriction
+	}
+
+	merged := affinity.DeepCopy()
+
+	required := requiredTerm(restriction)
+	if required == nil {
+		return merged
+	}
+
+	if merged.NodeAffinity == nil {
+		merged.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	selector := merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if selector == nil || len(selector.NodeSelectorTerms) == 0 {
+		merged.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{*required},
+		}
+
+		return merged
+	}
+
+	// The terms are ORed, and the requirements of a term are ANDed.
+	for i := range selector.NodeSelectorTerms {
+		term := &selector.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, required.MatchExpressions...)
+		term.MatchFields = append(term.MatchFields, required.MatchFields...)
+	}
+
+	return merged
+}
+
+// requiredTerm returns the first required node selector term of the affinity.
+func requiredTerm(affinity *corev1.Affinity) *corev1.NodeSelectorTerm {
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil ||
+		len(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0 {
+		return nil
+	}
+
+	return &affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0]
+}
+
+// schedulable checks whether the injectors with the scheduling can run on the node.
+// It's used for the pods bypassing the scheduler by the node name.
+func schedulable(node *corev1.Node, s *v1alpha1.Scheduling) bool {
+	if !labels.SelectorFromSet(s.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	if s.Affinity != nil && s.Affinity.NodeAffinity != nil {
+		if selector := s.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; selector != nil &&
+			len(selector.NodeSelectorTerms) > 0 && !matchTerms(node, selector.NodeSelectorTerms) {
+			return false
+		}
+	}
+
+	tols := tolerations(s)
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for j := range tols {
+			if tols[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+
+		if !tolerated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchTerms checks whether the node matches any of the node selector terms.
+func matchTerms(node *corev1.Node, terms []corev1.NodeSelectorTerm) bool {
+	for _, term := range terms {
+		// An empty term matches no node.
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		matched := true
+		for _, req := range term.MatchExpressions {
+			if !matchRequirement(node.Labels, req) {
+				matched = false
+				break
+			}
+		}
+
+		for _, req := range term.MatchFields {
+			if !matched {
+				break
+			}
+
+			// metadata.name is the only field supported.
+			if req.Key != nodeNameField || !matchRequirement(map[string]string{nodeNameField: node.Name}, req) {
+				matched = false
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchRequirement checks whether the values match the node selector requirement.
+func matchRequirement(values map[string]string, req corev1.NodeSelectorRequirement) bool {
+	v, ok := values[req.Key]
+
+	switch req.Operator {
+	case corev1.NodeSelectorOpIn:
+		return ok && contains(req.Values, v)
+	case corev1.NodeSelectorOpNotIn:
+		return !ok || !contains(req.Values, v)
+	case corev1.NodeSelectorOpExists:
+		return ok
+	case corev1.NodeSelectorOpDoesNotExist:
+		return !ok
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		if !ok || len(req.Values) != 1 {
+			return false
+		}
+
+		actual, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return false
+		}
+
+		expected, err := strconv.ParseInt(req.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+
+		if req.Operator == corev1.NodeSelectorOpGt {
+			return actual > expected
+		}
+
+		return actual < expected
+	default:
+		return false
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameScheduling checks whether the pod specs are scheduled the same way.
+func sameScheduling(current *corev1.PodSpec, expected *corev1.PodSpec) bool {
+	return equality.Semantic.DeepEqual(current.Affinity, expected.Affinity) &&
+		equality.Semantic.DeepEqual(current.Tolerations, expected.Tolerations) &&
+		equality.Semantic.DeepEqual(current.NodeSelector, expected.NodeSelector) &&
+		current.PriorityClassName == expected.PriorityClassName
+}
@@ -0,0 +1,291 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSchedulable(t *testing.T) {
+	gpuTaint := func(effect corev1.TaintEffect) corev1.Taint {
+		return corev1.Taint{Key: "nvidia.com/gpu", Value: "true", Effect: effect}
+	}
+
+	cases := []struct {
+		name        string
+		labels      map[string]string
+		taints      []corev1.Taint
+		scheduling  v1alpha1.Scheduling
+		schedulable bool
+	}{
+		{
+			name:        "no taint",
+			schedulable: true,
+		},
+		{
+			name:   "NoSchedule taint not tolerated",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoSchedule)},
+		},
+		{
+			name:   "NoExecute taint not tolerated",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoExecute)},
+		},
+		{
+			name:        "PreferNoSchedule taint ignored",
+			taints:      []corev1.Taint{gpuTaint(corev1.TaintEffectPreferNoSchedule)},
+			schedulable: true,
+		},
+		{
+			name:   "NoSchedule toleration does not tolerate NoExecute taint",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoExecute)},
+			scheduling: v1alpha1.Scheduling{Tolerations: []corev1.Toleration{
+				{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+			}},
+		},
+		{
+			name:   "toleration without effect tolerates NoSchedule and NoExecute taints",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoSchedule), gpuTaint(corev1.TaintEffectNoExecute)},
+			scheduling: v1alpha1.Scheduling{Tolerations: []corev1.Toleration{
+				{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists},
+			}},
+			schedulable: true,
+		},
+		{
+			name:   "Equal toleration with the same value",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoSchedule)},
+			scheduling: v1alpha1.Scheduling{Tolerations: []corev1.Toleration{
+				{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpEqual, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+			}},
+			schedulable: true,
+		},
+		{
+			name:   "Equal toleration with another value",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoSchedule)},
+			scheduling: v1alpha1.Scheduling{Tolerations: []corev1.Toleration{
+				{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpEqual, Value: "false", Effect: corev1.TaintEffectNoSchedule},
+			}},
+		},
+		{
+			name:   "Exists toleration of another key",
+			taints: []corev1.Taint{gpuTaint(corev1.TaintEffectNoSchedule)},
+			scheduling: v1alpha1.Scheduling{Tolerations: []corev1.Toleration{
+				{Key: "spot", Operator: corev1.TolerationOpExists},
+			}},
+		},
+		{
+			name:        "tolerate all",
+			taints:      []corev1.Taint{gpuTaint(corev1.TaintEffectNoSchedule), gpuTaint(corev1.TaintEffectNoExecute)},
+			scheduling:  v1alpha1.Scheduling{TolerateAll: true},
+			schedulable: true,
+		},
+		{
+			name:       "node selector not matched",
+			labels:     map[string]string{"kubernetes.io/os": "windows"},
+			scheduling: v1alpha1.Scheduling{NodeSelector: map[string]string{"kubernetes.io/os": "linux"}},
+		},
+		{
+			name:        "node selector matched",
+			labels:      map[string]string{"kubernetes.io/os": "linux"},
+			scheduling:  v1alpha1.Scheduling{NodeSelector: map[string]string{"kubernetes.io/os": "linux"}},
+			schedulable: true,
+		},
+		{
+			name: "affinity of the node name matched",
+			scheduling: v1alpha1.Scheduling{Affinity: requiredAffinity(corev1.NodeSelectorTerm{
+				MatchFields: []corev1.NodeSelectorRequirement{nodeNameIn("node-1")},
+			})},
+			schedulable: true,
+		},
+		{
+			name: "affinity of the node name not matched",
+			scheduling: v1alpha1.Scheduling{Affinity: requiredAffinity(corev1.NodeSelectorTerm{
+				MatchFields: []corev1.NodeSelectorRequirement{nodeNameIn("node-2")},
+			})},
+		},
+		{
+			name:   "affinity of the labels matched by any term",
+			labels: map[string]string{"pool": "gpu"},
+			scheduling: v1alpha1.Scheduling{Affinity: requiredAffinity(
+				corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"spot"}},
+				}},
+				corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: "pool", Operator: corev1.NodeSelectorOpExists},
+				}},
+			)},
+			schedulable: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: c.labels},
+				Spec:       corev1.NodeSpec{Taints: c.taints},
+			}
+
+			if got := schedulable(node, &c.scheduling); got != c.schedulable {
+				t.Fatalf("expected schedulable %v, got %v", c.schedulable, got)
+			}
+		})
+	}
+}
+
+func TestMergeAffinity(t *testing.T) {
+	restriction := requiredAffinity(corev1.NodeSelectorTerm{
+		MatchFields: []corev1.NodeSelectorRequirement{nodeNameIn("node-1", "node-2")},
+	})
+
+	gpu := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"gpu"}}
+	spot := corev1.NodeSelectorRequirement{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"spot"}}
+	pinned := nodeNameIn("node-3")
+
+	preferred := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+			{Weight: 1, Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{gpu}}},
+		},
+	}}
+
+	withPreferred := preferred.DeepCopy()
+	withPreferred.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = restriction.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.DeepCopy()
+
+	cases := []struct {
+		name        string
+		affinity    *corev1.Affinity
+		restriction *corev1.Affinity
+		expected    *corev1.Affinity
+	}{
+		{
+			name:        "no affinity",
+			restriction: restriction,
+			expected:    restriction,
+		},
+		{
+			name:     "no restriction",
+			affinity: requiredAffinity(corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{gpu}}),
+			expected: requiredAffinity(corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{gpu}}),
+		},
+		{
+			name:        "no required terms",
+			affinity:    preferred,
+			restriction: restriction,
+			expected:    withPreferred,
+		},
+		{
+			name: "restriction added to each term",
+			affinity: requiredAffinity(
+				corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{gpu}},
+				corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{spot}},
+			),
+			restriction: restriction,
+			expected: requiredAffinity(
+				corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{gpu},
+					MatchFields:      []corev1.NodeSelectorRequirement{nodeNameIn("node-1", "node-2")},
+				},
+				corev1.NodeSelectorTerm{
+					MatchExpressions: []corev1.NodeSelectorRequirement{spot},
+					MatchFields:      []corev1.NodeSelectorRequirement{nodeNameIn("node-1", "node-2")},
+				},
+			),
+		},
+		{
+			name:        "MatchFields merged",
+			affinity:    requiredAffinity(corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{pinned}}),
+			restriction: restriction,
+			expected: requiredAffinity(corev1.NodeSelectorTerm{
+				MatchFields: []corev1.NodeSelectorRequirement{pinned, nodeNameIn("node-1", "node-2")},
+			}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			original := c.affinity.DeepCopy()
+
+			merged := mergeAffinity(c.affinity, c.restriction)
+			if !equality.Semantic.DeepEqual(merged, c.expected) {
+				t.Fatalf("expected %+v, got %+v", c.expected, merged)
+			}
+
+			if !equality.Semantic.DeepEqual(c.affinity, original) {
+				t.Fatal("expected the affinity not to be modified")
+			}
+		})
+	}
+}
+
+func TestSameScheduling(t *testing.T) {
+	base := corev1.PodSpec{
+		NodeSelector:      map[string]string{"kubernetes.io/os": "linux"},
+		Tolerations:       []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}},
+		Affinity:          requiredAffinity(corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{nodeNameIn("node-1")}}),
+		PriorityClassName: "system-node-critical",
+	}
+
+	cases := []struct {
+		name   string
+		modify func(spec *corev1.PodSpec)
+		same   bool
+	}{
+		{name: "same", modify: func(_ *corev1.PodSpec) {}, same: true},
+		{name: "containers changed", modify: func(spec *corev1.PodSpec) {
+			spec.Containers = []corev1.Container{{Name: "cert-injector"}}
+		}, same: true},
+		{name: "node selector changed", modify: func(spec *corev1.PodSpec) {
+			spec.NodeSelector = nil
+		}},
+		{name: "toleration effect changed", modify: func(spec *corev1.PodSpec) {
+			spec.Tolerations[0].Effect = corev1.TaintEffectNoExecute
+		}},
+		{name: "toleration operator changed", modify: func(spec *corev1.PodSpec) {
+			spec.Tolerations[0].Operator = corev1.TolerationOpEqual
+			spec.Tolerations[0].Value = "true"
+		}},
+		{name: "MatchFields changed", modify: func(spec *corev1.PodSpec) {
+			spec.Affinity = requiredAffinity(corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{nodeNameIn("node-1", "node-2")}})
+		}},
+		{name: "priority class changed", modify: func(spec *corev1.PodSpec) {
+			spec.PriorityClassName = ""
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := base.DeepCopy()
+			c.modify(expected)
+
+			if got := sameScheduling(&base, expected); got != c.same {
+				t.Fatalf("expected same %v, got %v", c.same, got)
+			}
+		})
+	}
+}
+
+func requiredAffinity(terms ...corev1.NodeSelectorTerm) *corev1.Affinity {
+	return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: terms},
+	}}
+}
+
+func nodeNameIn(nodes ...string) corev1.NodeSelectorRequirement {
+	return corev1.NodeSelectorRequirement{Key: nodeNameField, Operator: corev1.NodeSelectorOpIn, Values: nodes}
+}
@@ -0,0 +1,86 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// applyAgentSettings sets the image, the image pull secrets and the security context set for the operator
+// to the agent pod.
+// The pod meets the baseline Pod Security Standard except the hostPath volumes of the certs directories:
+// no privilege escalation, all the capabilities dropped unless added explicitly and the runtime default seccomp profile.
+func applyAgentSettings(podSpec *corev1.PodSpec) {
+	opts := config.Get()
+
+	podSpec.ImagePullSecrets = nil
+	for _, name := range opts.InjectorImagePullSecrets {
+		podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+
+	podSpec.SecurityContext = &corev1.PodSecurityContext{
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Image = opts.InjectorImage
+		podSpec.Containers[i].SecurityContext = agentSecurityContext(opts)
+	}
+}
+
+// agentSecurityContext returns the security context of the agent container.
+func agentSecurityContext(opts *config.Options) *corev1.SecurityContext {
+	runAsUser := opts.InjectorRunAsUser
+	readOnlyRootFilesystem := opts.InjectorReadOnlyRootFilesystem
+	privileged := false
+	allowPrivilegeEscalation := false
+
+	capabilities := &corev1.Capabilities{
+		Drop: []corev1.Capability{"ALL"},
+	}
+	for _, c := range opts.InjectorCapabilities {
+		capabilities.Add = append(capabilities.Add, corev1.Capability(c))
+	}
+
+	return &corev1.SecurityContext{
+		RunAsUser:                &runAsUser,
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		Privileged:               &privileged,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		Capabilities:             capabilities,
+	}
+}
+
+// sameAgentSettings checks whether the pod specs run the agent with the same pull secrets and security context.
+func sameAgentSettings(current *corev1.PodSpec, expected *corev1.PodSpec) bool {
+	if !equality.Semantic.DeepEqual(current.ImagePullSecrets, expected.ImagePullSecrets) ||
+		!equality.Semantic.DeepEqual(current.SecurityContext, expected.SecurityContext) ||
+		len(current.Containers) != len(expected.Containers) {
+		return false
+	}
+
+	for i := range current.Containers {
+		if !equality.Semantic.DeepEqual(current.Containers[i].SecurityContext, expected.Containers[i].SecurityContext) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,761 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/agent"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// SharedInjectorRole is the role of the shared injectors.
+	SharedInjectorRole = "shared-injector"
+
+	sharedName       = "shared"
+	bundleSecretName = "cert-injection-bundle"
+	bundleMountPath  = "/etc/harbor-cert-injector/bundle"
+	bundleVolumeName = "bundle"
+)
+
+// sharedCertsPaths are all the certs directories managed by the shared injectors, and whether the hosts.toml is used.
+// They're always mounted, then adding or removing an injection only changes the bundle.
+var sharedCertsPaths = []struct {
+	path      string
+	hostsTOML bool
+}{
+	{path: compatibleCertsPath},
+	{path: containerdCertsPath, hostsTOML: true},
+	{path: containersCertsPath},
+}
+
+// sharedProvider injects the CA of all the cert injections by the shared injectors in the operator namespace.
+// The registries and the CA certs of the injections are aggregated into the bundle secret mounted by the injectors,
+// and the injectors are rolled with the revision of the bundle, then the rollout tells when it's applied on the nodes.
+type sharedProvider struct {
+	*provider
+	namespace string
+}
+
+func init() {
+	Register(SharedStrategy, func(opts *Options) Provider {
+		return NewSharedProvider(opts.Client, opts.Scheme, opts.Recorder, opts.Namespace)
+	})
+}
+
+// NewSharedProvider news a provider doing injection through the shared injectors in the namespace.
+// The recorder is optional, no event is recorded if it's nil.
+func NewSharedProvider(client client.Client, scheme *runtime.Scheme, recorder record.EventRecorder, namespace string) Provider {
+	return &sharedProvider{
+		provider: &provider{
+			Client:   client,
+			scheme:   scheme,
+			recorder: recorder,
+		},
+		namespace: namespace,
+	}
+}
+
+// Inject implements injector.Provider.
+func (p *sharedProvider) Inject(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	res, err := p.sync(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := res.skipped[client.ObjectKeyFromObject(injection)]; err != nil {
+		return errs.Wrap("injection is skipped by the shared injectors", err)
+	}
+
+	refs := make([]corev1.ObjectReference, 0, len(res.injectors))
+	for _, ds := range res.injectors {
+		objRef, err := reference.GetReference(p.scheme, ds)
+		if err != nil {
+			return errs.Wrap("failed to get ds reference", err)
+		}
+
+		refs = append(refs, *objRef)
+	}
+
+	p.setInjectors(injection, refs)
+
+	return nil
+}
+
+// Observe implements injector.Provider.
+func (p *sharedProvider) Observe(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	dsList := &appv1.DaemonSetList{}
+	if err := p.List(ctx, dsList, client.InNamespace(p.namespace), client.MatchingLabels(sharedLabels())); err != nil {
+		return errs.Wrap("failed to list the shared injectors", err)
+	}
+
+	injectors := make([]*appv1.DaemonSet, 0, len(dsList.Items))
+	for i := range dsList.Items {
+		injectors = append(injectors, &dsList.Items[i])
+	}
+
+	return p.observeNodes(ctx, injection, injectors)
+}
+
+// Release implements injector.Provider.
+// The injection switching to another strategy is retained in the bundle, then the shared injectors leave its files
+// on the nodes to the injectors of the new strategy instead of removing them.
+func (p *sharedProvider) Release(ctx context.Context, injection *v1alpha1.CertInjection) error {
+	if injection == nil {
+		return errs.New("nil cert injection obj")
+	}
+
+	_, err := p.sync(ctx, client.ObjectKeyFromObject(injection))
+	return err
+}
+
+// Watches implements injector.Provider.
+func (p *sharedProvider) Watches() []Watch {
+	return []Watch{{Type: &appv1.DaemonSet{}, Labels: sharedLabels()}}
+}
+
+// DependsOnNodes implements injector.Provider.
+// The shared injectors always detect the runtime from the nodes.
+func (p *sharedProvider) DependsOnNodes(_ *v1alpha1.CertInjection) bool {
+	return true
+}
+
+// DesiredInjectors implements injector.Provider.
+func (p *sharedProvider) DesiredInjectors(ctx context.Context, _ *v1alpha1.CertInjection) ([]client.Object, error) {
+	groups, err := p.sharedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := p.getBundle(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var revision string
+	if secret != nil {
+		revision = bundleRevision(secret.Data)
+	}
+
+	objs := make([]client.Object, 0, len(groups))
+	for _, g := range groups {
+		objs = append(objs, p.desiredSharedInjector(g.runtime, g.restricted, revision))
+	}
+
+	return objs, nil
+}
+
+// Cleanup implements injector.Provider.
+// The injection being deleted is removed from the bundle, and it's cleaned up after the shared injectors have rolled
+// out the new bundle, which means its files have been removed from the nodes.
+// The shared injectors and the bundle are removed along with the last injection.
+func (p *sharedProvider) Cleanup(ctx context.Context, injection *v1alpha1.CertInjection) (bool, error) {
+	if injection == nil {
+		return false, errs.New("nil cert injection obj")
+	}
+
+	res, err := p.sync(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ds := range res.injectors {
+		cleaned, err := p.cleanedUp(ctx, ds)
+		if err != nil {
+			return false, err
+		}
+
+		if !cleaned {
+			return false, nil
+		}
+	}
+
+	// Nothing else is injected or being cleaned up by the shared injectors.
+	if !res.inUse && res.cleaning <= 1 {
+		if err := p.gc(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	p.event(injection, corev1.EventTypeNormal, mytypes.EventReasonCleanupCompleted,
+		"Injection is removed from the bundle of the shared injectors")
+
+	return true, nil
+}
+
+// syncResult is the result of syncing the shared injectors.
+type syncResult struct {
+	// injectors are the shared injectors of the container runtimes in use.
+	injectors []*appv1.DaemonSet
+	// skipped are the injections which can't be injected, with the causes.
+	skipped map[types.NamespacedName]error
+	// inUse indicates whether any injection is injected by the shared injectors.
+	inUse bool
+	// cleaning is the count of the injections whose files are being removed by the shared injectors.
+	cleaning int
+}
+
+// sync renders the bundle of all the cert injections, and creates or updates the shared injectors.
+// The injections which can't be injected are skipped with the errors returned, and the others are still injected.
+// The injections to retain, and the ones retained before, are kept in the bundle until they're deleted or
+// switched back. The shared injectors and the bundle are removed when nothing is injected or being cleaned up.
+func (p *sharedProvider) sync(ctx context.Context, retain ...types.NamespacedName) (*syncResult, error) {
+	ciList := &v1alpha1.CertInjectionList{}
+	if err := p.List(ctx, ciList); err != nil {
+		return nil, errs.Wrap("failed to list cert injections", err)
+	}
+
+	secret, err := p.getBundle(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	retainedKeys := make(map[string]bool)
+	if secret != nil {
+		for _, key := range strings.Split(secret.Annotations[mytypes.RetainedInjectionsAnnotationKey], ",") {
+			retainedKeys[key] = key != ""
+		}
+	}
+
+	for _, key := range retain {
+		retainedKeys[key.String()] = true
+	}
+
+	res := &syncResult{}
+	var injections, retained []*v1alpha1.CertInjection
+	for i := range ciList.Items {
+		ci := &ciList.Items[i]
+		switch shared := StrategyOf(ci) == SharedStrategy; {
+		case !ci.DeletionTimestamp.IsZero():
+			if shared && controllerutil.ContainsFinalizer(ci, mytypes.CleanupFinalizer) {
+				res.cleaning++
+			}
+		case shared:
+			injections = append(injections, ci)
+		case retainedKeys[client.ObjectKeyFromObject(ci).String()]:
+			retained = append(retained, ci)
+		}
+	}
+
+	res.inUse = len(injections) > 0
+	if !res.inUse && res.cleaning == 0 {
+		return res, p.gc(ctx)
+	}
+
+	groups, err := p.sharedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, skipped, err := p.renderBundle(ctx, injections, retained, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, err := range skipped {
+		log.FromContext(ctx).Info("Skip the injection by the shared injectors", "injection", key, "cause", err.Error())
+	}
+
+	res.skipped = skipped
+
+	if err := p.applyBundle(ctx, secret, data, retained); err != nil {
+		return nil, err
+	}
+
+	res.injectors, err = p.applyInjectors(ctx, groups, bundleRevision(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// sharedGroups returns the container runtimes in use.
+func (p *sharedProvider) sharedGroups(ctx context.Context) ([]runtimeGroup, error) {
+	// The shared injectors always detect the runtime from the nodes.
+	return p.runtimeGroups(ctx, &v1alpha1.CertInjection{})
+}
+
+// renderBundle renders the data of the bundle secret, which contains a bundle file for each runtime group
+// and the distinct CA certs of the injections using the shared strategy.
+// The injections are handled by the creation time, a host already injected into the same certs directory
+// is skipped. The hosts of the retained injections not injected by others are rendered as retained.
+func (p *sharedProvider) renderBundle(ctx context.Context, injections []*v1alpha1.CertInjection,
+	retained []*v1alpha1.CertInjection, groups []runtimeGroup) (map[string][]byte, map[types.NamespacedName]error, error) {
+	sortByCreation(injections)
+	sortByCreation(retained)
+
+	data := make(map[string][]byte)
+	skipped := make(map[types.NamespacedName]error)
+
+	// Read the CA certs first, the injections with missing CA certs are skipped.
+	caFiles := make(map[types.NamespacedName]string)
+	for _, ci := range injections {
+		for _, r := range ci.Spec.EffectiveRegistries() {
+			key := types.NamespacedName{Namespace: ci.Namespace, Name: r.CertSecret.Name}
+			if _, ok := caFiles[key]; ok {
+				continue
+			}
+
+			ca, err := p.readCA(ctx, key)
+			if err != nil {
+				skipped[client.ObjectKeyFromObject(ci)] = err
+				break
+			}
+
+			caFiles[key] = fmt.Sprintf("ca-%d.crt", len(caFiles))
+			data[caFiles[key]] = ca
+		}
+	}
+
+	for _, g := range groups {
+		bundle := &agent.Bundle{}
+		targets := make(map[string]*agent.Target, len(sharedCertsPaths))
+		for _, sp := range sharedCertsPaths {
+			bundle.Targets = append(bundle.Targets, agent.Target{CertsDir: sp.path, HostsTOML: sp.hostsTOML})
+		}
+		for i := range bundle.Targets {
+			targets[bundle.Targets[i].CertsDir] = &bundle.Targets[i]
+		}
+
+		claimed := make(map[string]map[string]bool)
+		target := func(ci *v1alpha1.CertInjection) *agent.Target {
+			runtime := g.runtime
+			if !IsAutoRuntime(ci) {
+				runtime = ci.Spec.ContainerRuntime
+			}
+
+			t := targets[certsPath(runtime, ci.Spec.Mode)]
+			if claimed[t.CertsDir] == nil {
+				claimed[t.CertsDir] = make(map[string]bool)
+			}
+
+			return t
+		}
+
+		for _, ci := range injections {
+			key := client.ObjectKeyFromObject(ci)
+			if skipped[key] != nil {
+				continue
+			}
+
+			t := target(ci)
+			for i, r := range ci.Spec.EffectiveRegistries() {
+				registry := agent.Registry{
+					CAFile: caFiles[types.NamespacedName{Namespace: ci.Namespace, Name: r.CertSecret.Name}],
+				}
+
+				for _, h := range r.Hosts {
+					if !claimed[t.CertsDir][h] {
+						claimed[t.CertsDir][h] = true
+						registry.Hosts = append(registry.Hosts, h)
+					}
+				}
+
+				if len(registry.Hosts) == 0 {
+					continue
+				}
+
+				if cfg := ci.Spec.HostsConfig; cfg != nil && t.HostsTOML {
+					for _, c := range cfg.Capabilities {
+						registry.Capabilities = append(registry.Capabilities, string(c))
+					}
+
+					// Same as the injectors of the injection, the mirrors only take effect on the first registry.
+					if i == 0 {
+						registry.Mirrors = cfg.Mirrors
+					}
+				}
+
+				t.Registries = append(t.Registries, registry)
+			}
+		}
+
+		// The files of the retained injections are left on the nodes for the injectors they've switched to.
+		for _, ci := range retained {
+			t := target(ci)
+			registry := agent.Registry{Retained: true}
+			for _, r := range ci.Spec.EffectiveRegistries() {
+				for _, h := range r.Hosts {
+					if !claimed[t.CertsDir][h] {
+						claimed[t.CertsDir][h] = true
+						registry.Hosts = append(registry.Hosts, h)
+					}
+				}
+			}
+
+			if len(registry.Hosts) > 0 {
+				t.Registries = append(t.Registries, registry)
+			}
+		}
+
+		content, err := json.Marshal(bundle)
+		if err != nil {
+			return nil, nil, errs.Wrap("failed to marshal bundle", err)
+		}
+
+		data[bundleFileName(g.runtime)] = content
+	}
+
+	return data, skipped, nil
+}
+
+// readCA reads the CA cert from the CA secret of the injection.
+func (p *sharedProvider) readCA(ctx context.Context, key types.NamespacedName) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := p.Get(ctx, key, secret); err != nil {
+		return nil, errs.Wrap(fmt.Sprintf("failed to get CA secret %s", key), err)
+	}
+
+	ca := secret.Data[caFileName]
+	if len(ca) == 0 {
+		return nil, errs.Errorf("no %s in CA secret %s", caFileName, key)
+	}
+
+	return ca, nil
+}
+
+// getBundle gets the bundle secret, nil is returned if it does not exist.
+func (p *sharedProvider) getBundle(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := p.Get(ctx, types.NamespacedName{Namespace: p.namespace, Name: bundleSecretName}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, errs.Wrap("failed to get bundle secret", err)
+	}
+
+	return secret, nil
+}
+
+// applyBundle creates or updates the bundle secret, which records the retained injections as well.
+func (p *sharedProvider) applyBundle(ctx context.Context, secret *corev1.Secret, data map[string][]byte,
+	retained []*v1alpha1.CertInjection) error {
+	keys := make([]string, 0, len(retained))
+	for _, ci := range retained {
+		keys = append(keys, client.ObjectKeyFromObject(ci).String())
+	}
+
+	sort.Strings(keys)
+
+	if secret == nil {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: p.namespace,
+				Name:      bundleSecretName,
+				Labels:    sharedLabels(),
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}
+
+		if len(keys) > 0 {
+			secret.Annotations = map[string]string{mytypes.RetainedInjectionsAnnotationKey: strings.Join(keys, ",")}
+		}
+
+		if err := p.Create(ctx, secret); err != nil {
+			return errs.Wrap("failed to create bundle secret", err)
+		}
+
+		return nil
+	}
+
+	if equality.Semantic.DeepEqual(secret.Data, data) &&
+		secret.Annotations[mytypes.RetainedInjectionsAnnotationKey] == strings.Join(keys, ",") {
+		return nil
+	}
+
+	secret.Data = data
+	if len(keys) > 0 {
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+
+		secret.Annotations[mytypes.RetainedInjectionsAnnotationKey] = strings.Join(keys, ",")
+	} else {
+		delete(secret.Annotations, mytypes.RetainedInjectionsAnnotationKey)
+	}
+
+	if err := p.Update(ctx, secret); err != nil {
+		return errs.Wrap("failed to update bundle secret", err)
+	}
+
+	return nil
+}
+
+// gc removes the shared injectors and the bundle secret, the injected files are left on the nodes.
+func (p *sharedProvider) gc(ctx context.Context) error {
+	dsList := &appv1.DaemonSetList{}
+	if err := p.List(ctx, dsList, client.InNamespace(p.namespace), client.MatchingLabels(sharedLabels())); err != nil {
+		return errs.Wrap("failed to list the shared injectors", err)
+	}
+
+	for i := range dsList.Items {
+		if err := p.Delete(ctx, &dsList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return errs.Wrap("failed to delete the shared injector", err)
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: p.namespace,
+			Name:      bundleSecretName,
+		},
+	}
+	if err := p.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+		return errs.Wrap("failed to delete bundle secret", err)
+	}
+
+	return nil
+}
+
+// applyInjectors creates or updates the shared injectors of the runtime groups, and removes the stale ones.
+// The injectors are rolled when the revision of the bundle is changed.
+func (p *sharedProvider) applyInjectors(ctx context.Context, groups []runtimeGroup, revision string) ([]*appv1.DaemonSet, error) {
+	dsList := &appv1.DaemonSetList{}
+	if err := p.List(ctx, dsList, client.InNamespace(p.namespace), client.MatchingLabels(sharedLabels())); err != nil {
+		return nil, errs.Wrap("failed to list the shared injectors", err)
+	}
+
+	existing := make(map[string]*appv1.DaemonSet, len(dsList.Items))
+	for i := range dsList.Items {
+		existing[dsList.Items[i].Name] = &dsList.Items[i]
+	}
+
+	injectors := make([]*appv1.DaemonSet, 0, len(groups))
+	for _, g := range groups {
+		desired := p.desiredSharedInjector(g.runtime, g.restricted, revision)
+
+		ds, ok := existing[desired.Name]
+		if !ok {
+			if err := p.Create(ctx, desired); err != nil {
+				return nil, errs.Wrap("failed to create the shared injector", err)
+			}
+
+			injectors = append(injectors, desired)
+			continue
+		}
+
+		delete(existing, desired.Name)
+
+		if ds.Spec.Template.Annotations[mytypes.BundleRevisionAnnotationKey] != revision ||
+			!sameContainers(ds, desired) ||
+			!equality.Semantic.DeepEqual(ds.Spec.Template.Spec.Volumes, desired.Spec.Template.Spec.Volumes) ||
+			!sameScheduling(&ds.Spec.Template.Spec, &desired.Spec.Template.Spec) ||
+			!sameAgentSettings(&ds.Spec.Template.Spec, &desired.Spec.Template.Spec) {
+			ds.Spec = *desired.Spec.DeepCopy()
+			ds.Labels = desired.Labels
+
+			if err := p.Update(ctx, ds); err != nil {
+				return nil, errs.Wrap("failed to update the shared injector", err)
+			}
+		}
+
+		injectors = append(injectors, ds)
+	}
+
+	// Remove the injectors of the container runtimes which are no longer in use.
+	for _, ds := range existing {
+		if err := p.Delete(ctx, ds); client.IgnoreNotFound(err) != nil {
+			return nil, errs.Wrap("failed to delete stale shared injector", err)
+		}
+	}
+
+	return injectors, nil
+}
+
+// desiredSharedInjector renders the shared injector of the container runtime with the revision of the bundle.
+// If restricted, the injector only runs on the nodes of the runtime.
+func (p *sharedProvider) desiredSharedInjector(runtime v1alpha1.ContainerRuntime, restricted bool, revision string) *appv1.DaemonSet {
+	name := runtimeDsName(dsNamePrefix, sharedName, runtime, restricted)
+
+	labels := sharedLabels()
+	labels["k8s-app"] = "cert-auto-injector"
+	labels[mytypes.ContainerRuntimeLabel] = strings.ToLower(string(runtime))
+
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      bundleVolumeName,
+			MountPath: bundleMountPath,
+			ReadOnly:  true,
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: bundleVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: bundleSecretName,
+				},
+			},
+		},
+	}
+
+	// Mount the certs directories at the same paths as on the node.
+	hostPathType := corev1.HostPathDirectoryOrCreate
+	for i, sp := range sharedCertsPaths {
+		volumeName := fmt.Sprintf("certs-path-%d", i)
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: sp.path,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: sp.path,
+					Type: &hostPathType,
+				},
+			},
+		})
+	}
+
+	podSpec := corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name: "cert-injector",
+				Command: []string{
+					agentCmd,
+				},
+				Args: []string{
+					fmt.Sprintf("--id=%s", sharedName),
+					fmt.Sprintf("--bundle=%s/%s", bundleMountPath, bundleFileName(runtime)),
+					fmt.Sprintf("--health-probe-bind-address=:%d", agentPort),
+				},
+				VolumeMounts: mounts,
+				Ports: []corev1.ContainerPort{
+					{
+						Name:          "probe",
+						ContainerPort: agentPort,
+					},
+				},
+				// The pod is ready only when the injected files are verified.
+				ReadinessProbe: agentProbe("/readyz", 10),
+				LivenessProbe:  agentProbe("/healthz", 30),
+			},
+		},
+		Volumes:                       volumes,
+		TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
+	}
+
+	applyAgentSettings(&podSpec)
+	// The shared injectors are scheduled as set for the operator.
+	applyScheduling(&podSpec, schedulingOf(nil))
+	podSpec.Affinity = runtimeAffinity(podSpec.Affinity, runtime, restricted)
+
+	return &appv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: p.namespace,
+			Labels:    labels,
+		},
+		Spec: appv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": name,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"name": name,
+					},
+					Annotations: map[string]string{
+						mytypes.BundleRevisionAnnotationKey: revision,
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// bundleRevision hashes the data of the bundle secret.
+func bundleRevision(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	h := sha256.New()
+	// Writing to a hash never fails.
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write(data[k])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:10]
+}
+
+// sortByCreation sorts the injections by the creation time, and then by the namespace and name.
+func sortByCreation(injections []*v1alpha1.CertInjection) {
+	sort.SliceStable(injections, func(i, j int) bool {
+		ti, tj := injections[i].CreationTimestamp, injections[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+
+		return client.ObjectKeyFromObject(injections[i]).String() < client.ObjectKeyFromObject(injections[j]).String()
+	})
+}
+
+// bundleFileName returns the name of the bundle file of the container runtime in the bundle secret.
+func bundleFileName(runtime v1alpha1.ContainerRuntime) string {
+	return fmt.Sprintf("bundle-%s.json", strings.ToLower(string(runtime)))
+}
+
+// sharedLabels are the labels of the shared injectors and the bundle secret.
+func sharedLabels() map[string]string {
+	return map[string]string{
+		mytypes.InjectorRoleLabel: SharedInjectorRole,
+	}
+}
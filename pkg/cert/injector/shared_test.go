@@ -0,0 +1,215 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/agent"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const sharedNamespace = "cert-injector-system"
+
+func newSharedInjection(name string, host string) *v1alpha1.CertInjection {
+	ci := newInjection()
+	ci.Name = name
+	ci.Spec.ExternalDNS = host
+	ci.Spec.Strategy = SharedStrategy
+	ci.Finalizers = []string{mytypes.CleanupFinalizer}
+
+	return ci
+}
+
+func newCASecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: "ca-secret"},
+		Data:       map[string][]byte{caFileName: []byte("ca")},
+	}
+}
+
+// bundleRegistries returns the registries of the docker certs directory in the bundle.
+func bundleRegistries(t *testing.T, c client.Client) (*corev1.Secret, []agent.Registry) {
+	t.Helper()
+
+	secret := &corev1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: sharedNamespace, Name: bundleSecretName}, secret); err != nil {
+		t.Fatalf("get bundle: %v", err)
+	}
+
+	bundle := &agent.Bundle{}
+	if err := json.Unmarshal(secret.Data[bundleFileName(v1alpha1.ContainerdRuntime)], bundle); err != nil {
+		t.Fatalf("unmarshal bundle: %v", err)
+	}
+
+	for _, target := range bundle.Targets {
+		if target.CertsDir == compatibleCertsPath {
+			return secret, target.Registries
+		}
+	}
+
+	return secret, nil
+}
+
+// TestSharedRelease checks the released injection is retained in the bundle, then its files are left on the nodes.
+func TestSharedRelease(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	kept := newSharedInjection("kept", "kept.example.com")
+	switched := newSharedInjection("switched", "switched.example.com")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kept, switched, newCASecret()).Build()
+
+	p := NewSharedProvider(c, scheme, nil, sharedNamespace)
+	for _, ci := range []*v1alpha1.CertInjection{kept, switched} {
+		if err := p.Inject(ctx, ci); err != nil {
+			t.Fatalf("inject %s: %v", ci.Name, err)
+		}
+	}
+
+	switched.Spec.Strategy = DaemonSetStrategy
+	if err := c.Update(ctx, switched); err != nil {
+		t.Fatalf("update injection: %v", err)
+	}
+
+	if err := p.Release(ctx, switched); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	secret, registries := bundleRegistries(t, c)
+	if got, want := secret.Annotations[mytypes.RetainedInjectionsAnnotationKey], "harbor/switched"; got != want {
+		t.Fatalf("expected retained injections %q, got %q", want, got)
+	}
+
+	if len(registries) != 2 {
+		t.Fatalf("expected 2 registries, got %d", len(registries))
+	}
+
+	if r := registries[0]; r.Retained || r.Hosts[0] != "kept.example.com" {
+		t.Fatalf("expected kept.example.com to be injected, got %+v", r)
+	}
+
+	if r := registries[1]; !r.Retained || r.CAFile != "" || r.Hosts[0] != "switched.example.com" {
+		t.Fatalf("expected switched.example.com to be retained, got %+v", r)
+	}
+
+	// The injection is dropped from the bundle once it's deleted by the new strategy.
+	if err := c.Delete(ctx, switched); err != nil {
+		t.Fatalf("delete injection: %v", err)
+	}
+
+	if err := p.Inject(ctx, kept); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+
+	secret, registries = bundleRegistries(t, c)
+	if len(registries) != 1 || secret.Annotations[mytypes.RetainedInjectionsAnnotationKey] != "" {
+		t.Fatalf("expected only kept.example.com in the bundle, got %+v", registries)
+	}
+}
+
+// TestSharedCleanup checks the cleanup waits for the rollout of the shared injectors,
+// and the shared injectors are removed along with the last injection.
+func TestSharedCleanup(t *testing.T) {
+	ctx := context.Background()
+	scheme := newScheme(t)
+
+	injection := newSharedInjection("last", "last.example.com")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(injection, newCASecret()).Build()
+
+	p := NewSharedProvider(c, scheme, nil, sharedNamespace)
+	if err := p.Inject(ctx, injection); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+
+	if err := c.Delete(ctx, injection); err != nil {
+		t.Fatalf("delete injection: %v", err)
+	}
+
+	if err := c.Get(ctx, client.ObjectKeyFromObject(injection), injection); err != nil {
+		t.Fatalf("get injection: %v", err)
+	}
+
+	setRollout := func(ready int32) {
+		dsList := &appv1.DaemonSetList{}
+		if err := c.List(ctx, dsList, client.InNamespace(sharedNamespace)); err != nil {
+			t.Fatalf("list ds: %v", err)
+		}
+
+		for i := range dsList.Items {
+			ds := &dsList.Items[i]
+			ds.Status = appv1.DaemonSetStatus{
+				DesiredNumberScheduled: 1,
+				UpdatedNumberScheduled: ready,
+				NumberReady:            ready,
+			}
+
+			if err := c.Status().Update(ctx, ds); err != nil {
+				t.Fatalf("update ds status: %v", err)
+			}
+		}
+	}
+
+	setRollout(0)
+
+	done, err := p.Cleanup(ctx, injection)
+	if err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	if done {
+		t.Fatal("expected cleanup to wait for the rollout")
+	}
+
+	if _, registries := bundleRegistries(t, c); len(registries) != 0 {
+		t.Fatalf("expected the injection to be removed from the bundle, got %+v", registries)
+	}
+
+	setRollout(1)
+
+	done, err = p.Cleanup(ctx, injection)
+	if err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	if !done {
+		t.Fatal("expected cleanup to be done after the rollout")
+	}
+
+	dsList := &appv1.DaemonSetList{}
+	if err := c.List(ctx, dsList, client.InNamespace(sharedNamespace)); err != nil {
+		t.Fatalf("list ds: %v", err)
+	}
+
+	if len(dsList.Items) != 0 {
+		t.Fatalf("expected the shared injectors to be removed, got %d", len(dsList.Items))
+	}
+
+	err = c.Get(ctx, types.NamespacedName{Namespace: sharedNamespace, Name: bundleSecretName}, &corev1.Secret{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the bundle secret to be removed, got %v", err)
+	}
+}
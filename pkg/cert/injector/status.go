@@ -0,0 +1,122 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// maxListedNodes is the max number of failing node names listed in the condition message.
+	maxListedNodes = 10
+
+	reasonRollingOut      = "RollingOut"
+	reasonAllInjected     = "AllInjected"
+	reasonInjectionFailed = "InjectionFailed"
+)
+
+// observeNodes counts the nodes where the CA cert has been injected by the injectors and verified.
+// The results are set into the injection status.
+func (p *provider) observeNodes(ctx context.Context, injection *v1alpha1.CertInjection, injectors []*appv1.DaemonSet) error {
+	var desired, injected int32
+	var failing []string
+	rollingOut := false
+
+	for _, ds := range injectors {
+		if ds.Status.ObservedGeneration < ds.Generation {
+			rollingOut = true
+		}
+
+		desired += ds.Status.DesiredNumberScheduled
+		injected += ds.Status.NumberReady
+
+		// The injector pod is ready only when the injected files are verified.
+		pods := &corev1.PodList{}
+		if err := p.List(ctx, pods, client.InNamespace(ds.Namespace), client.MatchingLabels(ds.Spec.Selector.MatchLabels)); err != nil {
+			return errs.Wrap("failed to list the injector pods", err)
+		}
+
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.Spec.NodeName != "" && !isPodReady(pod) {
+				failing = append(failing, pod.Spec.NodeName)
+			}
+		}
+	}
+
+	failed := desired - injected
+	if failed < 0 {
+		failed = 0
+	}
+
+	injection.Status.DesiredNodes = desired
+	injection.Status.InjectedNodes = injected
+	injection.Status.FailedNodes = failed
+
+	cond := v1alpha1.CertInjectionCondition{
+		Type:    mytypes.ConditionNodesInjected,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonAllInjected,
+		Message: fmt.Sprintf("CA cert has been injected into %d nodes", injected),
+	}
+
+	switch {
+	case rollingOut:
+		cond.Status = corev1.ConditionUnknown
+		cond.Reason = reasonRollingOut
+		cond.Message = "Injectors are rolling out"
+	case failed > 0:
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = reasonInjectionFailed
+		cond.Message = fmt.Sprintf("CA cert is not injected into %d of %d nodes", failed, desired)
+		if len(failing) > 0 {
+			cond.Message = fmt.Sprintf("%s: %s", cond.Message, formatNodes(failing))
+		}
+	}
+
+	injection.Status.SetCondition(cond)
+
+	return nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func formatNodes(nodes []string) string {
+	sort.Strings(nodes)
+	if len(nodes) <= maxListedNodes {
+		return strings.Join(nodes, ", ")
+	}
+
+	return fmt.Sprintf("%s and %d more", strings.Join(nodes[:maxListedNodes], ", "), len(nodes)-maxListedNodes)
+}
@@ -0,0 +1,174 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newInjectorDs(name string, desired, ready int32, generation int64) *appv1.DaemonSet {
+	return &appv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: name, Generation: generation},
+		Spec: appv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+		},
+		Status: appv1.DaemonSetStatus{
+			ObservedGeneration:     1,
+			DesiredNumberScheduled: desired,
+			NumberReady:            ready,
+		},
+	}
+}
+
+func newInjectorPod(ds *appv1.DaemonSet, node string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ds.Namespace,
+			Name:      fmt.Sprintf("%s-%s", ds.Name, node),
+			Labels:    ds.Spec.Selector.MatchLabels,
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: status},
+		}},
+	}
+}
+
+func TestObserveNodes(t *testing.T) {
+	docker := newInjectorDs("injector-docker", 2, 2, 1)
+	containerd := newInjectorDs("injector-containerd", 3, 1, 1)
+	rolling := newInjectorDs("injector-rolling", 2, 2, 2)
+	many := newInjectorDs("injector-many", 12, 0, 1)
+	surplus := newInjectorDs("injector-surplus", 1, 2, 1)
+
+	manyPods := make([]client.Object, 0, 12)
+	for i := 0; i < 12; i++ {
+		manyPods = append(manyPods, newInjectorPod(many, fmt.Sprintf("node-%02d", i), false))
+	}
+
+	cases := []struct {
+		name      string
+		injectors []*appv1.DaemonSet
+		pods      []client.Object
+		desired   int32
+		injected  int32
+		failed    int32
+		status    corev1.ConditionStatus
+		reason    string
+		message   string
+	}{
+		{
+			name:      "all injected",
+			injectors: []*appv1.DaemonSet{docker},
+			pods:      []client.Object{newInjectorPod(docker, "node-1", true), newInjectorPod(docker, "node-2", true)},
+			desired:   2,
+			injected:  2,
+			status:    corev1.ConditionTrue,
+			reason:    reasonAllInjected,
+			message:   "CA cert has been injected into 2 nodes",
+		},
+		{
+			name:      "failing nodes of the injectors",
+			injectors: []*appv1.DaemonSet{docker, containerd},
+			pods: []client.Object{
+				newInjectorPod(docker, "node-1", true),
+				newInjectorPod(docker, "node-2", true),
+				newInjectorPod(containerd, "node-5", false),
+				newInjectorPod(containerd, "node-3", true),
+				newInjectorPod(containerd, "node-4", false),
+				// The pending pod not scheduled yet is not listed.
+				newInjectorPod(containerd, "", false),
+			},
+			desired:  5,
+			injected: 3,
+			failed:   2,
+			status:   corev1.ConditionFalse,
+			reason:   reasonInjectionFailed,
+			message:  "CA cert is not injected into 2 of 5 nodes: node-4, node-5",
+		},
+		{
+			name:      "too many failing nodes",
+			injectors: []*appv1.DaemonSet{many},
+			pods:      manyPods,
+			desired:   12,
+			failed:    12,
+			status:    corev1.ConditionFalse,
+			reason:    reasonInjectionFailed,
+			message: "CA cert is not injected into 12 of 12 nodes: node-00, node-01, node-02, node-03, node-04, " +
+				"node-05, node-06, node-07, node-08, node-09 and 2 more",
+		},
+		{
+			name:      "rolling out",
+			injectors: []*appv1.DaemonSet{docker, rolling},
+			desired:   4,
+			injected:  4,
+			status:    corev1.ConditionUnknown,
+			reason:    reasonRollingOut,
+			message:   "Injectors are rolling out",
+		},
+		{
+			name:      "more ready than desired",
+			injectors: []*appv1.DaemonSet{surplus},
+			desired:   1,
+			injected:  2,
+			status:    corev1.ConditionTrue,
+			reason:    reasonAllInjected,
+			message:   "CA cert has been injected into 2 nodes",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scheme := newScheme(t)
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(c.pods...).Build()
+			p := &provider{Client: cl, scheme: scheme}
+
+			injection := newInjection()
+			if err := p.observeNodes(context.Background(), injection, c.injectors); err != nil {
+				t.Fatalf("observe nodes: %v", err)
+			}
+
+			st := injection.Status
+			if st.DesiredNodes != c.desired || st.InjectedNodes != c.injected || st.FailedNodes != c.failed {
+				t.Fatalf("expected %d/%d/%d desired/injected/failed nodes, got %d/%d/%d",
+					c.desired, c.injected, c.failed, st.DesiredNodes, st.InjectedNodes, st.FailedNodes)
+			}
+
+			cond := st.GetCondition(mytypes.ConditionNodesInjected)
+			if cond == nil {
+				t.Fatalf("expected the %s condition", mytypes.ConditionNodesInjected)
+			}
+
+			if cond.Status != c.status || cond.Reason != c.reason || cond.Message != c.message {
+				t.Fatalf("expected condition %s/%s/%q, got %s/%s/%q", c.status, c.reason, c.message, cond.Status, cond.Reason, cond.Message)
+			}
+		})
+	}
+}
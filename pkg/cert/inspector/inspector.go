@@ -0,0 +1,120 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ReasonExpiringSoon ...
+	ReasonExpiringSoon = "ExpiringSoon"
+	// ReasonExpired ...
+	ReasonExpired = "Expired"
+	// ReasonNotExpiringSoon ...
+	ReasonNotExpiringSoon = "NotExpiringSoon"
+)
+
+// Inspect parses the CA certs in the secrets of the registries.
+// The secrets are keyed by their names.
+func Inspect(registries []v1alpha1.Registry, secrets map[string]*corev1.Secret) ([]v1alpha1.CertificateInfo, error) {
+	var infos []v1alpha1.CertificateInfo
+	for _, r := range registries {
+		secret, ok := secrets[r.CertSecret.Name]
+		if !ok {
+			return nil, errs.Errorf("CA secret %s is not found", r.CertSecret.Name)
+		}
+
+		certs, err := certutil.ParseCertificates(secret.Data[mytypes.CAKeyInSecret])
+		if err != nil {
+			return nil, errs.Wrap(fmt.Sprintf("invalid CA cert in secret %s", secret.Name), err)
+		}
+
+		for _, c := range certs {
+			infos = append(infos, v1alpha1.CertificateInfo{
+				Secret:            secret.Name,
+				Hosts:             r.Hosts,
+				Subject:           c.Subject.String(),
+				Issuer:            c.Issuer.String(),
+				SerialNumber:      c.SerialNumber.Text(16),
+				FingerprintSHA256: certutil.FingerprintSHA256(c),
+				NotBefore:         metav1.NewTime(c.NotBefore),
+				NotAfter:          metav1.NewTime(c.NotAfter),
+			})
+		}
+	}
+
+	return infos, nil
+}
+
+// EarliestExpiry returns the certificate expiring first, nil is returned if there is no certificate.
+func EarliestExpiry(infos []v1alpha1.CertificateInfo) *v1alpha1.CertificateInfo {
+	var earliest *v1alpha1.CertificateInfo
+	for i := range infos {
+		if earliest == nil || infos[i].NotAfter.Before(&earliest.NotAfter) {
+			earliest = &infos[i]
+		}
+	}
+
+	return earliest
+}
+
+// ExpiryCondition checks whether any certificate expires within the window.
+// The duration until the window of the earliest expiring certificate starts is returned as well,
+// then the certificates can be checked again at that time.
+func ExpiryCondition(infos []v1alpha1.CertificateInfo, window time.Duration, now time.Time) (v1alpha1.CertInjectionCondition, time.Duration) {
+	condition := v1alpha1.CertInjectionCondition{
+		Type:   mytypes.ConditionCertExpiringSoon,
+		Status: corev1.ConditionFalse,
+		Reason: ReasonNotExpiringSoon,
+	}
+
+	earliest := EarliestExpiry(infos)
+	if earliest == nil {
+		return condition, 0
+	}
+
+	notAfter := earliest.NotAfter.Time
+	switch {
+	case !now.Before(notAfter):
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = ReasonExpired
+		condition.Message = fmt.Sprintf("CA cert %q in secret %s expired at %s",
+			earliest.Subject, earliest.Secret, notAfter.UTC().Format(time.RFC3339))
+
+		return condition, 0
+	case notAfter.Sub(now) <= window:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = ReasonExpiringSoon
+		condition.Message = fmt.Sprintf("CA cert %q in secret %s expires at %s",
+			earliest.Subject, earliest.Secret, notAfter.UTC().Format(time.RFC3339))
+
+		// Check again when it expires.
+		return condition, notAfter.Sub(now)
+	default:
+		condition.Message = fmt.Sprintf("CA certs expire after %s", notAfter.UTC().Format(time.RFC3339))
+
+		return condition, notAfter.Add(-window).Sub(now)
+	}
+}
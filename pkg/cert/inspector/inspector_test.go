@@ -0,0 +1,169 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/internal/certtest"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSecret(name string, ca []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: name},
+		Data:       map[string][]byte{mytypes.CAKeyInSecret: ca},
+	}
+}
+
+func newRegistry(secret string, hosts ...string) v1alpha1.Registry {
+	return v1alpha1.Registry{Hosts: hosts, CertSecret: corev1.LocalObjectReference{Name: secret}}
+}
+
+func TestInspect(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	root, rootKey := certtest.NewCA(t, "root", now.Add(-time.Hour), nil, nil)
+	intermediate, _ := certtest.NewCA(t, "intermediate", now.Add(-time.Minute), root, rootKey)
+
+	secrets := map[string]*corev1.Secret{
+		"harbor-ca": newSecret("harbor-ca", certtest.Encode(intermediate, root)),
+		"mirror-ca": newSecret("mirror-ca", certtest.Encode(root)),
+		"bad-ca":    newSecret("bad-ca", []byte("not a certificate")),
+	}
+
+	infos, err := Inspect([]v1alpha1.Registry{
+		newRegistry("harbor-ca", "harbor.example.com", "core.example.com"),
+		newRegistry("mirror-ca", "mirror.example.com"),
+	}, secrets)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 certificates, got %d", len(infos))
+	}
+
+	// Each certificate of the bundle is reported with the hosts of the registry.
+	expected := []struct {
+		secret string
+		hosts  string
+		cert   string
+		issuer string
+	}{
+		{secret: "harbor-ca", hosts: "harbor.example.com,core.example.com", cert: "intermediate", issuer: "root"},
+		{secret: "harbor-ca", hosts: "harbor.example.com,core.example.com", cert: "root", issuer: "root"},
+		{secret: "mirror-ca", hosts: "mirror.example.com", cert: "root", issuer: "root"},
+	}
+
+	for i, e := range expected {
+		info := infos[i]
+		if info.Secret != e.secret || strings.Join(info.Hosts, ",") != e.hosts {
+			t.Fatalf("expected certificate %d of secret %s for %s, got %s for %v", i, e.secret, e.hosts, info.Secret, info.Hosts)
+		}
+
+		if info.Subject != "CN="+e.cert || info.Issuer != "CN="+e.issuer {
+			t.Fatalf("expected certificate %d of CN=%s issued by CN=%s, got %s issued by %s", i, e.cert, e.issuer, info.Subject, info.Issuer)
+		}
+	}
+
+	if infos[1].SerialNumber != root.SerialNumber.Text(16) || infos[1].FingerprintSHA256 != certutil.FingerprintSHA256(root) {
+		t.Fatalf("expected serial number %s and fingerprint %s, got %s and %s", root.SerialNumber.Text(16),
+			certutil.FingerprintSHA256(root), infos[1].SerialNumber, infos[1].FingerprintSHA256)
+	}
+
+	if !infos[0].NotBefore.Time.Equal(intermediate.NotBefore) || !infos[0].NotAfter.Time.Equal(intermediate.NotAfter) {
+		t.Fatalf("expected validity %s - %s, got %s - %s", intermediate.NotBefore, intermediate.NotAfter,
+			infos[0].NotBefore, infos[0].NotAfter)
+	}
+
+	for _, r := range []v1alpha1.Registry{newRegistry("missing-ca", "harbor.example.com"), newRegistry("bad-ca", "harbor.example.com")} {
+		if _, err := Inspect([]v1alpha1.Registry{r}, secrets); err == nil {
+			t.Fatalf("expected the error of secret %s", r.CertSecret.Name)
+		}
+	}
+}
+
+func TestExpiryCondition(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	window := 30 * 24 * time.Hour
+
+	newInfo := func(subject string, notAfter time.Time) v1alpha1.CertificateInfo {
+		return v1alpha1.CertificateInfo{Secret: "harbor-ca", Subject: subject, NotAfter: metav1.NewTime(notAfter)}
+	}
+
+	cases := []struct {
+		name    string
+		infos   []v1alpha1.CertificateInfo
+		status  corev1.ConditionStatus
+		reason  string
+		message string
+		requeue time.Duration
+	}{
+		{
+			name:   "no certificates",
+			status: corev1.ConditionFalse,
+			reason: ReasonNotExpiringSoon,
+		},
+		{
+			name:    "not expiring soon",
+			infos:   []v1alpha1.CertificateInfo{newInfo("CN=root", now.Add(window+time.Hour))},
+			status:  corev1.ConditionFalse,
+			reason:  ReasonNotExpiringSoon,
+			message: "CA certs expire after 2022-07-01T01:00:00Z",
+			requeue: time.Hour,
+		},
+		{
+			name: "earliest expiring soon",
+			infos: []v1alpha1.CertificateInfo{
+				newInfo("CN=root", now.Add(2*window)),
+				newInfo("CN=intermediate", now.Add(24*time.Hour)),
+			},
+			status:  corev1.ConditionTrue,
+			reason:  ReasonExpiringSoon,
+			message: `CA cert "CN=intermediate" in secret harbor-ca expires at 2022-06-02T00:00:00Z`,
+			requeue: 24 * time.Hour,
+		},
+		{
+			name: "expired",
+			infos: []v1alpha1.CertificateInfo{
+				newInfo("CN=root", now.Add(24*time.Hour)),
+				newInfo("CN=intermediate", now),
+			},
+			status:  corev1.ConditionTrue,
+			reason:  ReasonExpired,
+			message: `CA cert "CN=intermediate" in secret harbor-ca expired at 2022-06-01T00:00:00Z`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cond, requeue := ExpiryCondition(c.infos, window, now)
+			if cond.Type != mytypes.ConditionCertExpiringSoon || cond.Status != c.status || cond.Reason != c.reason || cond.Message != c.message {
+				t.Fatalf("expected condition %s/%s/%q, got %s/%s/%q", c.status, c.reason, c.message, cond.Status, cond.Reason, cond.Message)
+			}
+
+			if requeue != c.requeue {
+				t.Fatalf("expected the check again after %s, got %s", c.requeue, requeue)
+			}
+		})
+	}
+}
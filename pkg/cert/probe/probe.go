@@ -0,0 +1,100 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+)
+
+const (
+	// defaultPort is the port dialed when the address has no port.
+	defaultPort = "443"
+	// defaultTimeout is the timeout of the TLS handshake if the context has no deadline.
+	defaultTimeout = 10 * time.Second
+)
+
+// Chain dials the registry address in the host[:port] form over TLS and returns the certificate chain presented.
+// The chain is not verified, as the CA trusting it is what to find out.
+func Chain(ctx context.Context, address string) ([]*x509.Certificate, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, defaultPort
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	dialer := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName: host,
+			// The chain is captured without verifying.
+			InsecureSkipVerify: true,
+		},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, errs.Wrap("failed to dial the registry over TLS", err)
+	}
+	defer conn.Close()
+
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, errs.New("no certificate presented by the registry")
+	}
+
+	return chain, nil
+}
+
+// CA dials the registry address over TLS and returns the CA of the chain presented,
+// which is the self-signed root or the topmost issuer of the chain.
+// The topmost certificate is returned if the chain has no CA certificate, e.g. only the leaf is presented.
+func CA(ctx context.Context, address string) (*x509.Certificate, error) {
+	chain, err := Chain(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if ca, err := certutil.CAFromChain(chain); err == nil {
+		return ca, nil
+	}
+
+	return chain[len(chain)-1], nil
+}
+
+// Matches checks whether the certificate presented is one of the trusted certificates or issued by any of them.
+func Matches(presented *x509.Certificate, trusted []*x509.Certificate) bool {
+	for _, t := range trusted {
+		if presented.Equal(t) {
+			return true
+		}
+
+		if presented.CheckSignatureFrom(t) == nil {
+			return true
+		}
+	}
+
+	return false
+}
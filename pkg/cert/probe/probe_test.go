@@ -0,0 +1,108 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/internal/certtest"
+)
+
+func TestCASelfSigned(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	ca, err := CA(context.Background(), strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatalf("probe CA: %v", err)
+	}
+
+	if !ca.Equal(srv.Certificate()) {
+		t.Fatalf("expected the self-signed certificate of the server, got %q", ca.Subject)
+	}
+
+	if !Matches(ca, []*x509.Certificate{srv.Certificate()}) {
+		t.Fatal("expected the CA to match the server certificate")
+	}
+
+	other, _ := certtest.NewCA(t, "other", time.Now().Add(-time.Hour), nil, nil)
+	if Matches(ca, []*x509.Certificate{other}) {
+		t.Fatal("expected the CA not to match another CA")
+	}
+}
+
+func TestCAIssuedChain(t *testing.T) {
+	root, rootKey := certtest.NewCA(t, "root", time.Now().Add(-time.Hour), nil, nil)
+	intermediate, intermediateKey := certtest.NewCA(t, "intermediate", time.Now().Add(-time.Hour), root, rootKey)
+	leaf, leafKey := certtest.NewLeaf(t, intermediate, intermediateKey, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), "127.0.0.1")
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{leaf.Raw, intermediate.Raw},
+			PrivateKey:  leafKey,
+		}},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	ca, err := CA(context.Background(), strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatalf("probe CA: %v", err)
+	}
+
+	// The root is not presented, so the topmost issuer is picked.
+	if !ca.Equal(intermediate) {
+		t.Fatalf("expected the intermediate CA, got %q", ca.Subject)
+	}
+
+	if !Matches(ca, []*x509.Certificate{root}) {
+		t.Fatal("expected the intermediate CA to match the root issuing it")
+	}
+
+	if !Matches(ca, []*x509.Certificate{intermediate}) {
+		t.Fatal("expected the intermediate CA to match itself")
+	}
+
+	stale, _ := certtest.NewCA(t, "root", time.Now().Add(-time.Hour), nil, nil)
+	if Matches(ca, []*x509.Certificate{stale}) {
+		t.Fatal("expected the intermediate CA not to match a stale root")
+	}
+}
+
+func TestCADialError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	address := l.Addr().String()
+	_ = l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := CA(ctx, address); err == nil {
+		t.Fatal("expected an error dialing a closed port")
+	}
+}
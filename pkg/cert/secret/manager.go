@@ -22,6 +22,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/cert/certutil"
 	"github.com/szlabs/harbor-cert-injector/pkg/errs"
 	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
 
@@ -62,6 +63,11 @@ type defaultCreator struct {
 
 // CreateOrUpdate implements Manager.
 func (dc *defaultCreator) CreateOrUpdate(ctx context.Context, owner *v1alpha1.CertInjection, injection *mytypes.Injection) (corev1.LocalObjectReference, error) {
+	// Do not propagate anything which is not a certificate to the nodes.
+	if _, err := certutil.ParseCertificates(injection.CACert); err != nil {
+		return corev1.LocalObjectReference{}, errs.Wrap("invalid CA cert extracted from the source", err)
+	}
+
 	secretObj, err := dc.get(ctx, types.NamespacedName{
 		Namespace: owner.Namespace,
 		Name:      secretName(owner.Name),
@@ -0,0 +1,198 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultExpiryWarningWindow is the default window before the expiry of the CA certs to warn.
+	DefaultExpiryWarningWindow = 30 * 24 * time.Hour
+	// DefaultOptInLabelSelector is the default label selector of the source objects opted in.
+	DefaultOptInLabelSelector = "goharbor.io/cert-injection=enabled"
+	// DefaultOperatorNamespace is the namespace of the operator used when it's not set in the env PodNamespaceEnv.
+	DefaultOperatorNamespace = "harbor-cert-injector-system"
+	// DefaultClusterInjectionMode is the default injection mode of the cluster cert injections.
+	DefaultClusterInjectionMode = "DockerCertsDir"
+	// DefaultInjector is the default strategy of injecting the CA certs.
+	DefaultInjector = "DaemonSet"
+	// DefaultCertManagerNamespace is the default cluster resource namespace of cert-manager.
+	DefaultCertManagerNamespace = "cert-manager"
+	// DefaultInjectorImage is the default image of the injector agent.
+	DefaultInjectorImage = "ghcr.io/szlabs/cert-injector-agent:v0.1.0"
+	// DefaultTLSProbeInterval is the default interval of probing the TLS endpoints of the registries.
+	DefaultTLSProbeInterval = 10 * time.Minute
+	// DefaultCleanupTimeout is the default timeout of removing the injected files from the nodes.
+	DefaultCleanupTimeout = 10 * time.Minute
+	// PodNamespaceEnv is the env of the namespace the operator runs in.
+	PodNamespaceEnv = "POD_NAMESPACE"
+)
+
+// Options of the operator shared by the controllers.
+type Options struct {
+	// ExpiryWarningWindow is the window before the expiry of the CA certs to warn.
+	ExpiryWarningWindow time.Duration
+	// OptInLabelSelector selects the source objects opted in by their labels.
+	OptInLabelSelector string
+	// OptInAnnotation opts the source objects in by an annotation, in the format of `key` or `key=value`.
+	OptInAnnotation string
+	// OptInNamespaceSelector selects the namespaces where all the HarborClusters and PackageInstalls are opted in.
+	OptInNamespaceSelector string
+	// AllHarborClusters opts all the HarborClusters in.
+	AllHarborClusters bool
+	// OperatorNamespace is the namespace where the injectors of the cluster cert injections run.
+	OperatorNamespace string
+	// ClusterInjectionMode is the injection mode of the cluster cert injections.
+	ClusterInjectionMode string
+	// Injector is the default strategy of injecting the CA certs, which can be overridden by the cert injections.
+	Injector string
+	// InjectorScheduling is the default scheduling of the injectors, which can be overridden by the cert injections.
+	InjectorScheduling *v1alpha1.Scheduling
+	// InjectorImage is the image of the injector agent.
+	InjectorImage string
+	// InjectorImagePullSecrets are the names of the secrets to pull the injector image,
+	// which should exist in the namespaces of the injectors.
+	InjectorImagePullSecrets []string
+	// InjectorRunAsUser is the UID the injector runs as, which should be able to write the certs directories.
+	InjectorRunAsUser int64
+	// InjectorReadOnlyRootFilesystem mounts the root filesystem of the injector as read-only.
+	InjectorReadOnlyRootFilesystem bool
+	// InjectorCapabilities are the capabilities added to the injector, all the others are dropped.
+	InjectorCapabilities []string
+	// CertManagerNamespace is the cluster resource namespace of cert-manager where the secrets of
+	// the ClusterIssuers are.
+	CertManagerNamespace string
+	// ProbeRegistryTLS probes the TLS endpoints of the registries and checks the CA they present
+	// against the CA injected.
+	ProbeRegistryTLS bool
+	// TLSProbeInterval is the interval of probing the TLS endpoints of the registries.
+	TLSProbeInterval time.Duration
+	// CleanupTimeout is the timeout of removing the injected files from the nodes when the cert injections are
+	// deleted, after which the injections are released with the files left.
+	CleanupTimeout time.Duration
+}
+
+var options = &Options{
+	ExpiryWarningWindow:            DefaultExpiryWarningWindow,
+	OptInLabelSelector:             DefaultOptInLabelSelector,
+	OperatorNamespace:              operatorNamespace(),
+	ClusterInjectionMode:           DefaultClusterInjectionMode,
+	Injector:                       DefaultInjector,
+	InjectorImage:                  DefaultInjectorImage,
+	InjectorReadOnlyRootFilesystem: true,
+	TLSProbeInterval:               DefaultTLSProbeInterval,
+	CleanupTimeout:                 DefaultCleanupTimeout,
+	CertManagerNamespace:           DefaultCertManagerNamespace,
+}
+
+// BindFlags binds the options to the flag set.
+func BindFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&options.ExpiryWarningWindow, "expiry-warning-window", DefaultExpiryWarningWindow,
+		"The window before the expiry of the injected CA certs to set the CertExpiringSoon condition and emit a warning event.")
+	fs.StringVar(&options.OptInLabelSelector, "opt-in-label-selector", DefaultOptInLabelSelector,
+		"The label selector of the source objects to inject the CA of. Set to empty to disable the label based opt-in.")
+	fs.StringVar(&options.OptInAnnotation, "opt-in-annotation", "",
+		"The annotation opting the source objects in, in the format of 'key' or 'key=value'.")
+	fs.StringVar(&options.OptInNamespaceSelector, "opt-in-namespace-selector", "",
+		"The label selector of the namespaces where all the HarborClusters and PackageInstalls are opted in.")
+	fs.BoolVar(&options.AllHarborClusters, "all-harborclusters", false,
+		"Inject the CA of all the HarborClusters regardless of the opt-in selectors.")
+	fs.StringVar(&options.OperatorNamespace, "operator-namespace", operatorNamespace(),
+		"The namespace where the injectors of the ClusterCertInjections run. Defaults to the namespace of the operator.")
+	fs.StringVar(&options.ClusterInjectionMode, "cluster-injection-mode", DefaultClusterInjectionMode,
+		"The injection mode of the ClusterCertInjections, DockerCertsDir or ContainerdHosts.")
+	fs.StringVar(&options.Injector, "injector", DefaultInjector,
+		"The default strategy of injecting the CA certs, DaemonSet, Shared or Job. It can be overridden by the CertInjections.")
+	fs.Func("injector-scheduling", "The YAML or JSON file of the default scheduling of the injectors, "+
+		"e.g. the tolerations and the priority class. It can be overridden by the CertInjections.", loadInjectorScheduling)
+	fs.StringVar(&options.InjectorImage, "injector-image", DefaultInjectorImage,
+		"The image of the injector agent, e.g. the one mirrored into the private registry of an air-gapped cluster.")
+	fs.Func("injector-image-pull-secrets", "The comma separated names of the secrets to pull the injector image. "+
+		"The secrets should exist in the namespaces of the injectors.", func(v string) error {
+		options.InjectorImagePullSecrets = splitList(v)
+		return nil
+	})
+	// The certs directories on the nodes are owned by root.
+	fs.Int64Var(&options.InjectorRunAsUser, "injector-run-as-user", 0,
+		"The UID the injector runs as, which should be able to write the certs directories on the nodes.")
+	fs.BoolVar(&options.InjectorReadOnlyRootFilesystem, "injector-read-only-root-filesystem", true,
+		"Mount the root filesystem of the injector as read-only.")
+	fs.Func("injector-capabilities", "The comma separated capabilities added to the injector, "+
+		"e.g. DAC_OVERRIDE to write the certs directories not owned by the user. All the others are dropped.",
+		func(v string) error {
+			options.InjectorCapabilities = splitList(v)
+			return nil
+		})
+	fs.StringVar(&options.CertManagerNamespace, "cert-manager-namespace", DefaultCertManagerNamespace,
+		"The cluster resource namespace of cert-manager, where the CA secrets of the ClusterIssuers are read from.")
+	fs.BoolVar(&options.ProbeRegistryTLS, "probe-registry-tls", false,
+		"Probe the TLS endpoint of the registries and set the CAMismatch condition when the CA presented differs from the CA injected.")
+	fs.DurationVar(&options.TLSProbeInterval, "tls-probe-interval", DefaultTLSProbeInterval,
+		"The interval of probing the TLS endpoint of the registries.")
+	fs.DurationVar(&options.CleanupTimeout, "cleanup-timeout", DefaultCleanupTimeout,
+		"The timeout of removing the injected files from the nodes when the CertInjections are deleted, "+
+			"after which the CertInjections are released with the files left. Set to 0 to wait forever.")
+}
+
+// Get the options.
+func Get() *Options {
+	return options
+}
+
+func operatorNamespace() string {
+	if ns := os.Getenv(PodNamespaceEnv); ns != "" {
+		return ns
+	}
+
+	return DefaultOperatorNamespace
+}
+
+// loadInjectorScheduling loads the default scheduling of the injectors from the file.
+func loadInjectorScheduling(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errs.Wrap("failed to read injector scheduling file", err)
+	}
+
+	scheduling := &v1alpha1.Scheduling{}
+	if err := yaml.UnmarshalStrict(data, scheduling); err != nil {
+		return errs.Wrap("failed to parse injector scheduling file", err)
+	}
+
+	options.InjectorScheduling = scheduling
+
+	return nil
+}
+
+// splitList splits the comma separated values, the empty values are skipped.
+func splitList(v string) []string {
+	var values []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,134 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SourceSecretsIndexKey is the field index of CertInjection by the secrets read from its source.
+const SourceSecretsIndexKey = "metadata.annotations.sourceSecrets"
+
+var (
+	indexOnce sync.Once
+	indexErr  error
+)
+
+// IndexSourceSecrets indexes the cert injections by the secrets read from their sources.
+// It's shared by the controllers and only registered once.
+func IndexSourceSecrets(ctx context.Context, mgr ctrl.Manager) error {
+	indexOnce.Do(func() {
+		indexErr = mgr.GetFieldIndexer().IndexField(ctx, &v1alpha1.CertInjection{}, SourceSecretsIndexKey, func(obj client.Object) []string {
+			return ParseSourceSecrets(obj.GetAnnotations()[mytypes.SourceSecretsAnnotationKey])
+		})
+	})
+
+	return indexErr
+}
+
+// FormatSourceSecrets formats the secrets into the value of the annotation mytypes.SourceSecretsAnnotationKey.
+func FormatSourceSecrets(secrets []types.NamespacedName) string {
+	items := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		if item := s.String(); !contains(items, item) {
+			items = append(items, item)
+		}
+	}
+
+	sort.Strings(items)
+
+	return strings.Join(items, ",")
+}
+
+// ParseSourceSecrets parses the value of the annotation mytypes.SourceSecretsAnnotationKey
+// into the namespace/name of the secrets.
+func ParseSourceSecrets(value string) []string {
+	var secrets []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+
+	return secrets
+}
+
+// SourcesOfSecret maps the secret changes to the sources of the GVK which read the secret.
+// Only the sources opted in by the selector are enqueued, newObject creates the object of the source kind.
+func SourcesOfSecret(reader client.Reader, gvk schema.GroupVersionKind, selector *OptInSelector, newObject func() client.Object) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		ctx := context.Background()
+
+		ciList := &v1alpha1.CertInjectionList{}
+		if err := reader.List(ctx, ciList, client.MatchingFields{
+			SourceSecretsIndexKey: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}.String(),
+		}, client.MatchingLabels{
+			mytypes.OwnerGVKLabel: FormatGVKToLabelValue(gvk),
+		}); err != nil {
+			log.Log.Error(err, "unable to list cert injections for secret changes", "secret", client.ObjectKeyFromObject(obj))
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(ciList.Items))
+		for _, ci := range ciList.Items {
+			key := types.NamespacedName{
+				Namespace: ci.Namespace,
+				Name:      ci.Labels[mytypes.OwnerNameLabel],
+			}
+
+			src := newObject()
+			if err := reader.Get(ctx, key, src); err != nil {
+				if !apierrors.IsNotFound(err) {
+					log.Log.Error(err, "unable to get the source of the cert injection", "source", key)
+				}
+
+				continue
+			}
+
+			if !selector.Selects(ctx, src) {
+				continue
+			}
+
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+
+		return requests
+	}
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSourcesOfSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client-go scheme: %v", err)
+	}
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add v1alpha1 scheme: %v", err)
+	}
+
+	gvk := networkingv1.SchemeGroupVersion.WithKind(mytypes.Ingress)
+	secret := types.NamespacedName{Namespace: "harbor", Name: "harbor-tls"}
+
+	ingress := func(name string, labels map[string]string) client.Object {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: name, Labels: labels}}
+	}
+
+	injection := func(owner string) client.Object {
+		return &v1alpha1.CertInjection{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "harbor",
+			Name:      "ca-injection-" + owner,
+			Labels: map[string]string{
+				mytypes.OwnerGVKLabel:  FormatGVKToLabelValue(gvk),
+				mytypes.OwnerNameLabel: owner,
+			},
+			Annotations: map[string]string{
+				mytypes.SourceSecretsAnnotationKey: FormatSourceSecrets([]types.NamespacedName{secret}),
+			},
+		}}
+	}
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		ingress("opted", map[string]string{"goharbor.io/cert-injection": "enabled"}),
+		ingress("opted-out", map[string]string{"goharbor.io/cert-injection": "disabled"}),
+		injection("opted"),
+		injection("opted-out"),
+		injection("deleted"),
+	).Build()
+
+	selector, err := NewOptInSelector(&config.Options{OptInLabelSelector: config.DefaultOptInLabelSelector}, reader, mytypes.Ingress)
+	if err != nil {
+		t.Fatalf("new selector: %v", err)
+	}
+
+	mapFunc := SourcesOfSecret(reader, gvk, selector, func() client.Object {
+		return &networkingv1.Ingress{}
+	})
+
+	requests := mapFunc(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: secret.Namespace, Name: secret.Name}})
+	expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "harbor", Name: "opted"}}}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("expected requests %v, got %v", expected, requests)
+	}
+}
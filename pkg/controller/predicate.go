@@ -15,25 +15,89 @@
 package controller
 
 import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
-// WithExpectedLabelPredicates creates predicates requiring expected label existing.
-func WithExpectedLabelPredicates() builder.Predicates {
-	return builder.WithPredicates(predicate.Funcs{
+// WithOptInPredicates creates predicates requiring the object opted in by the selector.
+func WithOptInPredicates(selector *OptInSelector) builder.Predicates {
+	return builder.WithPredicates(OptInPredicate(selector))
+}
+
+// OptInPredicate creates the predicate requiring the object opted in by the selector,
+// which is used by the controllers watching without the builder.
+func OptInPredicate(selector *OptInSelector) predicate.Predicate {
+	return predicate.Funcs{
 		UpdateFunc: func(event event.UpdateEvent) bool {
 			// Ignore status change
-			return event.ObjectOld.GetGeneration() != event.ObjectNew.GetGeneration() &&
-				WithExpectedLabel(event.ObjectNew)
+			return sourceChanged(event.ObjectOld, event.ObjectNew) &&
+				selector.Selects(context.Background(), event.ObjectNew)
 		},
 		CreateFunc: func(createEvent event.CreateEvent) bool {
-			return WithExpectedLabel(createEvent.Object)
+			return selector.Selects(context.Background(), createEvent.Object)
 		},
 		DeleteFunc: func(deleteEvent event.DeleteEvent) bool {
 			return !deleteEvent.DeleteStateUnknown &&
-				WithExpectedLabel(deleteEvent.Object)
+				selector.Selects(context.Background(), deleteEvent.Object)
+		},
+	}
+}
+
+// WithLabelsPredicates creates predicates requiring the object having all the labels.
+func WithLabelsPredicates(labels map[string]string) builder.Predicates {
+	return builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		for k, v := range labels {
+			if obj.GetLabels()[k] != v {
+				return false
+			}
+		}
+
+		return true
+	}))
+}
+
+// WithRuntimeChangedPredicates creates predicates requiring the nodes joining, leaving or changing container runtime.
+func WithRuntimeChangedPredicates() builder.Predicates {
+	return builder.WithPredicates(predicate.Funcs{
+		UpdateFunc: func(event event.UpdateEvent) bool {
+			oldNode, ok := event.ObjectOld.(*corev1.Node)
+			if !ok {
+				return false
+			}
+
+			newNode, ok := event.ObjectNew.(*corev1.Node)
+			if !ok {
+				return false
+			}
+
+			return oldNode.Status.NodeInfo.ContainerRuntimeVersion != newNode.Status.NodeInfo.ContainerRuntimeVersion
+		},
+		GenericFunc: func(genericEvent event.GenericEvent) bool {
+			return false
 		},
 	})
 }
+
+// sourceChanged checks whether the certificate source is changed.
+// The generation of secrets is not increased when the data changes, so the data and annotations are compared.
+func sourceChanged(oldObj client.Object, newObj client.Object) bool {
+	oldSecret, ok := oldObj.(*corev1.Secret)
+	if !ok {
+		return oldObj.GetGeneration() != newObj.GetGeneration()
+	}
+
+	newSecret, ok := newObj.(*corev1.Secret)
+	if !ok {
+		return true
+	}
+
+	return !reflect.DeepEqual(oldSecret.Data, newSecret.Data) ||
+		!reflect.DeepEqual(oldSecret.Annotations, newSecret.Annotations) ||
+		!reflect.DeepEqual(oldSecret.Labels, newSecret.Labels)
+}
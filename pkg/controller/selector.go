@@ -0,0 +1,159 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// OptInSelector decides whether the CA of a source object should be injected.
+// A source object is opted in when any of the configured selectors matches it.
+type OptInSelector struct {
+	reader client.Reader
+
+	labels          labels.Selector
+	annotationKey   string
+	annotationValue *string
+	namespaces      labels.Selector
+	all             bool
+}
+
+// NewOptInSelector creates the opt-in selector of the source kind with the options.
+// The namespace selector only applies to HarborCluster and PackageInstall, and the all mode only to HarborCluster,
+// as opting all the other sources of a namespace in, e.g. secrets or ingresses, is never expected.
+func NewOptInSelector(opts *config.Options, reader client.Reader, kind string) (*OptInSelector, error) {
+	s := &OptInSelector{
+		reader: reader,
+		all:    kind == mytypes.HarborCluster && opts.AllHarborClusters,
+	}
+
+	if opts.OptInLabelSelector != "" {
+		sel, err := labels.Parse(opts.OptInLabelSelector)
+		if err != nil {
+			return nil, errs.Wrap("invalid opt-in label selector", err)
+		}
+
+		s.labels = sel
+	}
+
+	if opts.OptInAnnotation != "" {
+		kv := strings.SplitN(opts.OptInAnnotation, "=", 2)
+		s.annotationKey = strings.TrimSpace(kv[0])
+		if s.annotationKey == "" {
+			return nil, errs.Errorf("invalid opt-in annotation %q", opts.OptInAnnotation)
+		}
+
+		if len(kv) == 2 {
+			v := strings.TrimSpace(kv[1])
+			s.annotationValue = &v
+		}
+	}
+
+	if opts.OptInNamespaceSelector != "" && (kind == mytypes.HarborCluster || kind == mytypes.PackageInstall) {
+		sel, err := labels.Parse(opts.OptInNamespaceSelector)
+		if err != nil {
+			return nil, errs.Wrap("invalid opt-in namespace selector", err)
+		}
+
+		s.namespaces = sel
+	}
+
+	return s, nil
+}
+
+// Selects checks whether the object is opted in.
+func (s *OptInSelector) Selects(ctx context.Context, obj client.Object) bool {
+	if obj == nil {
+		return false
+	}
+
+	if s.all {
+		return true
+	}
+
+	if s.labels != nil && s.labels.Matches(labels.Set(obj.GetLabels())) {
+		return true
+	}
+
+	if s.annotationKey != "" {
+		if v, ok := obj.GetAnnotations()[s.annotationKey]; ok && (s.annotationValue == nil || v == *s.annotationValue) {
+			return true
+		}
+	}
+
+	if s.namespaces != nil {
+		ns := &corev1.Namespace{}
+		if err := s.reader.Get(ctx, client.ObjectKey{Name: obj.GetNamespace()}, ns); err != nil {
+			log.FromContext(ctx).Error(err, "failed to get namespace of the source", "namespace", obj.GetNamespace())
+			return false
+		}
+
+		return s.namespaces.Matches(labels.Set(ns.GetLabels()))
+	}
+
+	return false
+}
+
+// WatchesNamespaces checks whether the namespaces should be watched to pick up the namespaces opted in.
+func (s *OptInSelector) WatchesNamespaces() bool {
+	return s.namespaces != nil && !s.all
+}
+
+// SourcesInNamespace maps the namespace to the source objects opted in under it.
+// newList creates the list of the source kind.
+func SourcesInNamespace(reader client.Reader, selector *OptInSelector, newList func() client.ObjectList) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		ctx := context.Background()
+
+		list := newList()
+		if err := reader.List(ctx, list, client.InNamespace(obj.GetName())); err != nil {
+			log.Log.Error(err, "failed to list sources in namespace", "namespace", obj.GetName())
+			return nil
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			log.Log.Error(err, "failed to extract sources", "namespace", obj.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, item := range items {
+			o, ok := item.(client.Object)
+			if !ok || !selector.Selects(ctx, o) {
+				continue
+			}
+
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(o),
+			})
+		}
+
+		return requests
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/config"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOptInSelectorSelects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add client-go scheme: %v", err)
+	}
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "opted", Labels: map[string]string{"cert-injection": "enabled"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+	).Build()
+
+	source := func(namespace string, labels map[string]string, annotations map[string]string) client.Object {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        "source",
+			Labels:      labels,
+			Annotations: annotations,
+		}}
+	}
+
+	cases := []struct {
+		name     string
+		opts     config.Options
+		kind     string
+		obj      client.Object
+		selected bool
+	}{
+		{
+			name:     "label matched",
+			opts:     config.Options{OptInLabelSelector: config.DefaultOptInLabelSelector},
+			kind:     mytypes.Secret,
+			obj:      source("plain", map[string]string{"goharbor.io/cert-injection": "enabled"}, nil),
+			selected: true,
+		},
+		{
+			name: "label not matched",
+			opts: config.Options{OptInLabelSelector: config.DefaultOptInLabelSelector},
+			kind: mytypes.Secret,
+			obj:  source("plain", map[string]string{"goharbor.io/cert-injection": "disabled"}, nil),
+		},
+		{
+			name: "no label selector",
+			kind: mytypes.Secret,
+			obj:  source("plain", map[string]string{"goharbor.io/cert-injection": "enabled"}, nil),
+		},
+		{
+			name:     "annotation without value matched by any value",
+			opts:     config.Options{OptInAnnotation: "goharbor.io/inject-ca"},
+			kind:     mytypes.Ingress,
+			obj:      source("plain", nil, map[string]string{"goharbor.io/inject-ca": ""}),
+			selected: true,
+		},
+		{
+			name: "annotation without value missing",
+			opts: config.Options{OptInAnnotation: "goharbor.io/inject-ca"},
+			kind: mytypes.Ingress,
+			obj:  source("plain", nil, map[string]string{"goharbor.io/other": "true"}),
+		},
+		{
+			name:     "annotation with value matched",
+			opts:     config.Options{OptInAnnotation: "goharbor.io/inject-ca = true"},
+			kind:     mytypes.Ingress,
+			obj:      source("plain", nil, map[string]string{"goharbor.io/inject-ca": "true"}),
+			selected: true,
+		},
+		{
+			name: "annotation with another value",
+			opts: config.Options{OptInAnnotation: "goharbor.io/inject-ca=true"},
+			kind: mytypes.Ingress,
+			obj:  source("plain", nil, map[string]string{"goharbor.io/inject-ca": "false"}),
+		},
+		{
+			name:     "label or annotation",
+			opts:     config.Options{OptInLabelSelector: config.DefaultOptInLabelSelector, OptInAnnotation: "goharbor.io/inject-ca"},
+			kind:     mytypes.Secret,
+			obj:      source("plain", nil, map[string]string{"goharbor.io/inject-ca": "true"}),
+			selected: true,
+		},
+		{
+			name:     "namespace matched",
+			opts:     config.Options{OptInNamespaceSelector: "cert-injection=enabled"},
+			kind:     mytypes.HarborCluster,
+			obj:      source("opted", nil, nil),
+			selected: true,
+		},
+		{
+			name: "namespace not matched",
+			opts: config.Options{OptInNamespaceSelector: "cert-injection=enabled"},
+			kind: mytypes.PackageInstall,
+			obj:  source("plain", nil, nil),
+		},
+		{
+			name: "namespace not found",
+			opts: config.Options{OptInNamespaceSelector: "cert-injection=enabled"},
+			kind: mytypes.HarborCluster,
+			obj:  source("missing", nil, nil),
+		},
+		{
+			name: "namespace selector ignored by the other kinds",
+			opts: config.Options{OptInNamespaceSelector: "cert-injection=enabled"},
+			kind: mytypes.Secret,
+			obj:  source("opted", nil, nil),
+		},
+		{
+			name:     "all the HarborClusters",
+			opts:     config.Options{AllHarborClusters: true},
+			kind:     mytypes.HarborCluster,
+			obj:      source("plain", nil, nil),
+			selected: true,
+		},
+		{
+			name: "all mode ignored by the other kinds",
+			opts: config.Options{AllHarborClusters: true},
+			kind: mytypes.PackageInstall,
+			obj:  source("plain", nil, nil),
+		},
+		{
+			name: "nil object",
+			opts: config.Options{AllHarborClusters: true},
+			kind: mytypes.HarborCluster,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := NewOptInSelector(&c.opts, reader, c.kind)
+			if err != nil {
+				t.Fatalf("new selector: %v", err)
+			}
+
+			if got := s.Selects(context.Background(), c.obj); got != c.selected {
+				t.Fatalf("expected selected %v, got %v", c.selected, got)
+			}
+		})
+	}
+}
+
+func TestNewOptInSelectorInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		opts config.Options
+		kind string
+	}{
+		{name: "label selector", opts: config.Options{OptInLabelSelector: "a in (b"}, kind: mytypes.Secret},
+		{name: "annotation", opts: config.Options{OptInAnnotation: "=true"}, kind: mytypes.Secret},
+		{name: "namespace selector", opts: config.Options{OptInNamespaceSelector: "a in (b"}, kind: mytypes.HarborCluster},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := NewOptInSelector(&c.opts, nil, c.kind); err == nil {
+				t.Fatal("expected an error of the invalid options")
+			}
+		})
+	}
+}
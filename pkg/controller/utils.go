@@ -18,24 +18,8 @@ import (
 	"fmt"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const (
-	onlyWatchResWithLabel = "goharbor.io/cert-injection"
-	labelValue            = "enabled"
-)
-
-// WithExpectedLabel assure the expected label (with value) is existing.
-func WithExpectedLabel(obj client.Object) bool {
-	if obj == nil {
-		return false
-	}
-
-	v, ok := obj.GetLabels()[onlyWatchResWithLabel]
-	return ok && v == labelValue
-}
-
 // FormatGVKToLabelValue format the GVK as a valid label value.
 func FormatGVKToLabelValue(GVK schema.GroupVersionKind) string {
 	return fmt.Sprintf("%s_%s_%s", GVK.Group, GVK.Version, GVK.Kind)
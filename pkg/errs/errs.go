@@ -22,6 +22,12 @@ import (
 // TLSNotEnabledError ...
 var TLSNotEnabledError = New("No need to inject CA as TLS is not enabled")
 
+// MissingDataError ...
+var MissingDataError = New("Required data is missing in the certificate source")
+
+// InvalidDataError ...
+var InvalidDataError = New("Data in the certificate source is invalid")
+
 // New error
 func New(message string) error {
 	return fmt.Errorf("error: %s", message)
@@ -41,3 +47,13 @@ func Wrap(message string, err error) error {
 func IsTLSNotEnabledError(err error) bool {
 	return errors.Is(err, TLSNotEnabledError)
 }
+
+// IsMissingDataError checks if the error is MissingDataError.
+func IsMissingDataError(err error) bool {
+	return errors.Is(err, MissingDataError)
+}
+
+// IsInvalidDataError checks if the error is InvalidDataError.
+func IsInvalidDataError(err error) bool {
+	return errors.Is(err, InvalidDataError)
+}
@@ -0,0 +1,157 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// StateReady ...
+	StateReady = "ready"
+	// StateNotReady ...
+	StateNotReady = "not_ready"
+	// StateUnknown ...
+	StateUnknown = "unknown"
+
+	collectTimeout = 10 * time.Second
+)
+
+var (
+	injectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "injections"),
+		"Number of cert injections by state.",
+		[]string{"state"}, nil,
+	)
+	caExpiryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "ca_expiry_timestamp_seconds"),
+		"Expiry time of the earliest expiring CA cert of the registry in unix seconds.",
+		[]string{"namespace", "injection", "registry"}, nil,
+	)
+	nodesDesiredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "nodes_desired"),
+		"Number of nodes where the CA cert should be injected.",
+		[]string{"namespace", "injection"}, nil,
+	)
+	nodesInjectedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "nodes_injected"),
+		"Number of nodes where the CA cert has been injected and verified.",
+		[]string{"namespace", "injection"}, nil,
+	)
+	nodesFailedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "nodes_failed"),
+		"Number of nodes where the CA cert has not been injected or verified.",
+		[]string{"namespace", "injection"}, nil,
+	)
+
+	registerOnce sync.Once
+)
+
+// injectionCollector computes the metrics from the cert injections in the cache at scrape time,
+// then the metrics never drift from the objects.
+type injectionCollector struct {
+	reader client.Reader
+}
+
+// RegisterInjectionCollector registers the collector of the cert injections read from the reader.
+// It's only registered once.
+func RegisterInjectionCollector(reader client.Reader) (err error) {
+	registerOnce.Do(func() {
+		err = ctrlmetrics.Registry.Register(&injectionCollector{reader: reader})
+	})
+
+	return err
+}
+
+// Describe implements prometheus.Collector.
+func (c *injectionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- injectionsDesc
+	ch <- caExpiryDesc
+	ch <- nodesDesiredDesc
+	ch <- nodesInjectedDesc
+	ch <- nodesFailedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *injectionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	ciList := &v1alpha1.CertInjectionList{}
+	if err := c.reader.List(ctx, ciList); err != nil {
+		log.Log.Error(err, "unable to list cert injections for metrics")
+		return
+	}
+
+	states := map[string]int{
+		StateReady:    0,
+		StateNotReady: 0,
+		StateUnknown:  0,
+	}
+
+	for i := range ciList.Items {
+		ci := &ciList.Items[i]
+		states[state(ci)]++
+
+		ch <- prometheus.MustNewConstMetric(nodesDesiredDesc, prometheus.GaugeValue, float64(ci.Status.DesiredNodes), ci.Namespace, ci.Name)
+		ch <- prometheus.MustNewConstMetric(nodesInjectedDesc, prometheus.GaugeValue, float64(ci.Status.InjectedNodes), ci.Namespace, ci.Name)
+		ch <- prometheus.MustNewConstMetric(nodesFailedDesc, prometheus.GaugeValue, float64(ci.Status.FailedNodes), ci.Namespace, ci.Name)
+
+		for registry, expiry := range registryExpiries(ci) {
+			ch <- prometheus.MustNewConstMetric(caExpiryDesc, prometheus.GaugeValue, float64(expiry.Unix()), ci.Namespace, ci.Name, registry)
+		}
+	}
+
+	for s, n := range states {
+		ch <- prometheus.MustNewConstMetric(injectionsDesc, prometheus.GaugeValue, float64(n), s)
+	}
+}
+
+func state(ci *v1alpha1.CertInjection) string {
+	ready := ci.Status.GetCondition(mytypes.ConditionReady)
+	switch {
+	case ready == nil:
+		return StateUnknown
+	case ready.Status == corev1.ConditionTrue:
+		return StateReady
+	default:
+		return StateNotReady
+	}
+}
+
+// registryExpiries returns the earliest expiry of the CA certs of each registry host.
+func registryExpiries(ci *v1alpha1.CertInjection) map[string]time.Time {
+	expiries := make(map[string]time.Time)
+	for _, cert := range ci.Status.Certificates {
+		for _, host := range cert.Hosts {
+			if t, ok := expiries[host]; !ok || cert.NotAfter.Time.Before(t) {
+				expiries[host] = cert.NotAfter.Time
+			}
+		}
+	}
+
+	return expiries
+}
@@ -0,0 +1,128 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szlabs/harbor-cert-injector/api/v1alpha1"
+	mytypes "github.com/szlabs/harbor-cert-injector/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// failingReader fails to list the cert injections.
+type failingReader struct {
+	client.Reader
+}
+
+func (r *failingReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("cache is not synced")
+}
+
+func newCertInjection(name string, ready *corev1.ConditionStatus, desired, injected, failed int32,
+	certs ...v1alpha1.CertificateInfo) *v1alpha1.CertInjection {
+	ci := &v1alpha1.CertInjection{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "harbor", Name: name},
+		Status: v1alpha1.CertInjectionStatus{
+			DesiredNodes:  desired,
+			InjectedNodes: injected,
+			FailedNodes:   failed,
+			Certificates:  certs,
+		},
+	}
+
+	if ready != nil {
+		ci.Status.Conditions = []v1alpha1.CertInjectionCondition{{Type: mytypes.ConditionReady, Status: *ready}}
+	}
+
+	return ci
+}
+
+func newCertificateInfo(notAfter time.Time, hosts ...string) v1alpha1.CertificateInfo {
+	return v1alpha1.CertificateInfo{Hosts: hosts, NotAfter: metav1.NewTime(notAfter)}
+}
+
+func TestCollect(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ready, notReady := corev1.ConditionTrue, corev1.ConditionFalse
+	early := time.Unix(1700000000, 0)
+	late := time.Unix(1800000000, 0)
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newCertInjection("harbor", &ready, 3, 3, 0,
+			// The earliest expiry of the CA certs trusted for the host is taken.
+			newCertificateInfo(late, "harbor.example.com", "core.example.com"),
+			newCertificateInfo(early, "harbor.example.com"),
+		),
+		newCertInjection("mirror", &notReady, 3, 1, 2),
+		newCertInjection("pending", nil, 0, 0, 0),
+	).Build()
+
+	expected := `
+# HELP cert_injector_injections Number of cert injections by state.
+# TYPE cert_injector_injections gauge
+cert_injector_injections{state="not_ready"} 1
+cert_injector_injections{state="ready"} 1
+cert_injector_injections{state="unknown"} 1
+# HELP cert_injector_ca_expiry_timestamp_seconds Expiry time of the earliest expiring CA cert of the registry in unix seconds.
+# TYPE cert_injector_ca_expiry_timestamp_seconds gauge
+cert_injector_ca_expiry_timestamp_seconds{injection="harbor",namespace="harbor",registry="core.example.com"} 1.8e+09
+cert_injector_ca_expiry_timestamp_seconds{injection="harbor",namespace="harbor",registry="harbor.example.com"} 1.7e+09
+# HELP cert_injector_nodes_desired Number of nodes where the CA cert should be injected.
+# TYPE cert_injector_nodes_desired gauge
+cert_injector_nodes_desired{injection="harbor",namespace="harbor"} 3
+cert_injector_nodes_desired{injection="mirror",namespace="harbor"} 3
+cert_injector_nodes_desired{injection="pending",namespace="harbor"} 0
+# HELP cert_injector_nodes_injected Number of nodes where the CA cert has been injected and verified.
+# TYPE cert_injector_nodes_injected gauge
+cert_injector_nodes_injected{injection="harbor",namespace="harbor"} 3
+cert_injector_nodes_injected{injection="mirror",namespace="harbor"} 1
+cert_injector_nodes_injected{injection="pending",namespace="harbor"} 0
+# HELP cert_injector_nodes_failed Number of nodes where the CA cert has not been injected or verified.
+# TYPE cert_injector_nodes_failed gauge
+cert_injector_nodes_failed{injection="harbor",namespace="harbor"} 0
+cert_injector_nodes_failed{injection="mirror",namespace="harbor"} 2
+cert_injector_nodes_failed{injection="pending",namespace="harbor"} 0
+`
+
+	if err := testutil.CollectAndCompare(&injectionCollector{reader: reader}, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectListError(t *testing.T) {
+	if n := testutil.CollectAndCount(&injectionCollector{reader: &failingReader{}}); n != 0 {
+		t.Fatalf("expected no metrics collected, got %d", n)
+	}
+}
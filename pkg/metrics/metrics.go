@@ -0,0 +1,59 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "cert_injector"
+
+var (
+	// ExtractErrors counts the errors of extracting the CA cert from the sources.
+	ExtractErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "extract_errors_total",
+		Help:      "Total number of errors extracting the CA cert from the certificate sources.",
+	}, []string{"source_kind"})
+
+	// ReconcileDuration observes the latency of reconciling the sources.
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Latency of reconciling the certificate sources into cert injections.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source_kind", "result"})
+)
+
+const (
+	// ResultSuccess ...
+	ResultSuccess = "success"
+	// ResultError ...
+	ResultError = "error"
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(ExtractErrors, ReconcileDuration)
+}
+
+// Result returns the result label value of the error.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+
+	return ResultSuccess
+}
@@ -0,0 +1,74 @@
+// Copyright Project Harbor Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/szlabs/harbor-cert-injector/pkg/errs"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NormalizeHost normalizes the registry address into the host[:port] form,
+// which is used as the directory name under the certs.d of the container runtimes.
+// The scheme and the trailing slash are stripped, other parts like path, user info,
+// query or whitespace are rejected.
+func NormalizeHost(address string) (string, error) {
+	host := strings.TrimSpace(address)
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimSuffix(host, "/")
+	host = strings.ToLower(host)
+
+	if err := ValidateHost(host); err != nil {
+		return "", errs.Wrap(fmt.Sprintf("invalid registry address %q", address), err)
+	}
+
+	return host, nil
+}
+
+// ValidateHost checks whether the host is in the host[:port] form.
+func ValidateHost(host string) error {
+	if host == "" {
+		return errs.New("empty host")
+	}
+
+	if strings.ContainsAny(host, "/?#@ \t\r\n") {
+		return errs.Errorf("host %q should only contain the host name and port", host)
+	}
+
+	name := host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return errs.Errorf("invalid port %q", port)
+		}
+
+		name = h
+	}
+
+	if ip := net.ParseIP(strings.Trim(name, "[]")); ip != nil {
+		return nil
+	}
+
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		return errs.Errorf("invalid host name %q: %s", name, strings.Join(msgs, ", "))
+	}
+
+	return nil
+}
@@ -14,14 +14,40 @@
 
 package types
 
+import (
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
 const (
 	// CAKeyInSecret ...
 	CAKeyInSecret = "ca.crt"
+	// TLSCertKeyInSecret ...
+	TLSCertKeyInSecret = "tls.crt"
+	// RegistryHostKeyInSecret is the data key of the labeled secret which contains the registry host.
+	RegistryHostKeyInSecret = "registry-host"
 
 	// OwnerAnnotationKey ...
 	OwnerAnnotationKey = "registry.goharbor.io/uri"
+	// RegistryHostAnnotationKey is the annotation of the labeled secret which specifies the registry host.
+	// It takes precedence over the RegistryHostKeyInSecret data key.
+	RegistryHostAnnotationKey = "goharbor.io/registry-host"
+	// RegistryAliasesAnnotationKey is the annotation of the labeled secret which specifies the comma separated
+	// other hosts the registry is reachable at.
+	RegistryAliasesAnnotationKey = "goharbor.io/registry-aliases"
 	// InjectionVersionAnnotationKey ...
 	InjectionVersionAnnotationKey = "injection.goharbor.io/version"
+	// SourceSecretsAnnotationKey is the annotation of CertInjection which records the comma separated
+	// namespace/name of the secrets read when extracting the CA from the source.
+	SourceSecretsAnnotationKey = "injection.goharbor.io/source-secrets"
+	// SkipCleanupAnnotationKey is the annotation of CertInjection which releases it without removing the injected
+	// files from the nodes when it's set to "true", e.g. when the cleanup is stuck.
+	SkipCleanupAnnotationKey = "injection.goharbor.io/skip-cleanup"
+	// RetainedInjectionsAnnotationKey is the annotation of the bundle secret which records the comma separated
+	// namespace/name of the injections switched away from the shared injectors, whose files are left on the nodes.
+	RetainedInjectionsAnnotationKey = "injection.goharbor.io/retained-injections"
+	// BundleRevisionAnnotationKey is the annotation of the shared injector pods which records the revision of the
+	// bundle, then the rollout of the injectors tells whether the bundle has been applied on all the nodes.
+	BundleRevisionAnnotationKey = "injection.goharbor.io/bundle-revision"
 	// LastUpdateTimestampAnnotationKey ...
 	LastUpdateTimestampAnnotationKey = "goharbor.io/last-updated"
 
@@ -29,6 +55,21 @@ const (
 	OwnerGVKLabel = "owner.goharbor.io/gvk"
 	// OwnerNameLabel ...
 	OwnerNameLabel = "owner.goharbor.io/name"
+	// ContainerRuntimeLabel is the label of the injector which indicates the container runtime it serves.
+	ContainerRuntimeLabel = "injector.goharbor.io/container-runtime"
+	// NodeContainerRuntimeLabel is the label of the node which indicates its container runtime.
+	// The injectors serving a container runtime select the nodes by it.
+	NodeContainerRuntimeLabel = "node.goharbor.io/container-runtime"
+	// InjectorRoleLabel is the label of the ds which indicates whether it injects or cleans up the CA,
+	// or it's a shared injector.
+	InjectorRoleLabel = "injector.goharbor.io/role"
+
+	// CleanupFinalizer is the finalizer of CertInjection which is released after the injected files
+	// have been removed from the nodes.
+	CleanupFinalizer = "injection.goharbor.io/node-cleanup"
+	// ProfileCleanupFinalizer is the finalizer of CertSourceProfile which is released after the cert injections
+	// of the kind it targets have been removed.
+	ProfileCleanupFinalizer = "injection.goharbor.io/profile-cleanup"
 
 	// HarborCluster kind.
 	HarborCluster = "HarborCluster"
@@ -36,14 +77,66 @@ const (
 	PackageInstall = "PackageInstall"
 	// Secret kind.
 	Secret = "Secret"
+	// Certificate kind of cert-manager.
+	Certificate = "Certificate"
+	// Ingress kind.
+	Ingress = "Ingress"
+	// GatewayAPIGroup is the group of the Gateway API.
+	GatewayAPIGroup = "gateway.networking.k8s.io"
+	// Gateway kind of the Gateway API.
+	Gateway = "Gateway"
+	// HTTPRoute kind of the Gateway API.
+	HTTPRoute = "HTTPRoute"
 	// CertInjection kind.
 	CertInjection = "CertInjection"
+	// ClusterCertInjection kind.
+	ClusterCertInjection = "ClusterCertInjection"
+	// CertSourceProfile kind.
+	CertSourceProfile = "CertSourceProfile"
 	// ConditionReady ...
 	ConditionReady = "Ready"
 	// ConditionInjector ...
 	ConditionInjector = "Injector Ready"
 	// ConditionCAReady ...
 	ConditionCAReady = "CA Secret Ready"
+	// ConditionNodesInjected indicates whether the CA cert has been injected into all the nodes.
+	ConditionNodesInjected = "NodesInjected"
+	// ConditionCertExpiringSoon indicates whether any injected CA cert expires within the warning window.
+	ConditionCertExpiringSoon = "CertExpiringSoon"
+	// ConditionCAMismatch indicates whether the CA presented by the registry differs from the CA injected.
+	ConditionCAMismatch = "CAMismatch"
+	// ConditionCAVerified indicates whether the CA extracted from the source verifies the server certificate
+	// of the registry.
+	ConditionCAVerified = "CAVerified"
+
+	// EventReasonExtractFailed is the event reason of failing to extract the CA from the source.
+	EventReasonExtractFailed = "ExtractFailed"
+	// EventReasonTLSNotEnabled is the event reason of skipping the source without TLS enabled.
+	EventReasonTLSNotEnabled = "TLSNotEnabled"
+	// EventReasonCertInjectionCreated is the event reason of creating the cert injection of the source.
+	EventReasonCertInjectionCreated = "CertInjectionCreated"
+	// EventReasonCASecretRotated is the event reason of updating the CA secret as the source is changed.
+	EventReasonCASecretRotated = "CASecretRotated"
+	// EventReasonInjectorCreated ...
+	EventReasonInjectorCreated = "InjectorCreated"
+	// EventReasonInjectorUpdated ...
+	EventReasonInjectorUpdated = "InjectorUpdated"
+	// EventReasonInjectorDeleted ...
+	EventReasonInjectorDeleted = "InjectorDeleted"
+	// EventReasonInjectFailed ...
+	EventReasonInjectFailed = "InjectFailed"
+	// EventReasonCleanupStarted is the event reason of starting to remove the injected files from the nodes.
+	EventReasonCleanupStarted = "CleanupStarted"
+	// EventReasonCleanupCompleted is the event reason of the injected files removed from all the nodes.
+	EventReasonCleanupCompleted = "CleanupCompleted"
+	// EventReasonCleanupSkipped is the event reason of leaving the injected files on the nodes without cleaning up.
+	EventReasonCleanupSkipped = "CleanupSkipped"
+	// EventReasonCAMismatch is the event reason of the registry presenting a CA other than the CA injected.
+	EventReasonCAMismatch = "CAMismatch"
+	// EventReasonCAVerifyFailed is the event reason of skipping the CA failing the verification.
+	EventReasonCAVerifyFailed = "CAVerifyFailed"
+	// EventReasonProfileNotReady is the event reason of failing to watch the kind targeted by the profile.
+	EventReasonProfileNotReady = "ProfileNotReady"
 )
 
 // Injection includes the related info extracted from the certificate source and
@@ -51,6 +144,14 @@ const (
 type Injection struct {
 	// ExternalDNS of the harbor registry.
 	ExternalDNS string
+	// Aliases are the other hosts the harbor registry is reachable at.
+	Aliases []string
 	// CACert is certificate content.
 	CACert []byte
+	// ServerCert is the PEM encoded certificate chain the registry serves, which the CA is verified against.
+	// It's empty if the source has no server certificate.
+	ServerCert []byte
+	// SourceSecrets are the secrets read when extracting the CA from the source,
+	// the source is reconciled again when any of them is changed.
+	SourceSecrets []k8stypes.NamespacedName
 }